@@ -0,0 +1,437 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/go_limit"
+	"github.com/hqmin9527/kits-go/src/oss"
+	"github.com/pkg/errors"
+)
+
+const goLimitCount = 10
+
+type command func(p *profiles, args []string) error
+
+var commands = map[string]command{
+	"ls":      cmdLs,
+	"cat":     cmdCat,
+	"cp":      cmdCp,
+	"mv":      cmdMv,
+	"rm":      cmdRm,
+	"sync":    cmdSync,
+	"stat":    cmdStat,
+	"presign": cmdPresign,
+	"sign":    cmdSign,
+	"token":   cmdToken,
+}
+
+// 解析子命令的参数，要求必须有n个位置参数
+func parseArgs(fs *flag.FlagSet, args []string, n int) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != n {
+		return errors.Errorf("%s needs %d arguments, got %d", fs.Name(), n, fs.NArg())
+	}
+	return nil
+}
+
+func parseRemote(p *profiles, arg string) (*location, error) {
+	l, err := p.parse(arg)
+	if err != nil {
+		return nil, err
+	}
+	if !l.remote() {
+		return nil, errors.Errorf("%s is not a remote path (profile:key)", arg)
+	}
+	return l, nil
+}
+
+// 递归操作时远程路径按目录处理，避免前缀data匹配到database
+func asDir(l *location) *location {
+	if l.remote() && l.path != "" && !strings.HasSuffix(l.path, "/") {
+		res := *l
+		res.path += "/"
+		return &res
+	}
+	return l
+}
+
+func cmdLs(p *profiles, args []string) error {
+	fs := flag.NewFlagSet("ls", flag.ExitOnError)
+	recursive := fs.Bool("r", false, "递归列举")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	l, err := parseRemote(p, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var files []oss.FileMeta
+	if *recursive {
+		files, err = l.w.ListObjects(l.path)
+	} else {
+		var dirs []string
+		dirs, files, err = l.w.ListDir(l.path)
+		for _, dir := range dirs {
+			fmt.Printf("%10s  %19s  %s\n", "DIR", "", dir)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	var total int64
+	for _, file := range files {
+		total += file.Size
+		fmt.Printf("%10s  %19s  %s\n", formatSize(file.Size), file.LastModified.Local().Format(time.DateTime), file.Key)
+	}
+	fmt.Printf("total: %d objects, %s (%d bytes)\n", len(files), formatSize(total), total)
+	return nil
+}
+
+func cmdCat(p *profiles, args []string) error {
+	fs := flag.NewFlagSet("cat", flag.ExitOnError)
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	l, err := parseRemote(p, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	r, err := l.w.GetReader(l.path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	_, err = io.Copy(os.Stdout, r)
+	return err
+}
+
+func cmdCp(p *profiles, args []string) error {
+	return copyCommand("cp", p, args, false)
+}
+
+func cmdMv(p *profiles, args []string) error {
+	return copyCommand("mv", p, args, true)
+}
+
+func copyCommand(name string, p *profiles, args []string, move bool) error {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	recursive := fs.Bool("r", false, "递归复制目录")
+	if err := parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+	src, err := p.parse(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	dst, err := p.parse(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if !src.remote() && !dst.remote() {
+		return errors.New("at least one of src and dst must be remote (profile:key)")
+	}
+
+	if !*recursive {
+		if dst.isDir() {
+			dst = dst.join(path.Base(filepath.ToSlash(src.path)))
+		}
+		if err = copyOne(src, dst); err != nil {
+			return err
+		}
+		fmt.Printf("%s -> %s\n", src, dst)
+		if move {
+			return remove(src)
+		}
+		return nil
+	}
+
+	src, dst = asDir(src), asDir(dst)
+	entries, err := walk(src)
+	if err != nil {
+		return err
+	}
+	return runAll(entries, func(e entry) error {
+		from, to := src.join(e.rel), dst.join(e.rel)
+		if err := copyOne(from, to); err != nil {
+			return errors.Wrapf(err, "copy %s", from)
+		}
+		fmt.Printf("%s -> %s\n", from, to)
+		if move {
+			return remove(from)
+		}
+		return nil
+	})
+}
+
+// 复制单个文件：本地上传、下载到本地、同一profile内复制、不同profile之间流式复制
+func copyOne(src *location, dst *location) error {
+	switch {
+	case !src.remote():
+		return dst.w.PutFile(dst.path, src.path)
+	case !dst.remote():
+		r, err := src.w.GetReader(src.path)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = r.Close()
+		}()
+		if err = os.MkdirAll(filepath.Dir(dst.path), 0755); err != nil {
+			return err
+		}
+		fd, err := os.Create(dst.path)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(fd, r); err != nil {
+			_ = fd.Close()
+			return err
+		}
+		return fd.Close()
+	case src.w == dst.w:
+		return src.w.CopyObject(src.path, dst.path)
+	default:
+		meta, err := src.w.GetObjectMeta(src.path)
+		if err != nil {
+			return err
+		}
+		// 按保存的数据复制，压缩的文件保持压缩
+		r, err := src.w.GetReader(src.path, oss.RawContent)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = r.Close()
+		}()
+		// 保留文件的类型、下载文件名和自定义元数据
+		keepMeta := func(m *oss.Metadata) {
+			m.ContentType = meta.ContentType
+			m.ContentEncoding = meta.ContentEncoding
+			m.ContentDisposition = meta.ContentDisposition
+			m.UserMeta = meta.UserMeta
+		}
+		return dst.w.PutReader(dst.path, r, keepMeta)
+	}
+}
+
+func remove(l *location) error {
+	if l.remote() {
+		return l.w.DeleteObject(l.path)
+	}
+	return os.Remove(l.path)
+}
+
+func cmdRm(p *profiles, args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ExitOnError)
+	recursive := fs.Bool("r", false, "删除目录")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	l, err := parseRemote(p, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *recursive {
+		l = asDir(l)
+		if l.path == "" {
+			return errors.New("refuse to remove the whole bucket")
+		}
+		return l.w.DeleteFolder(l.path)
+	}
+	return l.w.DeleteObject(l.path)
+}
+
+func cmdSync(p *profiles, args []string) error {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	del := fs.Bool("delete", false, "删除目标目录中源目录不存在的文件")
+	if err := parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+	src, err := p.parse(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	dst, err := p.parse(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if !src.remote() && !dst.remote() {
+		return errors.New("at least one of src and dst must be remote (profile:key)")
+	}
+	src, dst = asDir(src), asDir(dst)
+
+	srcEntries, err := walk(src)
+	if err != nil {
+		return err
+	}
+	dstEntries, err := walk(dst)
+	if err != nil && !os.IsNotExist(errors.Cause(err)) {
+		return err
+	}
+	existing := make(map[string]entry, len(dstEntries))
+	for _, e := range dstEntries {
+		existing[e.rel] = e
+	}
+
+	var changed []entry
+	for _, e := range srcEntries {
+		old, ok := existing[e.rel]
+		delete(existing, e.rel)
+		// 上传或下载后目标文件的时间总是更新，所以只有源文件更新时才需要再复制
+		if ok && old.size == e.size && !e.modTime.After(old.modTime) {
+			continue
+		}
+		changed = append(changed, e)
+	}
+	err = runAll(changed, func(e entry) error {
+		from, to := src.join(e.rel), dst.join(e.rel)
+		if err := copyOne(from, to); err != nil {
+			return errors.Wrapf(err, "copy %s", from)
+		}
+		fmt.Printf("%s -> %s\n", from, to)
+		return nil
+	})
+	if err != nil || !*del {
+		return err
+	}
+
+	var extra []entry
+	for _, e := range existing {
+		extra = append(extra, e)
+	}
+	return runAll(extra, func(e entry) error {
+		target := dst.join(e.rel)
+		if err := remove(target); err != nil {
+			return errors.Wrapf(err, "delete %s", target)
+		}
+		fmt.Printf("deleted %s\n", target)
+		return nil
+	})
+}
+
+func cmdStat(p *profiles, args []string) error {
+	fs := flag.NewFlagSet("stat", flag.ExitOnError)
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	l, err := parseRemote(p, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	meta, err := l.w.GetObjectMeta(l.path)
+	if err != nil {
+		return err
+	}
+	return printJSON(meta)
+}
+
+func cmdPresign(p *profiles, args []string) error {
+	return signCommand("presign", p, args, func(w *oss.Wrapper, key string, expires time.Duration) (string, error) {
+		return w.PresignObject(key, expires)
+	})
+}
+
+func cmdSign(p *profiles, args []string) error {
+	return signCommand("sign", p, args, func(w *oss.Wrapper, key string, expires time.Duration) (string, error) {
+		return w.SignFile(key, expires)
+	})
+}
+
+func signCommand(name string, p *profiles, args []string,
+	fn func(w *oss.Wrapper, key string, expires time.Duration) (string, error)) error {
+
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	expires := fs.Duration("expires", 15*time.Minute, "有效期")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	l, err := parseRemote(p, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	url, err := fn(l.w, l.path, *expires)
+	if err != nil {
+		return err
+	}
+	fmt.Println(url)
+	return nil
+}
+
+func cmdToken(p *profiles, args []string) error {
+	fs := flag.NewFlagSet("token", flag.ExitOnError)
+	read := fs.Bool("read", false, "只读token")
+	expires := fs.Duration("expires", 15*time.Minute, "有效期")
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	l, err := parseRemote(p, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	var token *oss.StsTokenInfo
+	if *read {
+		token, err = l.w.GetDirTokenRead(l.path, *expires)
+	} else {
+		token, err = l.w.GetDirToken(l.path, *expires)
+	}
+	if err != nil {
+		return err
+	}
+	return printJSON(token)
+}
+
+// 并发处理，返回第一个错误，其他错误输出到stderr
+func runAll(entries []entry, fn func(e entry) error) error {
+	goLimit := go_limit.New(goLimitCount)
+	var mu sync.Mutex
+	for _, e := range entries {
+		eTmp := e
+		goLimit.RunError(func() error {
+			err := fn(eTmp)
+			if err != nil {
+				mu.Lock()
+				fmt.Fprintln(os.Stderr, "kitsoss:", err)
+				mu.Unlock()
+			}
+			return err
+		})
+	}
+	goLimit.Wait()
+	return goLimit.FirstError()
+}
+
+func printJSON(v any) error {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(b))
+	return nil
+}
+
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%dB", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
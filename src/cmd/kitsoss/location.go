@@ -0,0 +1,161 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/oss"
+	"github.com/hqmin9527/kits-go/src/utils"
+	"github.com/pkg/errors"
+)
+
+// 按需创建Wrapper，只使用到的profile才会创建客户端
+type profiles struct {
+	configs  map[string]*oss.Config
+	wrappers map[string]*oss.Wrapper
+}
+
+func loadProfiles(configFile string) (*profiles, error) {
+	configs := make(map[string]*oss.Config)
+	if err := utils.ReadObj(configFile, &configs); err != nil {
+		return nil, errors.Wrapf(err, "load config %s", configFile)
+	}
+	return &profiles{configs: configs, wrappers: make(map[string]*oss.Wrapper)}, nil
+}
+
+func (p *profiles) get(name string) (*oss.Wrapper, error) {
+	if w, ok := p.wrappers[name]; ok {
+		return w, nil
+	}
+	c, ok := p.configs[name]
+	if !ok {
+		return nil, errors.Errorf("profile %s not found", name)
+	}
+	w, err := oss.NewWrapper(c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "create profile %s", name)
+	}
+	p.wrappers[name] = w
+	return w, nil
+}
+
+// 命令行中的路径：profile:key为远程路径，其他为本地路径
+type location struct {
+	profile string
+	w       *oss.Wrapper // 本地路径时为nil
+	path    string
+}
+
+func (l *location) remote() bool {
+	return l.w != nil
+}
+
+func (l *location) isDir() bool {
+	if l.remote() {
+		return l.path == "" || strings.HasSuffix(l.path, "/")
+	}
+	if strings.HasSuffix(l.path, "/") || strings.HasSuffix(l.path, string(filepath.Separator)) {
+		return true
+	}
+	fi, err := os.Stat(l.path)
+	return err == nil && fi.IsDir()
+}
+
+func (l *location) String() string {
+	if l.remote() {
+		return l.profile + ":" + l.path
+	}
+	return l.path
+}
+
+// 拼接子路径
+func (l *location) join(rel string) *location {
+	res := *l
+	if l.remote() {
+		res.path = joinKey(l.path, rel)
+	} else {
+		res.path = filepath.Join(l.path, filepath.FromSlash(rel))
+	}
+	return &res
+}
+
+// 把profile:key拆分为profile和key，windows盘符（如C:\）和以.或/开头的路径按本地路径处理
+func splitLocation(arg string) (string, string, bool) {
+	index := strings.Index(arg, ":")
+	if index <= 0 {
+		return "", arg, false
+	}
+	profile := arg[:index]
+	if len(profile) == 1 || strings.ContainsAny(profile, `/\.`) {
+		return "", arg, false
+	}
+	return profile, strings.TrimPrefix(arg[index+1:], "/"), true
+}
+
+func (p *profiles) parse(arg string) (*location, error) {
+	profile, path, ok := splitLocation(arg)
+	if !ok {
+		return &location{path: path}, nil
+	}
+	w, err := p.get(profile)
+	if err != nil {
+		return nil, err
+	}
+	return &location{profile: profile, w: w, path: path}, nil
+}
+
+// 递归遍历时的文件，rel为相对于遍历起点的路径（使用"/"分隔）
+type entry struct {
+	rel     string
+	size    int64
+	modTime time.Time
+}
+
+// 遍历目录下的所有文件，远程路径按前缀处理
+func walk(l *location) ([]entry, error) {
+	var res []entry
+	if l.remote() {
+		contents, err := l.w.ListObjects(l.path)
+		if err != nil {
+			return nil, err
+		}
+		for _, content := range contents {
+			if strings.HasSuffix(content.Key, "/") {
+				continue
+			}
+			res = append(res, entry{
+				rel:     strings.TrimPrefix(strings.TrimPrefix(content.Key, l.path), "/"),
+				size:    content.Size,
+				modTime: content.LastModified,
+			})
+		}
+		return res, nil
+	}
+	err := filepath.Walk(l.path, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(l.path, path)
+		if err != nil {
+			return err
+		}
+		res = append(res, entry{rel: filepath.ToSlash(rel), size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return res, err
+}
+
+func joinKey(dir string, rel string) string {
+	if dir == "" {
+		return rel
+	}
+	if strings.HasSuffix(dir, "/") {
+		return dir + rel
+	}
+	return dir + "/" + rel
+}
@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestSplitLocation(t *testing.T) {
+	cases := []struct {
+		arg     string
+		profile string
+		path    string
+		remote  bool
+	}{
+		{"ali:data/a.txt", "ali", "data/a.txt", true},
+		{"ali:/data/", "ali", "data/", true},
+		{"ali:", "ali", "", true},
+		{"./a:b.txt", "", "./a:b.txt", false},
+		{`C:\data\a.txt`, "", `C:\data\a.txt`, false},
+		{"/tmp/a.txt", "", "/tmp/a.txt", false},
+		{"a.txt", "", "a.txt", false},
+	}
+	for _, c := range cases {
+		profile, path, remote := splitLocation(c.arg)
+		if profile != c.profile || path != c.path || remote != c.remote {
+			t.Errorf("arg: %s, expected: %s %s %v, got: %s %s %v",
+				c.arg, c.profile, c.path, c.remote, profile, path, remote)
+		}
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	cases := map[int64]string{
+		0:               "0B",
+		1023:            "1023B",
+		1024:            "1.0KB",
+		1536:            "1.5KB",
+		5 * 1024 * 1024: "5.0MB",
+	}
+	for size, expected := range cases {
+		if got := formatSize(size); got != expected {
+			t.Errorf("size: %d, expected: %s, got: %s", size, expected, got)
+		}
+	}
+}
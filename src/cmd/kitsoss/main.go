@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/hqmin9527/kits-go/src/logger"
+)
+
+// kitsoss 使用oss.InitByMap相同格式的配置（map[string]*oss.Config的json）操作对象存储
+// 远程路径格式为 profile:key，其他路径为本地路径，例如：
+//   kitsoss ls -r ali:data/
+//   kitsoss cp ./a.txt ali:data/a.txt
+//   kitsoss cp -r ali:data/ hw:backup/data/
+//   kitsoss sync -delete ./static/ minio:static/
+
+const usage = `usage: kitsoss [-config file] [-v] <command> [args]
+
+commands:
+  ls [-r] profile:prefix        列举（-r递归），最后输出文件数和总大小
+  cat profile:key               输出文件内容
+  cp [-r] src dst               复制，支持本地、同一profile、不同profile之间
+  mv [-r] src dst               移动（复制后删除源文件）
+  rm [-r] profile:key           删除（-r删除目录）
+  sync [-delete] src dst        同步目录，只复制不存在或大小、时间不一致的文件
+  stat profile:key              文件信息
+  presign [-expires 15m] profile:key      上传的预签名url
+  sign [-expires 15m] profile:key         下载的签名url
+  token [-read] [-expires 15m] profile:dir 临时token
+
+config: -config参数，或者环境变量KITSOSS_CONFIG，默认~/.kitsoss.json
+`
+
+func main() {
+	fs := flag.NewFlagSet("kitsoss", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	configFile := fs.String("config", defaultConfigFile(), "配置文件")
+	verbose := fs.Bool("v", false, "输出调试日志")
+	_ = fs.Parse(os.Args[1:])
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	// 日志默认输出到stdout，避免影响cat等命令的输出
+	if *verbose {
+		logger.SetLogLevel(logger.DEBUG)
+	} else {
+		logger.SetLogLevel(logger.ERROR)
+	}
+
+	profiles, err := loadProfiles(*configFile)
+	if err != nil {
+		fatal(err)
+	}
+	cmd, ok := commands[fs.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command: %s\n", fs.Arg(0))
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err = cmd(profiles, fs.Args()[1:]); err != nil {
+		fatal(err)
+	}
+}
+
+func defaultConfigFile() string {
+	if f := os.Getenv("KITSOSS_CONFIG"); f != "" {
+		return f
+	}
+	home, _ := os.UserHomeDir()
+	return home + "/.kitsoss.json"
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "kitsoss:", err)
+	os.Exit(1)
+}
@@ -0,0 +1,268 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// 分块的AES-GCM流式加密
+// 明文按chunkSize分块，每块单独加密认证（密文块 = 明文块 + 16字节tag）
+// 第i块的nonce为基础nonce与i异或，最后一块的附加数据为1，用于防止截断和块的重排
+// 因为每块可以独立解密，所以支持只解密其中一段（范围读取）
+
+const (
+	GcmNonceSize        = 12
+	GcmTagSize          = 16
+	DefaultGcmChunkSize = 64 * 1024
+	MaxGcmChunkSize     = 16 * 1024 * 1024 // 解密时每块需要分配chunkSize大小的缓冲区
+)
+
+type GcmStream struct {
+	aead      cipher.AEAD
+	nonce     []byte
+	chunkSize int
+}
+
+// NewGcmStream key长度必须为16｜24｜32字节，nonce长度必须为12字节，chunkSize<=0时使用默认值64KB
+func NewGcmStream(key []byte, nonce []byte, chunkSize int) (*GcmStream, error) {
+	aead, err := newGcm(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, errors.New("invalid gcm nonce size")
+	}
+	if chunkSize <= 0 {
+		chunkSize = DefaultGcmChunkSize
+	}
+	return &GcmStream{aead: aead, nonce: append([]byte(nil), nonce...), chunkSize: chunkSize}, nil
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.Wrap(err, "new aes cipher")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Wrap(err, "new gcm")
+	}
+	return aead, nil
+}
+
+func (s *GcmStream) ChunkSize() int {
+	return s.chunkSize
+}
+
+// CipherSize 明文大小对应的密文大小
+func (s *GcmStream) CipherSize(plainSize int64) int64 {
+	return plainSize + s.chunkCount(plainSize)*GcmTagSize
+}
+
+// PlainSize 密文大小对应的明文大小
+func (s *GcmStream) PlainSize(cipherSize int64) int64 {
+	full := int64(s.chunkSize + GcmTagSize)
+	chunks := (cipherSize + full - 1) / full
+	if chunks == 0 {
+		return 0
+	}
+	return cipherSize - chunks*GcmTagSize
+}
+
+// LastChunk 最后一块的序号
+func (s *GcmStream) LastChunk(plainSize int64) int64 {
+	return s.chunkCount(plainSize) - 1
+}
+
+// CipherRange 明文范围[offset, offset+length)对应的密文范围，length<0表示读到结尾
+// 返回密文的起始位置、长度，以及第一块的序号
+func (s *GcmStream) CipherRange(offset int64, length int64, plainSize int64) (int64, int64, int64) {
+	cs := int64(s.chunkSize)
+	full := cs + GcmTagSize
+	end := offset + length
+	if length < 0 || end > plainSize {
+		end = plainSize
+	}
+	firstChunk := offset / cs
+	lastChunk := firstChunk
+	if end > offset {
+		lastChunk = (end - 1) / cs
+	}
+	cipherOffset := firstChunk * full
+	cipherEnd := (lastChunk + 1) * full
+	if total := s.CipherSize(plainSize); cipherEnd > total {
+		cipherEnd = total
+	}
+	return cipherOffset, cipherEnd - cipherOffset, firstChunk
+}
+
+// 空明文也会生成一个只有tag的块
+func (s *GcmStream) chunkCount(plainSize int64) int64 {
+	cs := int64(s.chunkSize)
+	chunks := (plainSize + cs - 1) / cs
+	if chunks == 0 {
+		chunks = 1
+	}
+	return chunks
+}
+
+func (s *GcmStream) chunkNonce(index int64) []byte {
+	nonce := append([]byte(nil), s.nonce...)
+	var idx [8]byte
+	binary.BigEndian.PutUint64(idx[:], uint64(index))
+	for i := 0; i < len(idx); i++ {
+		nonce[len(nonce)-len(idx)+i] ^= idx[i]
+	}
+	return nonce
+}
+
+func chunkAad(last bool) []byte {
+	if last {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// EncryptWriter 写入明文，加密后写到w，必须调用Close写出最后一块（不会关闭w）
+func (s *GcmStream) EncryptWriter(w io.Writer) io.WriteCloser {
+	return &gcmWriter{s: s, w: w, buf: make([]byte, 0, s.chunkSize)}
+}
+
+type gcmWriter struct {
+	s      *GcmStream
+	w      io.Writer
+	buf    []byte
+	index  int64
+	closed bool
+}
+
+func (g *gcmWriter) Write(p []byte) (int, error) {
+	if g.closed {
+		return 0, errors.New("gcm writer is closed")
+	}
+	n := 0
+	for len(p) > 0 {
+		// 缓冲区满了并且还有后续数据，说明不是最后一块
+		if len(g.buf) == g.s.chunkSize {
+			if err := g.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(g.buf[len(g.buf):g.s.chunkSize], p)
+		g.buf = g.buf[:len(g.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (g *gcmWriter) Close() error {
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	return g.flush(true)
+}
+
+func (g *gcmWriter) flush(last bool) error {
+	out := g.s.aead.Seal(nil, g.s.chunkNonce(g.index), g.buf, chunkAad(last))
+	g.index++
+	g.buf = g.buf[:0]
+	_, err := g.w.Write(out)
+	return err
+}
+
+// DecryptReader 从r中读取firstChunk开始到文件结尾的密文，解密后返回明文，lastChunk为整个文件最后一块的序号
+func (s *GcmStream) DecryptReader(r io.Reader, firstChunk int64, lastChunk int64) io.Reader {
+	return s.DecryptRangeReader(r, firstChunk, lastChunk, lastChunk)
+}
+
+// DecryptRangeReader 从r中读取[firstChunk, endChunk]的密文，lastChunk为整个文件最后一块的序号
+// 密文在endChunk之前结束时返回io.ErrUnexpectedEOF
+func (s *GcmStream) DecryptRangeReader(r io.Reader, firstChunk int64, endChunk int64, lastChunk int64) io.Reader {
+	return &gcmReader{s: s, r: r, index: firstChunk, end: endChunk, last: lastChunk,
+		buf: make([]byte, s.chunkSize+GcmTagSize)}
+}
+
+type gcmReader struct {
+	s     *GcmStream
+	r     io.Reader
+	index int64
+	end   int64 // 需要读取的最后一块
+	last  int64 // 整个文件的最后一块
+	buf   []byte
+	plain []byte
+}
+
+func (g *gcmReader) Read(p []byte) (int, error) {
+	for len(g.plain) == 0 {
+		if g.index > g.end {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(g.r, g.buf)
+		if err == io.EOF {
+			// 还没有读到endChunk，密文被截断
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+		// 只有整个文件的最后一块可以不满
+		if err == io.ErrUnexpectedEOF && g.index != g.last {
+			return 0, io.ErrUnexpectedEOF
+		}
+		plain, err := g.s.aead.Open(g.buf[:0], g.s.chunkNonce(g.index), g.buf[:n], chunkAad(g.index == g.last))
+		if err != nil {
+			return 0, errors.Wrapf(err, "decrypt chunk %d", g.index)
+		}
+		g.plain = plain
+		g.index++
+	}
+	n := copy(p, g.plain)
+	g.plain = g.plain[n:]
+	return n, nil
+}
+
+// RandomBytes 生成安全的随机字节，用于数据密钥和nonce
+func RandomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, errors.Wrap(err, "read random")
+	}
+	return b, nil
+}
+
+// SealKey 使用主密钥加密数据密钥（AES-GCM），随机nonce放在密文前面
+func SealKey(masterKey []byte, dataKey []byte) ([]byte, error) {
+	aead, err := newGcm(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := RandomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+// OpenKey 使用主密钥解密SealKey的结果
+func OpenKey(masterKey []byte, sealed []byte) ([]byte, error) {
+	aead, err := newGcm(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("sealed key too short")
+	}
+	nonce := sealed[:aead.NonceSize()]
+	dataKey, err := aead.Open(nil, nonce, sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, errors.Wrap(err, "open sealed key")
+	}
+	return dataKey, nil
+}
@@ -0,0 +1,126 @@
+package crypto
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func newTestStream(t *testing.T) *GcmStream {
+	key := bytes.Repeat([]byte{0x11}, 32)
+	nonce := bytes.Repeat([]byte{0x22}, GcmNonceSize)
+	s, err := NewGcmStream(key, nonce, 16)
+	if err != nil {
+		t.Fatalf("new gcm stream failed, err: %s", err)
+	}
+	return s
+}
+
+func encryptAll(t *testing.T, s *GcmStream, plain []byte) []byte {
+	buf := new(bytes.Buffer)
+	w := s.EncryptWriter(buf)
+	if _, err := w.Write(plain); err != nil {
+		t.Fatalf("encrypt write failed, err: %s", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("encrypt close failed, err: %s", err)
+	}
+	return buf.Bytes()
+}
+
+func TestGcmStream_RoundTrip(t *testing.T) {
+	s := newTestStream(t)
+	for _, size := range []int{0, 1, 15, 16, 17, 32, 100} {
+		plain := make([]byte, size)
+		for i := range plain {
+			plain[i] = byte(i)
+		}
+		sealed := encryptAll(t, s, plain)
+		if int64(len(sealed)) != s.CipherSize(int64(size)) {
+			t.Errorf("size %d, expected cipher size: %d, got: %d", size, s.CipherSize(int64(size)), len(sealed))
+		}
+		if s.PlainSize(int64(len(sealed))) != int64(size) {
+			t.Errorf("size %d, expected plain size: %d, got: %d", size, size, s.PlainSize(int64(len(sealed))))
+		}
+		got, err := io.ReadAll(s.DecryptReader(bytes.NewReader(sealed), 0, s.LastChunk(int64(size))))
+		if err != nil {
+			t.Fatalf("size %d, decrypt failed, err: %s", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d, decrypt result not equal", size)
+		}
+	}
+}
+
+func TestGcmStream_Range(t *testing.T) {
+	s := newTestStream(t)
+	plain := make([]byte, 100)
+	for i := range plain {
+		plain[i] = byte(i)
+	}
+	sealed := encryptAll(t, s, plain)
+	size := int64(len(plain))
+	for _, rng := range [][2]int64{{0, 10}, {10, 20}, {16, 16}, {95, -1}, {40, 100}} {
+		offset, length := rng[0], rng[1]
+		cipherOffset, cipherLength, firstChunk := s.CipherRange(offset, length, size)
+		part := sealed[cipherOffset : cipherOffset+cipherLength]
+		endChunk := firstChunk + (cipherLength+int64(s.ChunkSize()+GcmTagSize)-1)/int64(s.ChunkSize()+GcmTagSize) - 1
+		r := s.DecryptRangeReader(bytes.NewReader(part), firstChunk, endChunk, s.LastChunk(size))
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("range %v, decrypt failed, err: %s", rng, err)
+		}
+		skip := offset - firstChunk*int64(s.ChunkSize())
+		end := offset + length
+		if length < 0 || end > size {
+			end = size
+		}
+		got = got[skip : skip+end-offset]
+		if !bytes.Equal(got, plain[offset:end]) {
+			t.Errorf("range %v, expected: %v, got: %v", rng, plain[offset:end], got)
+		}
+	}
+}
+
+func TestGcmStream_Truncate(t *testing.T) {
+	s := newTestStream(t)
+	plain := make([]byte, 40)
+	sealed := encryptAll(t, s, plain)
+	// 在块的边界去掉最后一块，解密必须失败
+	truncated := sealed[:2*(16+GcmTagSize)]
+	_, err := io.ReadAll(s.DecryptReader(bytes.NewReader(truncated), 0, s.LastChunk(40)))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("decrypt truncated data should fail, err: %v", err)
+	}
+	// 按倒数第二块是最后一块解密，认证必须失败
+	_, err = io.ReadAll(s.DecryptReader(bytes.NewReader(truncated), 0, 1))
+	if err == nil {
+		t.Error("decrypt truncated data should fail")
+	}
+	// 范围读取在需要的块之前结束
+	_, err = io.ReadAll(s.DecryptRangeReader(bytes.NewReader(sealed[:16+GcmTagSize]), 0, 1, s.LastChunk(40)))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("decrypt truncated range should fail, err: %v", err)
+	}
+	sealed[3] ^= 0xff
+	_, err = io.ReadAll(s.DecryptReader(bytes.NewReader(sealed), 0, s.LastChunk(40)))
+	if err == nil {
+		t.Error("decrypt tampered data should fail")
+	}
+}
+
+func TestSealKey(t *testing.T) {
+	master := bytes.Repeat([]byte{0x33}, 32)
+	dataKey := bytes.Repeat([]byte{0x44}, 32)
+	sealed, err := SealKey(master, dataKey)
+	if err != nil {
+		t.Fatalf("seal key failed, err: %s", err)
+	}
+	got, err := OpenKey(master, sealed)
+	if err != nil {
+		t.Fatalf("open key failed, err: %s", err)
+	}
+	if !bytes.Equal(got, dataKey) {
+		t.Error("open key result not equal")
+	}
+}
@@ -60,6 +60,27 @@ func (l *LruCache) addSingle(value IKey) *LruCache {
 	return l
 }
 
+// Get 获取元素并移到最新位置
+func (l *LruCache) Get(key any) (any, bool) {
+	elm, ok := l.elements[key]
+	if !ok {
+		return nil, false
+	}
+	l.evicts.MoveToFront(elm)
+	return elm.Value, true
+}
+
+// Remove 删除元素，不会触发淘汰回调
+func (l *LruCache) Remove(key any) bool {
+	elm, ok := l.elements[key]
+	if !ok {
+		return false
+	}
+	l.evicts.Remove(elm)
+	delete(l.elements, key)
+	return true
+}
+
 // RangeFromLatest 正序遍历，从最近添加的开始访问
 func (l *LruCache) RangeFromLatest(f func(value any) bool) {
 	elm := l.evicts.Front()
@@ -102,3 +102,28 @@ func TestLruCache_Overwrite(t *testing.T) {
 		t.Errorf("expected: %v, got: %v\n", expected, res)
 	}
 }
+
+func TestLruCache_GetRemove(t *testing.T) {
+	evicted := 0
+	cache := NewLruCache(3, func(value any) { evicted++ })
+	cache.Add(Value("A"), Value("B"), Value("C"))
+
+	if v, ok := cache.Get(Value("A")); !ok || v != Value("A") {
+		t.Errorf("expected A, got: %v, %v\n", v, ok)
+	}
+	if cache.Remove(Value("B")) != true || cache.Remove(Value("B")) != false {
+		t.Error("remove result not expected")
+	}
+	if evicted != 0 || cache.Len() != 2 {
+		t.Errorf("remove should not evict, evicted: %d, len: %d\n", evicted, cache.Len())
+	}
+
+	var res []Value
+	cache.RangeFromEarliest(func(value any) bool {
+		res = append(res, value.(Value))
+		return true
+	})
+	if expected := []Value{"C", "A"}; !reflect.DeepEqual(expected, res) {
+		t.Errorf("expected: %v, got: %v\n", expected, res)
+	}
+}
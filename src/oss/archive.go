@@ -0,0 +1,394 @@
+package oss
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"mime"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 打包下载和解压上传，都不使用本地临时文件
+// ArchiveFolder 按顺序写入压缩包，同时并发预取后面的小文件，大文件在写入时才流式读取，内存占用有上限
+// ExtractArchive 边解压边上传，每个文件根据扩展名设置Content-Type，并在自定义元数据中保存修改时间
+// 压缩包和解压后的总大小都有上限（默认1GB和10GB），超过时返回ErrArchiveTooLarge，已上传的文件不会删除
+
+const (
+	ArchiveZip   = "zip"
+	ArchiveTarGz = "tar.gz"
+)
+
+const (
+	archivePrefetchCount = 4               // 同时预取的文件数
+	archivePrefetchSize  = 4 * 1024 * 1024 // 小于该大小的文件才预取到内存
+	archiveMetaMtime     = "kits-mtime"    // 解压时保存文件修改时间（unix秒）的自定义元数据
+
+	archiveDefaultMaxSize      = 1024 * 1024 * 1024      // 压缩包的默认大小上限
+	archiveDefaultMaxExtracted = 10 * 1024 * 1024 * 1024 // 解压后总大小的默认上限
+)
+
+var ErrArchiveTooLarge = errors.New("oss archive exceeds the size limit")
+
+// ArchiveMaxSize 解压时压缩包的大小上限，<0表示不限制，用于ExtractArchive
+var ArchiveMaxSize = func(size int64) Option {
+	return func(m *Metadata) {
+		m.maxArchiveSize = size
+	}
+}
+
+// ArchiveMaxExtractedSize 解压后所有文件的总大小上限，<0表示不限制，用于ExtractArchive
+var ArchiveMaxExtractedSize = func(size int64) Option {
+	return func(m *Metadata) {
+		m.maxExtractedSize = size
+	}
+}
+
+// 预取的结果，data为nil表示大文件，写入时再流式读取
+type archiveFetched struct {
+	data []byte
+	err  error
+}
+
+// ArchiveFolder 把prefix目录下的所有文件打包写入w，压缩包内的路径为相对prefix的路径
+// format为ArchiveZip或ArchiveTarGz，出错时w中已经写入的内容不完整
+func (o *Wrapper) ArchiveFolder(prefix string, w io.Writer, format string) error {
+	if format != ArchiveZip && format != ArchiveTarGz {
+		return errors.New("unsupported archive format: " + format)
+	}
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	contents, err := o.ListObjects(prefix)
+	if err != nil {
+		return err
+	}
+	files := make([]FileMeta, 0, len(contents))
+	for _, content := range contents {
+		if !strings.HasSuffix(content.Key, "/") {
+			files = append(files, content)
+		}
+	}
+
+	// 按顺序预取，写入一个文件后才会预取下一个，最多同时预取archivePrefetchCount个
+	results := make([]chan archiveFetched, len(files))
+	for i := range results {
+		results[i] = make(chan archiveFetched, 1)
+	}
+	sem := make(chan struct{}, archivePrefetchCount)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for i := range files {
+			select {
+			case sem <- struct{}{}:
+			case <-done:
+				return
+			}
+			go func(i int) {
+				if files[i].Size > archivePrefetchSize {
+					results[i] <- archiveFetched{}
+					return
+				}
+				data, err := o.GetObject(files[i].Key)
+				results[i] <- archiveFetched{data: data, err: err}
+			}(i)
+		}
+	}()
+
+	aw := newArchiveWriter(w, format)
+	for i, file := range files {
+		fetched := <-results[i]
+		if fetched.err != nil {
+			return fetched.err
+		}
+		name := strings.TrimPrefix(file.Key, prefix)
+		if err = o.writeArchiveEntry(aw, name, file, fetched.data); err != nil {
+			return err
+		}
+		<-sem
+	}
+	return aw.Close()
+}
+
+// 写入解压后的数据，列举结果中的大小是压缩后的大小，Compress压缩的文件需要使用解压后的大小
+func (o *Wrapper) writeArchiveEntry(aw archiveWriter, name string, file FileMeta, data []byte) error {
+	if data != nil {
+		ew, err := aw.Create(name, int64(len(data)), file.LastModified)
+		if err != nil {
+			return err
+		}
+		_, err = ew.Write(data)
+		return err
+	}
+	body, meta, err := o.getReader(file.Key, 0, -1, nil)
+	if err != nil {
+		return err
+	}
+	size := meta.Size
+	if _, ok := aw.(*tarArchiveWriter); ok && meta.compressed() {
+		// tar需要先写入大小，只能先完整读取一遍得到解压后的大小，再重新读取
+		if size, err = countDecoded(body, meta); err != nil {
+			return err
+		}
+		if body, meta, err = o.getReader(file.Key, 0, -1, nil); err != nil {
+			return err
+		}
+	}
+	r, err := decodeReader(body, meta)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	ew, err := aw.Create(name, size, file.LastModified)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(ew, r)
+	return err
+}
+
+// 解压后的大小，会关闭body
+func countDecoded(body io.ReadCloser, meta *FileMeta) (int64, error) {
+	r, err := decodeReader(body, meta)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	return io.Copy(io.Discard, r)
+}
+
+// 屏蔽zip和tar.gz的差异
+type archiveWriter interface {
+	Create(name string, size int64, modTime time.Time) (io.Writer, error)
+	Close() error
+}
+
+func newArchiveWriter(w io.Writer, format string) archiveWriter {
+	if format == ArchiveZip {
+		return &zipArchiveWriter{zw: zip.NewWriter(w)}
+	}
+	gw := gzip.NewWriter(w)
+	return &tarArchiveWriter{gw: gw, tw: tar.NewWriter(gw)}
+}
+
+type zipArchiveWriter struct {
+	zw *zip.Writer
+}
+
+func (z *zipArchiveWriter) Create(name string, _ int64, modTime time.Time) (io.Writer, error) {
+	return z.zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modTime})
+}
+
+func (z *zipArchiveWriter) Close() error {
+	return z.zw.Close()
+}
+
+type tarArchiveWriter struct {
+	gw *gzip.Writer
+	tw *tar.Writer
+}
+
+func (t *tarArchiveWriter) Create(name string, size int64, modTime time.Time) (io.Writer, error) {
+	hdr := &tar.Header{Name: name, Size: size, Mode: 0644, ModTime: modTime, Typeflag: tar.TypeReg}
+	if err := t.tw.WriteHeader(hdr); err != nil {
+		return nil, err
+	}
+	return t.tw, nil
+}
+
+func (t *tarArchiveWriter) Close() error {
+	if err := t.tw.Close(); err != nil {
+		return err
+	}
+	return t.gw.Close()
+}
+
+// ExtractArchive 解压zip、tar.gz或tar到remoteDir下，返回上传的key，options作用于所有文件
+// zip需要随机读取：r实现了io.ReaderAt和io.Seeker（如*os.File、multipart.File）时直接读取，否则先读入内存
+// 压缩包中的路径会被规范化，不能通过".."跳出remoteDir；目录、链接等非普通文件会被忽略
+func (o *Wrapper) ExtractArchive(r io.Reader, remoteDir string, options ...Option) ([]string, error) {
+	md := buildMetadata(options)
+	maxSize := archiveLimit(md.maxArchiveSize, archiveDefaultMaxSize)
+	extracted := &archiveLimitReader{remain: archiveLimit(md.maxExtractedSize, archiveDefaultMaxExtracted)}
+	br := bufio.NewReader(&archiveLimitReader{r: r, remain: maxSize})
+	head, _ := br.Peek(512)
+	var keys []string
+	put := func(name string, modTime time.Time, body io.Reader) error {
+		key := archiveEntryKey(remoteDir, name)
+		if key == "" {
+			return nil
+		}
+		// 所有文件共用剩余的大小
+		extracted.r = body
+		entryOptions := append([]Option{archiveEntryOption(name, modTime)}, options...)
+		if err := o.PutReader(key, extracted, entryOptions...); err != nil {
+			return err
+		}
+		keys = append(keys, key)
+		return nil
+	}
+
+	switch detectArchiveFormat(head) {
+	case ArchiveZip:
+		ra, size, err := archiveReaderAt(r, br, maxSize)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := zip.NewReader(ra, size)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range zr.File {
+			if !f.Mode().IsRegular() {
+				continue
+			}
+			// 先按声明的大小检查，实际大小在读取时检查
+			if extracted.remain >= 0 && f.UncompressedSize64 > uint64(extracted.remain) {
+				return keys, ErrArchiveTooLarge
+			}
+			fr, err := f.Open()
+			if err != nil {
+				return keys, err
+			}
+			err = put(f.Name, f.Modified, fr)
+			_ = fr.Close()
+			if err != nil {
+				return keys, err
+			}
+		}
+		return keys, nil
+	case ArchiveTarGz:
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = gr.Close()
+		}()
+		return keys, extractTar(tar.NewReader(gr), put)
+	case "tar":
+		return keys, extractTar(tar.NewReader(br), put)
+	default:
+		return nil, errors.New("unsupported archive format")
+	}
+}
+
+func extractTar(tr *tar.Reader, put func(name string, modTime time.Time, body io.Reader) error) error {
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err = put(hdr.Name, hdr.ModTime, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// 根据文件头识别压缩包格式：zip、tar.gz、tar，无法识别时返回空
+func detectArchiveFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("PK\x03\x04")), bytes.HasPrefix(head, []byte("PK\x05\x06")):
+		return ArchiveZip
+	case bytes.HasPrefix(head, []byte{0x1f, 0x8b}):
+		return ArchiveTarGz
+	case len(head) >= 262 && string(head[257:262]) == "ustar":
+		return "tar"
+	}
+	return ""
+}
+
+// zip需要io.ReaderAt和文件大小，br已经限制了大小
+func archiveReaderAt(r io.Reader, br *bufio.Reader, maxSize int64) (io.ReaderAt, int64, error) {
+	if rs, ok := r.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		size, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, err
+		}
+		if maxSize >= 0 && size > maxSize {
+			return nil, 0, ErrArchiveTooLarge
+		}
+		return rs, size, nil
+	}
+	data, err := io.ReadAll(br)
+	if err != nil {
+		return nil, 0, err
+	}
+	return bytes.NewReader(data), int64(len(data)), nil
+}
+
+// 0时使用默认值，<0表示不限制
+func archiveLimit(limit int64, def int64) int64 {
+	if limit == 0 {
+		return def
+	}
+	return limit
+}
+
+// 限制读取的总大小，remain<0表示不限制，超过时返回ErrArchiveTooLarge
+type archiveLimitReader struct {
+	r      io.Reader
+	remain int64
+}
+
+func (l *archiveLimitReader) Read(p []byte) (int, error) {
+	if l.remain < 0 {
+		return l.r.Read(p)
+	}
+	// 多读1个字节，用于判断是否超过上限
+	if int64(len(p)) > l.remain+1 {
+		p = p[:l.remain+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.remain {
+		n = int(l.remain)
+		l.remain = 0
+		return n, ErrArchiveTooLarge
+	}
+	l.remain -= int64(n)
+	return n, err
+}
+
+// 压缩包中的路径转为remoteDir下的key，规范化后为空（如"/"、".."）时返回空
+func archiveEntryKey(remoteDir string, name string) string {
+	name = strings.TrimSuffix(cleanKey(strings.ReplaceAll(name, "\\", "/")), "/")
+	if name == "" {
+		return ""
+	}
+	if remoteDir == "" {
+		return name
+	}
+	return joinPath(remoteDir, name)
+}
+
+// 每个文件的元数据：根据扩展名设置Content-Type，保存修改时间
+func archiveEntryOption(name string, modTime time.Time) Option {
+	return func(m *Metadata) {
+		if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+			m.ContentType = contentType
+		}
+		if !modTime.IsZero() {
+			AddUserMeta(archiveMetaMtime, strconv.FormatInt(modTime.Unix(), 10))(m)
+		}
+	}
+}
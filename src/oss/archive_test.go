@@ -0,0 +1,129 @@
+package oss
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveEntryKey(t *testing.T) {
+	cases := []struct {
+		dir, name, expected string
+	}{
+		{"import", "a/b.txt", "import/a/b.txt"},
+		{"import/", "/a/b.txt", "import/a/b.txt"},
+		{"import", "../../etc/passwd", "import/etc/passwd"},
+		{"import", "a\\..\\..\\b.txt", "import/b.txt"},
+		{"import", "dir/", "import/dir"},
+		{"import", "..", ""},
+		{"", "a.txt", "a.txt"},
+	}
+	for _, c := range cases {
+		if got := archiveEntryKey(c.dir, c.name); got != c.expected {
+			t.Errorf("dir: %s, name: %s, expected: %s, got: %s", c.dir, c.name, c.expected, got)
+		}
+	}
+}
+
+func TestDetectArchiveFormat(t *testing.T) {
+	for _, format := range []string{ArchiveZip, ArchiveTarGz} {
+		buf := new(bytes.Buffer)
+		aw := newArchiveWriter(buf, format)
+		ew, err := aw.Create("a.txt", 5, time.Now())
+		if err != nil {
+			t.Fatalf("create entry failed, err: %s", err)
+		}
+		_, _ = ew.Write([]byte("hello"))
+		if err = aw.Close(); err != nil {
+			t.Fatalf("close archive failed, err: %s", err)
+		}
+		if got := detectArchiveFormat(buf.Bytes()); got != format {
+			t.Errorf("expected: %s, got: %s", format, got)
+		}
+	}
+	if got := detectArchiveFormat([]byte("hello")); got != "" {
+		t.Errorf("expected empty format, got: %s", got)
+	}
+}
+
+func TestExtractArchiveLimit(t *testing.T) {
+	o, st := newMemWrapper()
+	buf := new(bytes.Buffer)
+	aw := newArchiveWriter(buf, ArchiveZip)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		ew, _ := aw.Create(name, 1000, time.Now())
+		_, _ = ew.Write(bytes.Repeat([]byte("a"), 1000))
+	}
+	_ = aw.Close()
+	zipData := buf.Bytes()
+
+	keys, err := o.ExtractArchive(bytes.NewReader(zipData), "x", ArchiveMaxSize(-1), ArchiveMaxExtractedSize(2000))
+	if err != nil || len(keys) != 2 || len(st.objects["x/b.txt"]) != 1000 {
+		t.Errorf("archive within limits should be extracted, keys: %v, err: %v", keys, err)
+	}
+	if _, err = o.ExtractArchive(bytes.NewReader(zipData), "y", ArchiveMaxExtractedSize(1500)); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("extracted size should be limited, err: %v", err)
+	}
+	// 不能随机读取时先读入内存
+	if _, err = o.ExtractArchive(io.MultiReader(bytes.NewReader(zipData)), "y", ArchiveMaxSize(100)); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("buffered archive size should be limited, err: %v", err)
+	}
+	if _, err = o.ExtractArchive(bytes.NewReader(zipData), "y", ArchiveMaxSize(100)); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("archive size should be limited, err: %v", err)
+	}
+
+	buf = new(bytes.Buffer)
+	aw = newArchiveWriter(buf, ArchiveTarGz)
+	ew, _ := aw.Create("c.txt", 1000, time.Now())
+	_, _ = ew.Write(bytes.Repeat([]byte("c"), 1000))
+	_ = aw.Close()
+	if _, err = o.ExtractArchive(bytes.NewReader(buf.Bytes()), "z", ArchiveMaxExtractedSize(999)); !errors.Is(err, ErrArchiveTooLarge) {
+		t.Errorf("extracted size of tar should be limited, err: %v", err)
+	}
+	if st.objects["z/c.txt"] != nil {
+		t.Errorf("truncated file should not be uploaded")
+	}
+}
+
+func TestArchiveCompressed(t *testing.T) {
+	o, st := newMemWrapper()
+	small := []byte(strings.Repeat("small ", 100))
+	// 超过预取大小，写入时流式读取
+	large := []byte(strings.Repeat("large ", archivePrefetchSize/5))
+	_ = o.PutObject("src/small.txt", small, Compress)
+	_ = o.PutObject("src/large.txt", large, Compress)
+	if st.encs["src/large.txt"] != encodingGzip {
+		t.Fatal("object should be compressed")
+	}
+	for _, format := range []string{ArchiveTarGz, ArchiveZip} {
+		buf := new(bytes.Buffer)
+		if err := o.ArchiveFolder("src", buf, format); err != nil {
+			t.Fatalf("archive %s failed, err: %v", format, err)
+		}
+		if _, err := o.ExtractArchive(buf, format); err != nil {
+			t.Fatalf("extract %s failed, err: %v", format, err)
+		}
+		gotSmall, _ := o.GetObject(format + "/small.txt")
+		gotLarge, _ := o.GetObject(format + "/large.txt")
+		if !bytes.Equal(gotSmall, small) || !bytes.Equal(gotLarge, large) {
+			t.Errorf("archive %s should contain the decompressed data, size: %d, %d", format, len(gotSmall), len(gotLarge))
+		}
+	}
+}
+
+func TestArchiveAndExtract(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := ossHelper.ArchiveFolder(path.Join(testDir, "fs"), buf, ArchiveZip)
+	fmt.Println("archive err:", err, "size:", buf.Len())
+	_ = os.WriteFile(os.TempDir()+"/oss-archive.zip", buf.Bytes(), 0644)
+
+	keys, err := ossHelper.ExtractArchive(bytes.NewReader(buf.Bytes()), path.Join(testDir, "extract"))
+	fmt.Println("extract err:", err)
+	fmt.Println("keys:", keys)
+}
@@ -0,0 +1,126 @@
+package oss
+
+// bucket管理：创建、删除、生命周期、跨域、策略、ACL、防盗链
+// 使用统一的模型，由各平台映射为自己的接口；平台不支持的配置返回ErrNotSupported
+// bucket级别的操作不受Wrapper作用域（Root、BaseDir、Sub）影响，规则中的前缀为bucket内的完整前缀
+
+// StorageClass 存储类型
+type StorageClass string
+
+const (
+	StorageStandard StorageClass = "Standard" // 标准存储
+	StorageIA       StorageClass = "IA"       // 低频访问：阿里云IA，华为WARM
+	StorageArchive  StorageClass = "Archive"  // 归档存储：阿里云Archive，华为COLD
+)
+
+// LifecycleRule 生命周期规则，天数都是相对文件最后修改时间（分片上传为初始化时间），0表示不设置
+type LifecycleRule struct {
+	ID                 string
+	Prefix             string // 为空表示整个bucket
+	Disabled           bool
+	ExpireDays         int // 过期删除
+	Transitions        []LifecycleTransition
+	AbortMultipartDays int // 清理未完成的分片上传
+}
+
+// LifecycleTransition 转换存储类型
+type LifecycleTransition struct {
+	Days         int
+	StorageClass StorageClass
+}
+
+// CORSRule 跨域规则
+type CORSRule struct {
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	ExposeHeaders  []string
+	MaxAgeSeconds  int
+}
+
+// RefererConfig 防盗链的Referer白名单，Referers为空表示不限制
+type RefererConfig struct {
+	AllowEmpty bool
+	Referers   []string
+}
+
+// CreateBucket 创建配置中的bucket，acl为空时使用平台默认的私有权限
+// minio只支持私有权限，其他acl返回ErrNotSupported，需要创建后通过SetBucketPolicy设置
+func (o *Wrapper) CreateBucket(acl ACL) error {
+	return o.st.CreateBucket(o.oc.Bucket, acl)
+}
+
+// DeleteBucket 删除配置中的bucket，bucket必须为空
+func (o *Wrapper) DeleteBucket() error {
+	return o.st.DeleteBucket(o.oc.Bucket)
+}
+
+func (o *Wrapper) IsBucketExist() (bool, error) {
+	return o.st.IsBucketExist(o.oc.Bucket)
+}
+
+func (o *Wrapper) SetBucketAcl(acl ACL) error {
+	return o.st.SetBucketAcl(o.oc.Bucket, acl)
+}
+
+func (o *Wrapper) GetBucketAcl() (ACL, error) {
+	return o.st.GetBucketAcl(o.oc.Bucket)
+}
+
+// SetBucketPolicy 设置bucket策略，policy为各平台自己语法的json，为空表示删除
+func (o *Wrapper) SetBucketPolicy(policy string) error {
+	return o.st.SetBucketPolicy(o.oc.Bucket, policy)
+}
+
+// GetBucketPolicy 没有设置时返回空
+func (o *Wrapper) GetBucketPolicy() (string, error) {
+	policy, err := o.st.GetBucketPolicy(o.oc.Bucket)
+	if isNoSuchConfig(err) {
+		return "", nil
+	}
+	return policy, err
+}
+
+// SetBucketLifecycle 覆盖全部生命周期规则，rules为空表示删除
+func (o *Wrapper) SetBucketLifecycle(rules []LifecycleRule) error {
+	return o.st.SetBucketLifecycle(o.oc.Bucket, rules)
+}
+
+// GetBucketLifecycle 没有设置时返回空
+func (o *Wrapper) GetBucketLifecycle() ([]LifecycleRule, error) {
+	rules, err := o.st.GetBucketLifecycle(o.oc.Bucket)
+	if isNoSuchConfig(err) {
+		return nil, nil
+	}
+	return rules, err
+}
+
+// SetBucketCORS 覆盖全部跨域规则，rules为空表示删除
+func (o *Wrapper) SetBucketCORS(rules []CORSRule) error {
+	return o.st.SetBucketCORS(o.oc.Bucket, rules)
+}
+
+// GetBucketCORS 没有设置时返回空
+func (o *Wrapper) GetBucketCORS() ([]CORSRule, error) {
+	rules, err := o.st.GetBucketCORS(o.oc.Bucket)
+	if isNoSuchConfig(err) {
+		return nil, nil
+	}
+	return rules, err
+}
+
+// SetBucketReferer 设置防盗链，只有阿里云支持，华为需要通过bucket策略配置
+func (o *Wrapper) SetBucketReferer(config RefererConfig) error {
+	return o.st.SetBucketReferer(o.oc.Bucket, config)
+}
+
+func (o *Wrapper) GetBucketReferer() (*RefererConfig, error) {
+	return o.st.GetBucketReferer(o.oc.Bucket)
+}
+
+func lifecycleStatus(rule LifecycleRule) string {
+	if rule.Disabled {
+		return "Disabled"
+	}
+	return "Enabled"
+}
@@ -0,0 +1,125 @@
+package oss
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+	"github.com/minio/minio-go/v6"
+)
+
+func TestMinioLifecycle(t *testing.T) {
+	rules := []LifecycleRule{
+		{ID: "tmp", Prefix: "tmp/", ExpireDays: 1, AbortMultipartDays: 2},
+		{ID: "log", Prefix: "log/", Disabled: true, ExpireDays: 30},
+	}
+	data, err := xml.Marshal(newMinioLifecycle(rules))
+	if err != nil {
+		t.Fatalf("marshal failed, err: %s", err)
+	}
+	if !strings.Contains(string(data), "<Filter><Prefix>tmp/</Prefix></Filter>") {
+		t.Errorf("unexpected xml: %s", data)
+	}
+	config := new(minioLifecycle)
+	if err = xml.Unmarshal(data, config); err != nil {
+		t.Fatalf("unmarshal failed, err: %s", err)
+	}
+	if got := config.rules(); !reflect.DeepEqual(got, rules) {
+		t.Errorf("expected: %+v, got: %+v", rules, got)
+	}
+
+	// 旧格式的前缀直接写在Rule下
+	legacy := `<LifecycleConfiguration><Rule><Status>Enabled</Status><Prefix>old/</Prefix>` +
+		`<Expiration><Days>7</Days></Expiration></Rule></LifecycleConfiguration>`
+	config = new(minioLifecycle)
+	_ = xml.Unmarshal([]byte(legacy), config)
+	if got := config.rules(); len(got) != 1 || got[0].Prefix != "old/" || got[0].ExpireDays != 7 {
+		t.Errorf("unexpected legacy rules: %+v", got)
+	}
+}
+
+func TestMinioCreateBucketAcl(t *testing.T) {
+	// 公共权限需要通过bucket策略设置，不能静默忽略
+	if err := (&minStorager{}).CreateBucket("bucket", ACL_PUBLIC_READ); err != ErrNotSupported {
+		t.Errorf("public acl should not be supported, err: %v", err)
+	}
+}
+
+func TestObsStorageClass(t *testing.T) {
+	for _, class := range []StorageClass{StorageStandard, StorageIA, StorageArchive} {
+		if got := fromObsStorageClass(obsStorageClass(class)); got != class {
+			t.Errorf("expected: %s, got: %s", class, got)
+		}
+	}
+	if obsStorageClass(StorageIA) != obs.StorageClassWarm {
+		t.Error("IA should be WARM on obs")
+	}
+}
+
+func TestObsSetObjectHeader(t *testing.T) {
+	var put http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("x-obs-meta-owner", "a")
+			return
+		}
+		put = r.Header.Clone()
+	}))
+	defer srv.Close()
+
+	// 非华为云的endpoint使用s3协议的请求头
+	client, err := obs.New("ak", "sk", srv.URL, obs.WithPathStyle(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &hwStorager{client: client}
+	// 只修改下载文件名，保留已有的类型和自定义元数据
+	if err = h.SetObjectMeta("bucket", "a.txt", buildMetadata([]Option{AttachFileName("b.txt")})); err != nil {
+		t.Fatalf("set object meta failed, err: %v", err)
+	}
+	if put.Get("Content-Type") != "text/plain" || put.Get("x-amz-meta-owner") != "a" ||
+		!strings.Contains(put.Get("Content-Disposition"), "b.txt") {
+		t.Errorf("metadata should be merged, header: %v", put)
+	}
+}
+
+func TestIsNoSuchConfig(t *testing.T) {
+	cases := []struct {
+		err      error
+		expected bool
+	}{
+		{oss.ServiceError{StatusCode: 404, Code: "NoSuchLifecycle"}, true},
+		{obs.ObsError{BaseModel: obs.BaseModel{StatusCode: 404}, Code: "NoSuchCORSConfiguration"}, true},
+		{minio.ErrorResponse{StatusCode: 404, Code: "NoSuchBucketPolicy"}, true},
+		{oss.ServiceError{StatusCode: 404, Code: "NoSuchBucket"}, false},
+		{minio.ErrorResponse{StatusCode: 403, Code: "AccessDenied"}, false},
+		{ErrNotSupported, false},
+	}
+	for _, c := range cases {
+		if got := isNoSuchConfig(c.err); got != c.expected {
+			t.Errorf("err: %v, expected: %v, got: %v", c.err, c.expected, got)
+		}
+	}
+}
+
+func TestBucketAdmin(t *testing.T) {
+	exist, err := ossHelper.IsBucketExist()
+	fmt.Println("bucket exist:", exist, "err:", err)
+	acl, err := ossHelper.GetBucketAcl()
+	fmt.Println("bucket acl:", acl, "err:", err)
+	rules, err := ossHelper.GetBucketLifecycle()
+	fmt.Printf("lifecycle: %+v, err: %v\n", rules, err)
+	cors, err := ossHelper.GetBucketCORS()
+	fmt.Printf("cors: %+v, err: %v\n", cors, err)
+	referer, err := ossHelper.GetBucketReferer()
+	fmt.Printf("referer: %+v, err: %v\n", referer, err)
+	policy, err := ossHelper.GetBucketPolicy()
+	fmt.Println("policy:", policy, "err:", err)
+}
@@ -0,0 +1,288 @@
+package cas
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/go_limit"
+	"github.com/hqmin9527/kits-go/src/logger"
+	"github.com/hqmin9527/kits-go/src/oss"
+)
+
+// 内容寻址存储：相同内容只保存一份
+// 1. 数据按SHA-256保存在blobs/ab/cd/{hash}，上传前先HEAD，已存在时跳过上传
+// 2. 引用保存在refs/{name}，内容为Ref的JSON，name到hash的映射
+// 3. GC删除没有被引用、并且超过grace的数据
+// 并发安全：复用已有数据时，如果数据的修改时间超过grace/2会重新上传刷新修改时间，
+// 只要一次上传在grace/2内完成，GC就不会删除正在被引用的数据
+
+const (
+	blobDir      = "blobs"
+	refDir       = "refs"
+	defaultGrace = 24 * time.Hour
+	goLimitCount = 20
+)
+
+// Ref 名称对应的数据
+type Ref struct {
+	Name         string    `json:"name"`
+	Hash         string    `json:"hash"` // SHA-256，小写16进制
+	Size         int64     `json:"size"`
+	Created      time.Time `json:"created"`
+	Deduplicated bool      `json:"-"` // 本次上传是否复用了已有的数据
+}
+
+// 用到的Wrapper方法，*oss.Wrapper实现了该接口
+type objectStore interface {
+	PutObject(key string, data []byte, options ...oss.Option) error
+	PutFile(key string, filePath string, options ...oss.Option) error
+	GetObject(key string, options ...oss.Option) ([]byte, error)
+	GetReader(key string, options ...oss.Option) (io.ReadCloser, error)
+	GetObjectMeta(key string, options ...oss.Option) (*oss.FileMeta, error)
+	SignFile(key string, expires time.Duration, options ...oss.Option) (string, error)
+	DeleteObject(key string) error
+	WalkObjects(prefix string, fn func(meta *oss.FileMeta) error) error
+}
+
+type Store struct {
+	blobs objectStore
+	refs  objectStore
+	grace time.Duration
+}
+
+// New 在w的作用域下保存数据和引用，grace<=0时为24小时
+func New(w *oss.Wrapper, grace time.Duration) *Store {
+	if grace <= 0 {
+		grace = defaultGrace
+	}
+	return &Store{blobs: w.Sub(blobDir), refs: w.Sub(refDir), grace: grace}
+}
+
+// PutObject 保存data并把name指向它，options只在第一次上传数据时生效
+func (s *Store) PutObject(name string, data []byte, options ...oss.Option) (*Ref, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	return s.put(name, hash, int64(len(data)), func() error {
+		return s.blobs.PutObject(BlobKey(hash), data, options...)
+	})
+}
+
+// PutFile 保存本地文件并把name指向它
+func (s *Store) PutFile(name string, localFile string, options ...oss.Option) (*Ref, error) {
+	fd, err := os.Open(localFile)
+	if err != nil {
+		return nil, err
+	}
+	hash, size, err := hashReader(fd)
+	_ = fd.Close()
+	if err != nil {
+		return nil, err
+	}
+	return s.put(name, hash, size, func() error {
+		return s.blobs.PutFile(BlobKey(hash), localFile, options...)
+	})
+}
+
+// Put 先写入临时文件计算hash，再按PutFile保存
+func (s *Store) Put(name string, r io.Reader, options ...oss.Option) (*Ref, error) {
+	tmp, err := os.CreateTemp("", "kits-cas-*")
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+	_, err = io.Copy(tmp, r)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.PutFile(name, tmp.Name(), options...)
+}
+
+// Stat 读取name的引用，不存在时返回oss的404错误
+func (s *Store) Stat(name string) (*Ref, error) {
+	data, err := s.refs.GetObject(name)
+	if err != nil {
+		return nil, err
+	}
+	ref := &Ref{}
+	if err = json.Unmarshal(data, ref); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// GetObject 读取name对应的数据
+func (s *Store) GetObject(name string) ([]byte, error) {
+	ref, err := s.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.blobs.GetObject(BlobKey(ref.Hash))
+}
+
+// GetReader 读取name对应的数据，使用完需要Close
+func (s *Store) GetReader(name string) (io.ReadCloser, error) {
+	ref, err := s.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return s.blobs.GetReader(BlobKey(ref.Hash))
+}
+
+// SignFile name对应数据的签名下载地址
+func (s *Store) SignFile(name string, expires time.Duration, options ...oss.Option) (string, error) {
+	ref, err := s.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	return s.blobs.SignFile(BlobKey(ref.Hash), expires, options...)
+}
+
+// Delete 只删除引用，数据由GC删除
+func (s *Store) Delete(name string) error {
+	return s.refs.DeleteObject(name)
+}
+
+// GC 删除没有被引用并且超过grace的数据，返回删除的数量
+func (s *Store) GC() (int, error) {
+	start := time.Now()
+	referenced, err := s.referenced()
+	if err != nil {
+		return 0, err
+	}
+
+	var mu sync.Mutex
+	count := 0
+	goLimit := go_limit.New(goLimitCount)
+	err = s.blobs.WalkObjects("", func(meta *oss.FileMeta) error {
+		hash := hashOfKey(meta.Key)
+		if referenced[hash] || start.Sub(meta.LastModified) < s.grace {
+			return nil
+		}
+		key := meta.Key
+		goLimit.RunError(func() error {
+			if err := s.blobs.DeleteObject(key); err != nil {
+				return err
+			}
+			mu.Lock()
+			count++
+			mu.Unlock()
+			return nil
+		})
+		return nil
+	})
+	goLimit.Wait()
+	if err == nil {
+		err = goLimit.FirstError()
+	}
+	return count, err
+}
+
+// Verify 校验数据的hash，用于检查存储是否损坏
+func (s *Store) Verify(hash string) error {
+	r, err := s.blobs.GetReader(BlobKey(hash))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	actual, _, err := hashReader(r)
+	if err != nil {
+		return err
+	}
+	if actual != hash {
+		return errors.New("cas blob hash mismatch: " + hash)
+	}
+	return nil
+}
+
+// 上传数据（已存在时跳过）后写入引用
+func (s *Store) put(name string, hash string, size int64, upload func() error) (*Ref, error) {
+	ref := &Ref{Name: name, Hash: hash, Size: size, Created: time.Now()}
+	meta, err := s.blobs.GetObjectMeta(BlobKey(hash))
+	switch {
+	case err == nil && time.Since(meta.LastModified) < s.grace/2:
+		ref.Deduplicated = true
+	case err == nil || oss.IsNotFound(err):
+		// 不存在，或者快要被GC删除时重新上传
+		if err = upload(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	data, err := json.Marshal(ref)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.refs.PutObject(name, data, oss.SetContentType("application/json")); err != nil {
+		return nil, err
+	}
+	return ref, nil
+}
+
+// 所有引用的hash
+func (s *Store) referenced() (map[string]bool, error) {
+	var mu sync.Mutex
+	res := make(map[string]bool)
+	goLimit := go_limit.New(goLimitCount)
+	err := s.refs.WalkObjects("", func(meta *oss.FileMeta) error {
+		name := meta.Key
+		goLimit.RunError(func() error {
+			ref, err := s.Stat(name)
+			if oss.IsNotFound(err) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			res[ref.Hash] = true
+			mu.Unlock()
+			return nil
+		})
+		return nil
+	})
+	goLimit.Wait()
+	if err == nil {
+		err = goLimit.FirstError()
+	}
+	if err != nil {
+		logger.Error("cas read refs failed, err: %s", err)
+		return nil, err
+	}
+	return res, nil
+}
+
+// BlobKey 数据在blobs下的key，按hash的前4个字符分两级目录
+func BlobKey(hash string) string {
+	if len(hash) < 4 {
+		return hash
+	}
+	return hash[:2] + "/" + hash[2:4] + "/" + hash
+}
+
+func hashOfKey(key string) string {
+	return key[strings.LastIndex(key, "/")+1:]
+}
+
+func hashReader(r io.Reader) (string, int64, error) {
+	h := sha256.New()
+	size, err := io.Copy(h, r)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
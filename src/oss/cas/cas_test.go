@@ -0,0 +1,175 @@
+package cas
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/oss"
+	"github.com/minio/minio-go/v6"
+)
+
+// 内存中的objectStore，记录上传次数
+type memStore struct {
+	mu      sync.Mutex
+	data    map[string][]byte
+	modTime map[string]time.Time
+	puts    int
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: map[string][]byte{}, modTime: map[string]time.Time{}}
+}
+
+var errNotFound = minio.ErrorResponse{StatusCode: http.StatusNotFound, Code: "NoSuchKey"}
+
+func (m *memStore) PutObject(key string, data []byte, _ ...oss.Option) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.data[key] = data
+	m.modTime[key] = time.Now()
+	m.puts++
+	return nil
+}
+
+func (m *memStore) PutFile(key string, filePath string, options ...oss.Option) error {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+	return m.PutObject(key, data, options...)
+}
+
+func (m *memStore) GetObject(key string, _ ...oss.Option) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.data[key]
+	if !ok {
+		return nil, errNotFound
+	}
+	return data, nil
+}
+
+func (m *memStore) GetReader(key string, options ...oss.Option) (io.ReadCloser, error) {
+	data, err := m.GetObject(key, options...)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(strings.NewReader(string(data))), nil
+}
+
+func (m *memStore) GetObjectMeta(key string, _ ...oss.Option) (*oss.FileMeta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.data[key]
+	if !ok {
+		return nil, errNotFound
+	}
+	return &oss.FileMeta{Key: key, Size: int64(len(data)), LastModified: m.modTime[key]}, nil
+}
+
+func (m *memStore) SignFile(key string, _ time.Duration, _ ...oss.Option) (string, error) {
+	return "http://example.com/" + key, nil
+}
+
+func (m *memStore) DeleteObject(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.data, key)
+	delete(m.modTime, key)
+	return nil
+}
+
+func (m *memStore) WalkObjects(prefix string, fn func(meta *oss.FileMeta) error) error {
+	m.mu.Lock()
+	keys := make([]string, 0, len(m.data))
+	for key := range m.data {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	m.mu.Unlock()
+	sort.Strings(keys)
+	for _, key := range keys {
+		meta, err := m.GetObjectMeta(key)
+		if err != nil {
+			continue
+		}
+		if err = fn(meta); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memStore) setModTime(key string, t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.modTime[key] = t
+}
+
+func TestBlobKey(t *testing.T) {
+	hash, size, err := hashReader(strings.NewReader("hello"))
+	if err != nil || size != 5 || hash != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Fatalf("unexpected hash: %s, size: %d, err: %v", hash, size, err)
+	}
+	key := BlobKey(hash)
+	if key != "2c/f2/"+hash || hashOfKey(key) != hash {
+		t.Errorf("unexpected blob key: %s", key)
+	}
+}
+
+func TestStorePut(t *testing.T) {
+	blobs := newMemStore()
+	s := &Store{blobs: blobs, refs: newMemStore(), grace: time.Hour}
+	a, err := s.PutObject("a", []byte("hello"))
+	if err != nil || a.Deduplicated || blobs.puts != 1 {
+		t.Fatalf("first put should upload, ref: %+v, puts: %d, err: %v", a, blobs.puts, err)
+	}
+	b, err := s.PutObject("b", []byte("hello"))
+	if err != nil || !b.Deduplicated || b.Hash != a.Hash || blobs.puts != 1 {
+		t.Errorf("same data should be skipped, ref: %+v, puts: %d, err: %v", b, blobs.puts, err)
+	}
+
+	// 超过grace/2时重新上传，刷新修改时间
+	key := BlobKey(a.Hash)
+	blobs.setModTime(key, time.Now().Add(-31*time.Minute))
+	c, err := s.PutObject("c", []byte("hello"))
+	if err != nil || c.Deduplicated || blobs.puts != 2 || time.Since(blobs.modTime[key]) > time.Minute {
+		t.Errorf("old blob should be refreshed, ref: %+v, puts: %d, err: %v", c, blobs.puts, err)
+	}
+	if data, err := s.GetObject("b"); err != nil || string(data) != "hello" {
+		t.Errorf("unexpected data: %s, err: %v", data, err)
+	}
+}
+
+func TestStoreGC(t *testing.T) {
+	blobs := newMemStore()
+	s := &Store{blobs: blobs, refs: newMemStore(), grace: time.Hour}
+	kept, _ := s.PutObject("kept", []byte("kept"))
+	deleted, _ := s.PutObject("deleted", []byte("deleted"))
+	fresh, _ := s.PutObject("fresh", []byte("fresh"))
+	_ = s.Delete("deleted")
+	_ = s.Delete("fresh")
+	old := time.Now().Add(-2 * time.Hour)
+	blobs.setModTime(BlobKey(kept.Hash), old)
+	blobs.setModTime(BlobKey(deleted.Hash), old)
+
+	n, err := s.GC()
+	if err != nil || n != 1 {
+		t.Fatalf("only the unreferenced old blob should be deleted, count: %d, err: %v", n, err)
+	}
+	for _, ref := range []*Ref{kept, fresh} {
+		if _, ok := blobs.data[BlobKey(ref.Hash)]; !ok {
+			t.Errorf("blob should be kept: %s", ref.Name)
+		}
+	}
+	if _, ok := blobs.data[BlobKey(deleted.Hash)]; ok {
+		t.Errorf("unreferenced blob should be deleted")
+	}
+}
@@ -0,0 +1,76 @@
+package oss
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// 阿里云文档中的示例：密钥aliyuncdnexp1234
+func TestCdnSigner(t *testing.T) {
+	cases := []struct {
+		authType string
+		rawUrl   string
+		at       time.Time // URL中的时间
+		expected string
+	}{
+		{CdnAuthAliA, "http://cdn.example.com/video/standard/1K.html", time.Unix(1444435200, 0),
+			"http://cdn.example.com/video/standard/1K.html?auth_key=1444435200-0-0-80cd3862d699b7118eed99103f2a3a4f"},
+		{CdnAuthAliB, "http://cdn.example.com/4/44/44c0909bcfc20a01afaf256ca99a8b8b.mp3",
+			time.Date(2015, 8, 15, 8, 0, 0, 0, cstZone),
+			"http://cdn.example.com/201508150800/9044548ef1527deadafa49a890a377f0/4/44/44c0909bcfc20a01afaf256ca99a8b8b.mp3"},
+		{CdnAuthAliC, "http://cdn.example.com/test.flv", time.Unix(0x55CE8100, 0),
+			"http://cdn.example.com/a37fa50a5fb8f71214b1e7c95ec7a1bd/55CE8100/test.flv"},
+	}
+	for _, c := range cases {
+		signer, err := NewCdnSigner(c.authType, "aliyuncdnexp1234", 0)
+		if err != nil {
+			t.Fatalf("create signer failed, err: %s", err)
+		}
+		s := signer.(*cdnSigner)
+		// URL中的时间 = 当前时间 + expires - ttl
+		s.now = func() time.Time { return c.at.Add(defaultCdnAuthTtl - time.Hour) }
+		s.nonce = func() string { return "0" }
+		got, err := s.Sign(c.rawUrl, time.Hour)
+		if err != nil || got != c.expected {
+			t.Errorf("auth type: %s, expected: %s, got: %s, err: %v", c.authType, c.expected, got, err)
+		}
+	}
+
+	if _, err := NewCdnSigner("unknown", "key", 0); err == nil {
+		t.Error("unknown auth type should fail")
+	}
+}
+
+func TestEscapeDownloadUrlExpires(t *testing.T) {
+	signer, _ := NewCdnSigner(CdnAuthHmac, "secret", 0)
+	c := &Config{Provider: Aliyun, Protocol: "https", Bucket: "bucket", Endpoint: "oss-cn-hangzhou.aliyuncs.com"}
+	w := &Wrapper{oc: c, cdn: signer}
+	if _, err := w.EscapeDownloadUrlExpires("a.txt", time.Minute); err == nil {
+		t.Error("download url without cdn domain should fail")
+	}
+	c.DownloadDomain = "dl.example.com"
+	signed, err := w.Sub("dir").EscapeDownloadUrlExpires("a b.txt", time.Minute)
+	u, _ := url.Parse(signed)
+	if err != nil || u.Host != "dl.example.com" || u.Path != "/dir/a+b.txt" || !VerifyCdnHmac("secret", u, time.Now()) {
+		t.Errorf("download url should use cdn domain: %s, err: %v", signed, err)
+	}
+}
+
+func TestCdnHmac(t *testing.T) {
+	signer, _ := NewCdnSigner(CdnAuthHmac, "secret", 0)
+	signed, err := signer.Sign("https://cdn.example.com/a%20b.png?x-oss-process=image/resize,w_100", time.Minute)
+	if err != nil {
+		t.Fatalf("sign failed, err: %s", err)
+	}
+	u, _ := url.Parse(signed)
+	if u.Query().Get("x-oss-process") != "image/resize,w_100" {
+		t.Errorf("query should be kept: %s", signed)
+	}
+	if !VerifyCdnHmac("secret", u, time.Now()) {
+		t.Errorf("signature should be valid: %s", signed)
+	}
+	if VerifyCdnHmac("other", u, time.Now()) || VerifyCdnHmac("secret", u, time.Now().Add(2*time.Minute)) {
+		t.Error("wrong key or expired url should be invalid")
+	}
+}
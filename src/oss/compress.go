@@ -0,0 +1,168 @@
+package oss
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/hqmin9527/kits-go/src/safe"
+)
+
+// 透明压缩：上传时gzip压缩，设置ContentEncoding为gzip并用自定义元数据标记，读取时只解压有标记的文件
+// 其他方式上传的文件即使ContentEncoding为gzip也原样返回
+// 1. 已压缩的类型（图片、音视频、压缩包等）不压缩，类型按ContentType、扩展名、前512字节依次判断
+// 2. 没有设置ContentType时设置为判断出的类型，避免平台按压缩后的数据识别
+// 3. GetRange、ObjectReader、签名下载地址返回保存的数据，由客户端按Content-Encoding解压；FS解压后返回
+
+const (
+	encodingGzip     = "gzip"
+	compressSniffLen = 512
+	compressMetaKey  = "kits-compress" // Compress压缩的文件的标记，值为压缩算法
+)
+
+// 已压缩的类型
+var compressedTypes = map[string]bool{
+	"application/zip":              true,
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/zstd":             true,
+	"application/pdf":              true,
+	"font/woff":                    true,
+	"font/woff2":                   true,
+}
+
+// Compress 上传时gzip压缩，已压缩的类型和已设置ContentEncoding时不压缩，用于PutObject、PutFile、PutReader
+// PutFile压缩时流式上传，不使用分片上传
+var Compress Option = func(m *Metadata) {
+	m.compress = true
+}
+
+// RawContent 读取Compress压缩的文件时不解压，返回保存的数据，用于GetObject、GetFile、GetReader
+var RawContent Option = func(m *Metadata) {
+	m.raw = true
+}
+
+// 判断是否压缩，压缩时设置ContentType和ContentEncoding
+func (m *Metadata) prepareCompress(key string, head []byte) bool {
+	if !m.compress || m.ContentEncoding != "" {
+		return false
+	}
+	contentType := m.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(path.Ext(key))
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(head)
+	}
+	if isCompressedType(contentType) {
+		return false
+	}
+	m.ContentType = contentType
+	m.ContentEncoding = encodingGzip
+	// 复制一份，不修改调用方传入的map
+	userMeta := make(map[string]string, len(m.UserMeta)+1)
+	for k, v := range m.UserMeta {
+		userMeta[k] = v
+	}
+	userMeta[compressMetaKey] = encodingGzip
+	m.UserMeta = userMeta
+	return true
+}
+
+// 是否为Compress压缩的文件
+func (m *Metadata) compressed() bool {
+	return strings.EqualFold(m.ContentEncoding, encodingGzip) && m.UserMeta[compressMetaKey] == encodingGzip
+}
+
+func isCompressedType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	if compressedTypes[mediaType] {
+		return true
+	}
+	switch {
+	case mediaType == "image/svg+xml" || mediaType == "image/bmp":
+		return false
+	case strings.HasPrefix(mediaType, "image/"), strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "audio/"):
+		return true
+	case strings.HasPrefix(mediaType, "application/vnd.openxmlformats-officedocument."):
+		// docx、xlsx、pptx为zip格式
+		return true
+	}
+	return false
+}
+
+func compressData(key string, data []byte, m *Metadata) ([]byte, error) {
+	if !m.prepareCompress(key, data[:min(len(data), compressSniffLen)]) {
+		return data, nil
+	}
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 读取前512字节用于判断类型，返回的reader包含这部分数据
+func peekHead(r io.Reader) (*bufio.Reader, []byte) {
+	br := bufio.NewReaderSize(r, compressSniffLen)
+	head, _ := br.Peek(compressSniffLen)
+	return br, head
+}
+
+// 边压缩边上传，m已经过prepareCompress
+func (o *Wrapper) putCompressed(key string, r io.Reader, m *Metadata) error {
+	pr, pw := io.Pipe()
+	go safe.Safego(func() {
+		gw := gzip.NewWriter(pw)
+		_, err := io.Copy(gw, r)
+		if closeErr := gw.Close(); err == nil {
+			err = closeErr
+		}
+		_ = pw.CloseWithError(err)
+	}, "oss compress")
+	err := o.st.PutReaderWithMeta(o.oc.Bucket, o.fullKey(key), pr, m)
+	// 上传失败时停止压缩
+	_ = pr.Close()
+	return preconditionError(err)
+}
+
+// Compress压缩的文件解压，其他文件原样返回
+func decodeReader(r io.ReadCloser, meta *FileMeta) (io.ReadCloser, error) {
+	if !meta.compressed() {
+		return r, nil
+	}
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		_ = r.Close()
+		return nil, err
+	}
+	return &gzipReadCloser{Reader: gr, body: r}, nil
+}
+
+type gzipReadCloser struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (g *gzipReadCloser) Close() error {
+	_ = g.Reader.Close()
+	return g.body.Close()
+}
@@ -0,0 +1,115 @@
+package oss
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	st := &memStorager{objects: map[string][]byte{}}
+	w := (&Wrapper{st: st, oc: &Config{Bucket: "bucket"}}).Sub("dir")
+	data := []byte(strings.Repeat(`{"level":"info","msg":"hello"}`+"\n", 100))
+
+	if err := w.PutObject("a.json", data, Compress); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.objects["dir/a.json"]) >= len(data)/5 || st.encs["dir/a.json"] != encodingGzip {
+		t.Errorf("object should be compressed, size: %d, encoding: %s", len(st.objects["dir/a.json"]), st.encs["dir/a.json"])
+	}
+	if res, err := w.GetObject("a.json"); err != nil || !bytes.Equal(res, data) {
+		t.Errorf("object should be decompressed, err: %v", err)
+	}
+	if res, _ := w.GetObject("a.json", RawContent); !bytes.Equal(res, st.objects["dir/a.json"]) {
+		t.Errorf("raw content should not be decompressed")
+	}
+	// FS的Open和ReadFile都返回解压后的数据
+	if f, err := w.FS().Open("a.json"); err == nil {
+		opened, _ := io.ReadAll(f)
+		info, _ := f.Stat()
+		_ = f.Close()
+		read, err := w.FS().ReadFile("a.json")
+		if err != nil || !bytes.Equal(opened, data) || !bytes.Equal(read, data) || info.Size() != int64(len(data)) {
+			t.Errorf("fs should return the decompressed data, err: %v", err)
+		}
+	} else {
+		t.Errorf("open failed, err: %v", err)
+	}
+
+	if err := w.PutReader("b.log", bytes.NewReader(data), Compress); err != nil {
+		t.Fatal(err)
+	}
+	r, err := w.GetReader("b.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, _ := io.ReadAll(r)
+	_ = r.Close()
+	if st.encs["dir/b.log"] != encodingGzip || !bytes.Equal(res, data) {
+		t.Errorf("reader should be compressed and decompressed, encoding: %s", st.encs["dir/b.log"])
+	}
+
+	localFile := filepath.Join(t.TempDir(), "c.txt")
+	if err = w.GetFile("a.json", localFile); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ = os.ReadFile(localFile); !bytes.Equal(res, data) {
+		t.Errorf("file should be decompressed")
+	}
+
+	// 不是Compress上传的文件，即使ContentEncoding为gzip也原样返回
+	gz := st.objects["dir/a.json"]
+	if err = w.PutObject("d.json", gz, func(m *Metadata) { m.ContentEncoding = encodingGzip }); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = w.GetObject("d.json"); err != nil || !bytes.Equal(res, gz) || st.users["dir/a.json"][compressMetaKey] != encodingGzip {
+		t.Errorf("only objects written with Compress should be decompressed, err: %v", err)
+	}
+
+	// 已压缩的类型不压缩
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	for _, key := range []string{"c.png", "c"} {
+		if err = w.PutObject(key, png, Compress); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := st.encs["dir/"+key]; ok || !bytes.Equal(st.objects["dir/"+key], png) {
+			t.Errorf("compressed type should be skipped, key: %s", key)
+		}
+	}
+}
+
+func TestIsCompressedType(t *testing.T) {
+	cases := map[string]bool{
+		"application/json":          false,
+		"text/plain; charset=utf-8": false,
+		"image/svg+xml":             false,
+		"image/jpeg":                true,
+		"video/mp4":                 true,
+		"application/zip":           true,
+		"application/vnd.openxmlformats-officedocument.wordprocessingml.document": true,
+	}
+	for contentType, want := range cases {
+		if got := isCompressedType(contentType); got != want {
+			t.Errorf("isCompressedType(%s) = %v, want %v", contentType, got, want)
+		}
+	}
+}
+
+func TestCompressRemote(t *testing.T) {
+	key := joinPath(testDir, "compress.json")
+	if err := ossHelper.PutObject(key, []byte(strings.Repeat(`{"a":1}`, 1000)), Compress); err != nil {
+		fmt.Println("put err:", err)
+		return
+	}
+	meta, err := ossHelper.GetObjectMeta(key)
+	if err != nil {
+		fmt.Println("get meta err:", err)
+		return
+	}
+	data, err := ossHelper.GetObject(key)
+	fmt.Println("compress:", meta.Size, meta.ContentEncoding, len(data), err)
+}
@@ -0,0 +1,23 @@
+package oss
+
+// 条件写入：把oss当作简单的状态存储时，用于避免多个服务互相覆盖
+// 典型用法：GetObjectMeta获取ETag -> 修改 -> PutIfMatch，失败时重新读取后再试
+// 阿里云使用x-oss-forbid-overwrite和If-Match，华为云和minio使用If-None-Match和If-Match
+// 旧版本的minio删除时不支持If-Match，DeleteIfMatch先HEAD比较ETag，两次请求之间的修改无法检测
+
+// PutIfAbsent 文件不存在时才上传
+func (o *Wrapper) PutIfAbsent(key string, data []byte, options ...Option) error {
+	return o.PutObject(key, data, append(options, NoOverwrite)...)
+}
+
+// PutIfMatch 文件的ETag与etag一致时才上传（compare-and-swap）
+func (o *Wrapper) PutIfMatch(key string, data []byte, etag string, options ...Option) error {
+	return o.PutObject(key, data, append(options, withIfMatch(etag))...)
+}
+
+// DeleteIfMatch 文件的ETag与etag一致时才删除
+func (o *Wrapper) DeleteIfMatch(key string, etag string) error {
+	checkKey(key)
+	err := o.st.DeleteObjectIfMatch(o.oc.Bucket, o.fullKey(key), QuoteETag(etag))
+	return preconditionError(err)
+}
@@ -0,0 +1,116 @@
+package oss
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+	"github.com/minio/minio-go/v6"
+	"github.com/pkg/errors"
+)
+
+func TestQuoteETag(t *testing.T) {
+	cases := map[string]string{
+		"":          "",
+		"abc":       "\"abc\"",
+		"\"abc\"":   "\"abc\"",
+		"W/\"abc\"": "W/\"abc\"",
+		"abc-2":     "\"abc-2\"",
+	}
+	for etag, expected := range cases {
+		if got := QuoteETag(etag); got != expected {
+			t.Errorf("etag: %s, expected: %s, got: %s", etag, expected, got)
+		}
+	}
+}
+
+func TestPreconditionError(t *testing.T) {
+	failed := []error{
+		oss.ServiceError{StatusCode: http.StatusPreconditionFailed},
+		oss.ServiceError{StatusCode: http.StatusConflict, Code: "FileAlreadyExists"},
+		errors.Wrap(obs.ObsError{BaseModel: obs.BaseModel{StatusCode: http.StatusPreconditionFailed}}, "put"),
+		minio.ErrorResponse{StatusCode: http.StatusPreconditionFailed, Code: "PreconditionFailed"},
+	}
+	for _, err := range failed {
+		if got := preconditionError(err); got != ErrPreconditionFailed {
+			t.Errorf("expected ErrPreconditionFailed, got: %v", got)
+		}
+	}
+	other := oss.ServiceError{StatusCode: http.StatusNotFound, Code: "NoSuchKey"}
+	if got := preconditionError(other); got == ErrPreconditionFailed {
+		t.Error("not found should not be precondition failed")
+	}
+	if preconditionError(nil) != nil {
+		t.Error("nil should stay nil")
+	}
+}
+
+func TestMinioConditionHeader(t *testing.T) {
+	var mu sync.Mutex
+	var headers []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			_, _ = w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></LocationConstraint>`))
+			return
+		}
+		mu.Lock()
+		headers = append(headers, r.Method+" "+r.Header.Get("If-None-Match")+r.Header.Get("If-Match"))
+		mu.Unlock()
+		w.Header().Set("ETag", `"etag"`)
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	st, err := newMinioStorager(&Config{Endpoint: strings.TrimPrefix(srv.URL, "http://"), AccessKeyId: "ak", AccessKeySecret: "sk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = st.PutObjectWithMeta("bucket", "a", []byte("a"), buildMetadata([]Option{NoOverwrite}))
+	_ = st.PutObjectWithMeta("bucket", "a", []byte("a"), buildMetadata(nil))
+	_ = st.PutObjectWithMeta("bucket", "a", []byte("a"), buildMetadata([]Option{withIfMatch("etag")}))
+	if err = st.DeleteObjectIfMatch("bucket", "a", `"etag"`); err != nil {
+		t.Errorf("delete if match failed, err: %v", err)
+	}
+	// ETag不一致时不发送DELETE
+	if err = st.DeleteObjectIfMatch("bucket", "a", `"other"`); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("mismatched etag should fail, err: %v", err)
+	}
+	expected := fmt.Sprint([]string{"PUT *", "PUT ", `PUT "etag"`, "HEAD ", `DELETE "etag"`, "HEAD "})
+	if fmt.Sprint(headers) != expected {
+		t.Errorf("expected: %s, got: %v", expected, headers)
+	}
+}
+
+func TestPutIfAbsentAndMatch(t *testing.T) {
+	ossPath := path.Join(testDir, "state.json")
+	_ = ossHelper.DeleteObject(ossPath)
+
+	err := ossHelper.PutIfAbsent(ossPath, []byte(`{"version":1}`))
+	fmt.Println("first put if absent err:", err)
+	err = ossHelper.PutIfAbsent(ossPath, []byte(`{"version":1}`))
+	fmt.Println("second put if absent err:", err, err == ErrPreconditionFailed)
+
+	meta, err := ossHelper.GetObjectMeta(ossPath)
+	if err != nil {
+		fmt.Println("get object meta err:", err)
+		return
+	}
+	err = ossHelper.PutIfMatch(ossPath, []byte(`{"version":2}`), meta.ETag)
+	fmt.Println("put if match err:", err)
+	// ETag已经变化，再次使用旧的ETag应该失败
+	err = ossHelper.PutIfMatch(ossPath, []byte(`{"version":3}`), meta.ETag)
+	fmt.Println("put if stale match err:", err, err == ErrPreconditionFailed)
+
+	err = ossHelper.CopyObject(ossPath, ossPath+".bak", NoOverwrite)
+	fmt.Println("copy no overwrite err:", err)
+	err = ossHelper.DeleteIfMatch(ossPath, meta.ETag)
+	fmt.Println("delete if stale match err:", err, err == ErrPreconditionFailed)
+}
@@ -1,9 +1,13 @@
 package oss
 
 import (
+	"crypto/md5"
+	"encoding/base64"
 	"encoding/json"
+	"net/http"
 	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
@@ -36,6 +40,8 @@ type Config struct {
 	Endpoint        string `json:"endpoint"`        // 访问域名
 	EndpointInner   string `json:"endpointInner"`   // 内网访问域名
 	StsEndpoint     string `json:"stsEndpoint"`     // 临时授权的访问域名
+	StsAccessKey    string `json:"stsAccessKey"`    // MinIO签发临时授权的账号，为空时不支持临时授权
+	StsSecretKey    string `json:"stsSecretKey"`    // MinIO签发临时授权的账号密钥
 	Internal        bool   `json:"internal"`        // 是否走内网
 	Host            string `json:"host"`            // 加速域名（如果没有设置为Bucket.Endpoint）
 	Protocol        string `json:"protocol"`        // 协议
@@ -44,6 +50,9 @@ type Config struct {
 	TmpRoot         string `json:"tmpRoot"`         // 临时文件的根目录
 	BaseDir         string `json:"baseDir"`         // u3服务文件都在该目录下
 	Prefix          string `json:"prefix"`          // 共同前缀
+	CdnAuthType     string `json:"cdnAuthType"`     // CDN鉴权方式：ali-a、ali-b、ali-c、hw、hmac，为空表示不鉴权
+	CdnAuthKey      string `json:"cdnAuthKey"`      // CDN鉴权密钥
+	CdnAuthTtl      int    `json:"cdnAuthTtl"`      // CDN控制台配置的鉴权有效时长（秒），默认1800
 }
 
 func (c *Config) MarshalJSON() ([]byte, error) {
@@ -52,10 +61,14 @@ func (c *Config) MarshalJSON() ([]byte, error) {
 		*alias
 		AccessKeyId     string `json:"accessKeyId"`
 		AccessKeySecret string `json:"accessKeySecret"`
+		CdnAuthKey      string `json:"cdnAuthKey"`
+		StsSecretKey    string `json:"stsSecretKey"`
 	}{
 		alias:           (*alias)(c),
 		AccessKeyId:     utils.MaskString(c.AccessKeyId),
 		AccessKeySecret: utils.MaskString(c.AccessKeySecret),
+		CdnAuthKey:      utils.MaskString(c.CdnAuthKey),
+		StsSecretKey:    utils.MaskString(c.StsSecretKey),
 	})
 }
 
@@ -84,10 +97,14 @@ func (t *StsTokenInfo) String() string {
 }
 
 type FileMeta struct {
-	Key          string
-	Size         int64
-	ETag         string
-	LastModified time.Time
+	Key            string
+	Size           int64
+	ETag           string
+	LastModified   time.Time
+	VersionID      string       // 开启多版本后的版本ID
+	IsLatest       bool         // 只在ListObjectVersions中有效
+	IsDeleteMarker bool         // 删除标记，只在ListObjectVersions中出现
+	StorageClass   StorageClass // 存储类型，只在列举时返回
 	Metadata
 }
 
@@ -99,19 +116,113 @@ const (
 	ACL_PUBLIC_READ_WRITE ACL = "public-read-write" // 2021.1.8当前测试华为public-read-write设置未生效
 )
 
+// bucket的多版本状态，从未开启过时为空
+const (
+	VersioningEnabled   = "Enabled"
+	VersioningSuspended = "Suspended"
+)
+
+// 服务端加密方式
+const (
+	SSEAes256   = "AES256" // 云厂商管理的密钥：SSE-OSS、SSE-OBS、SSE-S3
+	SSEKms      = "KMS"    // KMS管理的密钥
+	SSECustomer = "SSE-C"  // 客户提供的密钥
+)
+
 type Metadata struct {
 	ContentType        string
 	ContentEncoding    string
 	ContentDisposition string
 	Acl                ACL
+	UserMeta           map[string]string // 自定义元数据（x-oss-meta-*、x-obs-meta-*、x-amz-meta-*），key统一为小写
+	SSE                string            // 服务端加密方式：SSEAes256、SSEKms、SSECustomer
+	SSEKeyID           string            // SSEKms时的KMS密钥ID
+
+	sseCustomerKey []byte // SSE-C的密钥（32字节），只用于请求，不会返回
+
+	versionID string        // 读取、复制源文件的版本ID，只用于请求
+	process   *ImageProcess // 签名地址的图片处理参数，只用于请求
+	viaCdn    bool          // 通过CDN签名，只用于请求
+	srcSize   int64         // 复制源文件的大小，用于判断是否分片复制，0表示未知
+
+	responseHeader map[string]string // 签名下载地址覆盖的响应头，key为查询参数名（如response-content-type），只用于请求
+
+	// 条件写入，只用于请求，条件不满足时返回ErrPreconditionFailed
+	forbidOverwrite bool   // 目标文件已存在时失败
+	ifMatch         string // 目标文件的ETag不一致时失败
+
+	fetch *fetchConfig // PutFromURL的抓取参数，只用于请求
+
+	// ExtractArchive的大小上限，只用于请求，0表示默认值，<0表示不限制
+	maxArchiveSize   int64 // 压缩包的大小
+	maxExtractedSize int64 // 解压后所有文件的总大小
+
+	compress bool // 上传时gzip压缩，只用于请求
+	raw      bool // 读取时不按ContentEncoding解压，只用于请求
 }
 
 func (m *Metadata) HasAcl() bool {
 	return m.Acl != ""
 }
 
+// SSE-C的密钥及其MD5（均为base64编码）
+func (m *Metadata) sseCustomerKeyBase64() (string, string) {
+	sum := md5.Sum(m.sseCustomerKey)
+	return base64.StdEncoding.EncodeToString(m.sseCustomerKey), base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func (m *Metadata) hasSSECustomerKey() bool {
+	return m != nil && len(m.sseCustomerKey) > 0
+}
+
+func (m *Metadata) hasCondition() bool {
+	return m != nil && (m.forbidOverwrite || m.ifMatch != "")
+}
+
+func (m *Metadata) hasVersionID() bool {
+	return m != nil && m.versionID != ""
+}
+
+func (m *Metadata) hasResponseHeader() bool {
+	return m != nil && len(m.responseHeader) > 0
+}
+
 func (m *Metadata) HasHeader() bool {
-	return m.ContentType != "" || m.ContentEncoding != "" || m.ContentDisposition != ""
+	return m.ContentType != "" || m.ContentEncoding != "" || m.ContentDisposition != "" || len(m.UserMeta) > 0
+}
+
+// 用override中非空的字段覆盖base，自定义元数据合并
+func mergeMetadata(base Metadata, override *Metadata) Metadata {
+	res := base
+	if override.ContentType != "" {
+		res.ContentType = override.ContentType
+	}
+	if override.ContentEncoding != "" {
+		res.ContentEncoding = override.ContentEncoding
+	}
+	if override.ContentDisposition != "" {
+		res.ContentDisposition = override.ContentDisposition
+	}
+	if override.Acl != "" {
+		res.Acl = override.Acl
+	}
+	if override.SSE != "" {
+		res.SSE = override.SSE
+		res.SSEKeyID = override.SSEKeyID
+	}
+	if len(override.sseCustomerKey) > 0 {
+		res.sseCustomerKey = override.sseCustomerKey
+	}
+	if len(override.UserMeta) > 0 {
+		res.UserMeta = make(map[string]string, len(base.UserMeta)+len(override.UserMeta))
+		for k, v := range base.UserMeta {
+			res.UserMeta[k] = v
+		}
+		for k, v := range override.UserMeta {
+			res.UserMeta[k] = v
+		}
+	}
+	return res
 }
 
 func buildMetadata(ops []Option) *Metadata {
@@ -135,15 +246,210 @@ func setAcl(acl ACL) Option {
 var AclPublicRead = setAcl(ACL_PUBLIC_READ)
 var AclPrivate = setAcl(ACL_PRIVATE)
 
+// SSEManaged 使用云厂商管理的密钥进行服务端加密
+var SSEManaged Option = func(m *Metadata) {
+	m.SSE = SSEAes256
+	m.SSEKeyID = ""
+}
+
+// SSEWithKms 使用KMS管理的密钥进行服务端加密，keyID为空时使用默认的KMS密钥
+var SSEWithKms = func(keyID string) Option {
+	return func(m *Metadata) {
+		m.SSE = SSEKms
+		m.SSEKeyID = keyID
+	}
+}
+
+// SSEWithCustomerKey 使用客户提供的密钥（32字节）进行服务端加密
+// 上传、复制、下载、获取元数据时都需要传入相同的密钥，复制时源文件和目标文件使用同一个密钥
+var SSEWithCustomerKey = func(key []byte) Option {
+	return func(m *Metadata) {
+		m.SSE = SSECustomer
+		m.SSEKeyID = ""
+		m.sseCustomerKey = key
+	}
+}
+
+// WithVersionID 读取指定版本，用于GetObject、GetFile、GetReader、GetObjectMeta，以及CopyObject的源文件
+var WithVersionID = func(versionID string) Option {
+	return func(m *Metadata) {
+		m.versionID = versionID
+	}
+}
+
+// 列举时已经知道源文件大小，复制时不需要再获取
+func withSrcSize(size int64) Option {
+	return func(m *Metadata) {
+		m.srcSize = size
+	}
+}
+
+// NoOverwrite 目标文件已存在时不覆盖，返回ErrPreconditionFailed，可用于上传和复制
+var NoOverwrite Option = func(m *Metadata) {
+	m.forbidOverwrite = true
+	m.ifMatch = ""
+}
+
+// 去掉条件写入，用于主存储写入成功后覆盖备份
+var withoutCondition Option = func(m *Metadata) {
+	m.forbidOverwrite = false
+	m.ifMatch = ""
+}
+
+// 目标文件的ETag与etag一致时才写入
+func withIfMatch(etag string) Option {
+	return func(m *Metadata) {
+		m.ifMatch = QuoteETag(etag)
+		m.forbidOverwrite = false
+	}
+}
+
+var SetContentType = func(contentType string) Option {
+	return func(m *Metadata) {
+		m.ContentType = contentType
+	}
+}
+
+// AddUserMeta 添加自定义元数据，key会统一转为小写
+var AddUserMeta = func(key string, value string) Option {
+	return func(m *Metadata) {
+		if m.UserMeta == nil {
+			m.UserMeta = make(map[string]string)
+		}
+		m.UserMeta[strings.ToLower(key)] = value
+	}
+}
+
 var AttachFileName = func(fileName string) Option {
 	return func(m *Metadata) {
-		fileName = url.PathEscape(fileName)
-		// oss会忽略开头的“.”，如果只有扩展名，添加文件名为"新文件"
-		ext := strings.TrimLeft(filepath.Ext(fileName), ".")
-		if ext != "" && strings.TrimLeft(fileName, ".") == ext {
-			fileName = url.PathEscape("新文件.") + ext
+		m.ContentDisposition = contentDisposition("attachment", fileName)
+	}
+}
+
+// Content-Disposition的值，文件名使用RFC 5987编码，fileName为空时只返回dispositionType
+func contentDisposition(dispositionType string, fileName string) string {
+	if fileName == "" {
+		return dispositionType
+	}
+	fileName = url.PathEscape(fileName)
+	// oss会忽略开头的“.”，如果只有扩展名，添加文件名为"新文件"
+	ext := strings.TrimLeft(filepath.Ext(fileName), ".")
+	if ext != "" && strings.TrimLeft(fileName, ".") == ext {
+		fileName = url.PathEscape("新文件.") + ext
+	}
+	return dispositionType + ";" + "filename=\"" + fileName + "\";" +
+		"filename*=utf-8''" + fileName
+}
+
+// 签名下载地址覆盖的响应头对应的查询参数，各平台相同
+const (
+	responseContentDisposition = "response-content-disposition"
+	responseContentType        = "response-content-type"
+	responseCacheControl       = "response-cache-control"
+)
+
+func setResponseHeader(name string, value string) Option {
+	return func(m *Metadata) {
+		if m.responseHeader == nil {
+			m.responseHeader = make(map[string]string)
+		}
+		m.responseHeader[name] = value
+	}
+}
+
+// ResponseAttachment 用于SignFile：以fileName下载，不修改文件的元数据
+var ResponseAttachment = func(fileName string) Option {
+	return setResponseHeader(responseContentDisposition, contentDisposition("attachment", fileName))
+}
+
+// ResponseInline 用于SignFile：在浏览器中直接打开，fileName可以为空
+var ResponseInline = func(fileName string) Option {
+	return setResponseHeader(responseContentDisposition, contentDisposition("inline", fileName))
+}
+
+// ResponseContentType 用于SignFile：覆盖响应的Content-Type
+var ResponseContentType = func(contentType string) Option {
+	return setResponseHeader(responseContentType, contentType)
+}
+
+// ResponseCacheControl 用于SignFile：覆盖响应的Cache-Control
+var ResponseCacheControl = func(cacheControl string) Option {
+	return setResponseHeader(responseCacheControl, cacheControl)
+}
+
+// 把偏移量和长度转为Range头的值（不带"bytes="），length<0表示读到结尾，返回空表示读取整个文件
+func formatRange(offset int64, length int64) string {
+	if offset <= 0 && length < 0 {
+		return ""
+	}
+	if length < 0 {
+		return strconv.FormatInt(offset, 10) + "-"
+	}
+	return strconv.FormatInt(offset, 10) + "-" + strconv.FormatInt(offset+length-1, 10)
+}
+
+// 从Content-Range头（如：bytes 0-99/1234）中解析文件总大小，解析失败返回-1
+func parseContentRangeSize(contentRange string) int64 {
+	index := strings.LastIndex(contentRange, "/")
+	if index < 0 {
+		return -1
+	}
+	size, err := strconv.ParseInt(contentRange[index+1:], 10, 64)
+	if err != nil {
+		return -1
+	}
+	return size
+}
+
+// 从响应头中提取自定义元数据，prefix如：X-Oss-Meta-
+func headerToUserMeta(header http.Header, prefix string) map[string]string {
+	var res map[string]string
+	prefix = strings.ToLower(prefix)
+	for k, v := range header {
+		lk := strings.ToLower(k)
+		if !strings.HasPrefix(lk, prefix) || len(v) == 0 {
+			continue
 		}
-		m.ContentDisposition = "attachment;" + "filename=\"" + fileName + "\";" +
-			"filename*=utf-8''" + fileName
+		if res == nil {
+			res = make(map[string]string)
+		}
+		res[strings.TrimPrefix(lk, prefix)] = v[0]
+	}
+	return res
+}
+
+// 统一各平台返回的服务端加密方式，customerAlgorithm不为空表示SSE-C
+func normalizeSSE(sse string, customerAlgorithm string) string {
+	if customerAlgorithm != "" {
+		return SSECustomer
+	}
+	switch strings.ToLower(sse) {
+	case "":
+		return ""
+	case "aes256":
+		return SSEAes256
+	default:
+		// KMS、kms、aws:kms、SM4等
+		return SSEKms
+	}
+}
+
+// QuoteETag 给ETag加上双引号，If-Match和ETag头中的ETag需要带双引号，minio列举返回的ETag不带双引号
+func QuoteETag(etag string) string {
+	if etag == "" || strings.HasPrefix(etag, "\"") || strings.HasPrefix(etag, "W/") {
+		return etag
+	}
+	return "\"" + etag + "\""
+}
+
+// 统一自定义元数据的key为小写
+func lowerUserMeta(meta map[string]string) map[string]string {
+	if len(meta) == 0 {
+		return nil
+	}
+	res := make(map[string]string, len(meta))
+	for k, v := range meta {
+		res[strings.ToLower(k)] = v
 	}
+	return res
 }
@@ -0,0 +1,295 @@
+package oss
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/logger"
+	"github.com/hqmin9527/kits-go/src/lru_cache"
+	"golang.org/x/sync/singleflight"
+)
+
+// 本地磁盘缓存：下载过的文件保存在本地目录，适合反复读取同一批文件（模板、字体等）的场景
+// 1. 缓存总大小不超过maxBytes，超出时按LRU淘汰，超过maxBytes的文件不缓存，直接读取OSS
+// 2. 缓存超过ttl后使用HEAD请求校验ETag（没有ETag时比较LastModified和大小），未变化时不重新下载
+// 3. 同一个key并发未命中时只下载一次
+// 缓存索引只保存在内存中，目录需要独占，创建时会清理目录中遗留的缓存文件
+
+const (
+	diskCacheMaxEntries = 10000 // 缓存文件数量上限
+	diskCacheFileExt    = ".cache"
+	diskCacheTmpExt     = ".tmp"
+)
+
+// CachedWrapper 读取时优先使用本地缓存的Wrapper，只缓存不带选项的读取
+type CachedWrapper struct {
+	w        *Wrapper
+	dir      string
+	maxBytes int64
+	ttl      time.Duration
+	now      func() time.Time // 测试时固定时间
+	mu       sync.Mutex
+	lru      *lru_cache.LruCache
+	size     int64 // 缓存文件的总大小
+	group    singleflight.Group
+}
+
+type cacheEntry struct {
+	key          string // bucket中的完整key
+	path         string
+	size         int64 // 缓存文件的大小，压缩的文件为解压后的大小
+	remoteSize   int64 // OSS上的文件大小
+	etag         string
+	lastModified time.Time
+	checkedAt    time.Time // 最近一次和OSS校验的时间
+}
+
+func (e *cacheEntry) Key() any {
+	return e.key
+}
+
+// 缓存的文件和OSS上的文件是否一致
+func (e *cacheEntry) matches(meta *FileMeta) bool {
+	if e.etag != "" && meta.ETag != "" {
+		return e.etag == meta.ETag
+	}
+	return e.remoteSize == meta.Size && e.lastModified.Equal(meta.LastModified)
+}
+
+// NewCachedWrapper dir为缓存目录，maxBytes为缓存总大小上限，ttl内直接使用缓存，ttl<=0时每次读取都会校验
+func NewCachedWrapper(w *Wrapper, dir string, maxBytes int64, ttl time.Duration) (*CachedWrapper, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && (strings.HasSuffix(name, diskCacheFileExt) || strings.HasSuffix(name, diskCacheTmpExt)) {
+			_ = os.Remove(filepath.Join(dir, name))
+		}
+	}
+	c := &CachedWrapper{w: w, dir: dir, maxBytes: maxBytes, ttl: ttl, now: time.Now}
+	c.lru = lru_cache.NewLruCache(diskCacheMaxEntries, c.onEvict)
+	return c, nil
+}
+
+func (c *CachedWrapper) Wrapper() *Wrapper {
+	return c.w
+}
+
+func (c *CachedWrapper) GetObject(key string) ([]byte, error) {
+	r, err := c.GetReader(key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	return io.ReadAll(r)
+}
+
+func (c *CachedWrapper) GetFile(key string, localFile string) error {
+	r, err := c.GetReader(key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	fd, err := os.Create(localFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fd.Close()
+	}()
+	_, err = io.Copy(fd, r)
+	return err
+}
+
+// GetReader 读取缓存文件，未命中时先下载到缓存，使用完需要Close
+func (c *CachedWrapper) GetReader(key string) (io.ReadCloser, error) {
+	fullKey := c.w.fullKey(key)
+	entry := c.get(fullKey)
+	if entry != nil && c.now().Sub(entry.checkedAt) < c.ttl {
+		if fd := c.openEntry(fullKey, entry.etag); fd != nil {
+			return fd, nil
+		}
+	}
+
+	v, err, _ := c.group.Do(fullKey, func() (any, error) {
+		return c.refresh(key, fullKey, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if v.(*cacheEntry) != nil {
+		if fd := c.openEntry(fullKey, v.(*cacheEntry).etag); fd != nil {
+			return fd, nil
+		}
+	}
+	// 文件太大或刚被淘汰，直接读取OSS
+	return c.w.GetReader(key)
+}
+
+// Invalidate 删除key的缓存，文件更新后可以立即生效
+func (c *CachedWrapper) Invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.remove(c.w.fullKey(key))
+}
+
+// Size 缓存文件的总大小
+func (c *CachedWrapper) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// 返回缓存信息的副本，不存在时返回nil
+func (c *CachedWrapper) get(fullKey string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.lru.Get(fullKey)
+	if !ok {
+		return nil
+	}
+	res := *v.(*cacheEntry)
+	return &res
+}
+
+// 在锁内打开缓存文件，避免和淘汰冲突，打开后即使文件被淘汰也可以继续读取
+func (c *CachedWrapper) openEntry(fullKey string, etag string) *os.File {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.lru.Get(fullKey)
+	if !ok || v.(*cacheEntry).etag != etag {
+		return nil
+	}
+	fd, err := os.Open(v.(*cacheEntry).path)
+	if err != nil {
+		logger.Error("[OSS] open cache file failed, key: %s, err: %s", fullKey, err)
+		c.remove(fullKey)
+		return nil
+	}
+	return fd
+}
+
+// 校验并更新缓存，返回nil表示文件不缓存
+func (c *CachedWrapper) refresh(key string, fullKey string, old *cacheEntry) (*cacheEntry, error) {
+	meta, err := c.w.GetObjectMeta(key)
+	if err != nil {
+		return nil, err
+	}
+	if old != nil && old.matches(meta) {
+		if res := c.touch(fullKey); res != nil {
+			return res, nil
+		}
+		// 校验期间被淘汰或删除，重新下载
+	}
+	if meta.Size > c.maxBytes {
+		c.Invalidate(key)
+		return nil, nil
+	}
+	return c.download(key, fullKey)
+}
+
+// 更新校验时间，返回缓存信息的副本，不存在时返回nil
+func (c *CachedWrapper) touch(fullKey string) *cacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.lru.Get(fullKey)
+	if !ok {
+		return nil
+	}
+	entry := v.(*cacheEntry)
+	entry.checkedAt = c.now()
+	res := *entry
+	return &res
+}
+
+// 下载到临时文件，完成后重命名为缓存文件，压缩的文件解压后缓存
+func (c *CachedWrapper) download(key string, fullKey string) (*cacheEntry, error) {
+	body, meta, err := c.w.getReader(key, 0, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	r, err := decodeReader(body, meta)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	tmp, err := os.CreateTemp(c.dir, "*"+diskCacheTmpExt)
+	if err != nil {
+		return nil, err
+	}
+	// 读取时多读一个字节，用于判断文件是否在HEAD之后变大
+	size, err := io.Copy(tmp, io.LimitReader(r, c.maxBytes+1))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || size > c.maxBytes {
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	entry := &cacheEntry{
+		key:          fullKey,
+		path:         c.cachePath(fullKey),
+		size:         size,
+		remoteSize:   meta.Size,
+		etag:         meta.ETag,
+		lastModified: meta.LastModified,
+		checkedAt:    c.now(),
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err = os.Rename(tmp.Name(), entry.path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return nil, err
+	}
+	// 覆盖旧的缓存不会触发淘汰回调，需要扣除旧文件的大小
+	if v, ok := c.lru.Get(fullKey); ok {
+		c.size -= v.(*cacheEntry).size
+	}
+	c.size += entry.size
+	c.lru.Add(entry)
+	for c.size > c.maxBytes {
+		c.lru.Evict()
+	}
+	res := *entry
+	return &res, nil
+}
+
+// 需要在锁内调用
+func (c *CachedWrapper) remove(fullKey string) {
+	if v, ok := c.lru.Get(fullKey); ok {
+		c.lru.Remove(fullKey)
+		c.onEvict(v)
+	}
+}
+
+// 淘汰回调，在锁内调用
+func (c *CachedWrapper) onEvict(v any) {
+	entry := v.(*cacheEntry)
+	c.size -= entry.size
+	if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+		logger.Error("[OSS] remove cache file failed, key: %s, err: %s", entry.key, err)
+	}
+}
+
+func (c *CachedWrapper) cachePath(fullKey string) string {
+	sum := sha1.Sum([]byte(c.w.oc.Bucket + "/" + fullKey))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:])+diskCacheFileExt)
+}
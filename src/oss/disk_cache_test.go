@@ -0,0 +1,173 @@
+package oss
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v6"
+)
+
+// 内存中的storager，只实现测试用到的方法
+type memStorager struct {
+	storager
+	mu      sync.Mutex
+	objects map[string][]byte
+	encs    map[string]string            // 上传时的ContentEncoding
+	users   map[string]map[string]string // 上传时的自定义元数据
+	heads   int32
+	gets    int32
+	down    atomic.Bool // 模拟服务不可用
+}
+
+func (m *memStorager) put(key string, data []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.objects[key] = data
+}
+
+func (m *memStorager) meta(key string) (*FileMeta, []byte, error) {
+	if m.down.Load() {
+		return nil, nil, errors.New("service unavailable")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.objects[key]
+	if !ok {
+		return nil, nil, minio.ErrorResponse{StatusCode: 404, Code: "NoSuchKey"}
+	}
+	meta := &FileMeta{Key: key, Size: int64(len(data)), ETag: fmt.Sprintf("%x", data)}
+	meta.ContentEncoding = m.encs[key]
+	meta.UserMeta = m.users[key]
+	return meta, data, nil
+}
+
+func (m *memStorager) GetObjectMeta(bucket string, key string, metadata *Metadata) (*FileMeta, error) {
+	atomic.AddInt32(&m.heads, 1)
+	meta, _, err := m.meta(key)
+	return meta, err
+}
+
+func (m *memStorager) HeadObject(bucket string, key string, metadata *Metadata) (*FileMeta, error) {
+	return m.GetObjectMeta(bucket, key, metadata)
+}
+
+func (m *memStorager) GetReader(bucket string, key string, offset int64, length int64,
+	metadata *Metadata) (io.ReadCloser, *FileMeta, error) {
+	atomic.AddInt32(&m.gets, 1)
+	time.Sleep(10 * time.Millisecond)
+	meta, data, err := m.meta(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), meta, nil
+}
+
+func TestCachedWrapper(t *testing.T) {
+	st := &memStorager{objects: map[string][]byte{}}
+	st.put("dir/a", []byte("aaaa"))
+	st.put("dir/b", []byte("bbbb"))
+	st.put("dir/c", []byte("cccc"))
+	st.put("dir/big", []byte("0123456789a"))
+	dir := t.TempDir()
+	c, err := NewCachedWrapper((&Wrapper{st: st, oc: &Config{Bucket: "bucket"}}).Sub("dir"), dir, 10, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	// 并发未命中只下载一次
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if data, err := c.GetObject("a"); err != nil || string(data) != "aaaa" {
+				t.Errorf("unexpected data: %s, err: %v", data, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if st.gets != 1 || st.heads != 1 {
+		t.Errorf("concurrent misses should be collapsed, gets: %d, heads: %d", st.gets, st.heads)
+	}
+
+	// ttl内不请求OSS
+	_, _ = c.GetObject("a")
+	if st.gets != 1 || st.heads != 1 {
+		t.Errorf("fresh entry should not be revalidated, gets: %d, heads: %d", st.gets, st.heads)
+	}
+
+	// 超过ttl后校验，未变化时不重新下载
+	now = now.Add(2 * time.Minute)
+	_, _ = c.GetObject("a")
+	if st.gets != 1 || st.heads != 2 {
+		t.Errorf("unchanged entry should not be downloaded, gets: %d, heads: %d", st.gets, st.heads)
+	}
+
+	// 变化后重新下载
+	st.put("dir/a", []byte("AAAA"))
+	now = now.Add(2 * time.Minute)
+	if data, _ := c.GetObject("a"); string(data) != "AAAA" || st.gets != 2 {
+		t.Errorf("changed entry should be downloaded, data: %s, gets: %d", data, st.gets)
+	}
+
+	// 超出大小时淘汰最久未使用的
+	_, _ = c.GetObject("b")
+	_, _ = c.GetObject("c")
+	if c.Size() != 8 || c.get("dir/a") != nil {
+		t.Errorf("least recently used entry should be evicted, size: %d", c.Size())
+	}
+	if _, err := os.Stat(c.cachePath("dir/a")); !os.IsNotExist(err) {
+		t.Errorf("evicted file should be removed, err: %v", err)
+	}
+
+	// 超过上限的文件不缓存
+	if data, err := c.GetObject("big"); string(data) != "0123456789a" || err != nil || c.get("dir/big") != nil {
+		t.Errorf("big file should bypass the cache, data: %s, err: %v", data, err)
+	}
+
+	c.Invalidate("b")
+	if c.Size() != 4 {
+		t.Errorf("invalidated entry should be removed, size: %d", c.Size())
+	}
+
+	// 超过ttl后、校验前被删除，重新下载
+	now = now.Add(2 * time.Minute)
+	entry := c.get("dir/c")
+	c.Invalidate("c")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := c.refresh("c", "dir/c", entry); err != nil {
+			t.Errorf("refresh failed, err: %v", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("refresh of an invalidated entry should not deadlock")
+	}
+	if data, err := c.GetObject("c"); string(data) != "cccc" || err != nil || c.get("dir/c") == nil {
+		t.Errorf("invalidated entry should be downloaded again, data: %s, err: %v", data, err)
+	}
+}
+
+func TestCacheEntryMatches(t *testing.T) {
+	now := time.Now()
+	// 压缩的文件缓存解压后的数据，没有ETag时按OSS上的大小比较
+	e := &cacheEntry{size: 100, remoteSize: 40, lastModified: now}
+	if !e.matches(&FileMeta{Size: 40, LastModified: now}) {
+		t.Error("entry should match the remote size")
+	}
+	if e.matches(&FileMeta{Size: 100, LastModified: now}) || e.matches(&FileMeta{Size: 40, LastModified: now.Add(time.Second)}) {
+		t.Error("changed object should not match")
+	}
+}
@@ -0,0 +1,307 @@
+package oss
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/hqmin9527/kits-go/src/crypto"
+	"github.com/pkg/errors"
+)
+
+// 客户端加密：每个对象使用随机的数据密钥，通过分块的AES-GCM流式加密后上传
+// 数据密钥由KeyProvider的主密钥加密后，和nonce一起保存在对象的自定义元数据中
+// 因为分块加密，范围读取时只需要下载并解密涉及的块
+
+const (
+	encMetaAlg   = "kits-enc-alg"
+	encMetaKeyID = "kits-enc-key-id"
+	encMetaKey   = "kits-enc-key"
+	encMetaNonce = "kits-enc-nonce"
+	encMetaChunk = "kits-enc-chunk"
+
+	encAlgGcmChunk = "AES256-GCM-CHUNK"
+	encDataKeySize = 32
+)
+
+// KeyProvider 管理主密钥，负责加密/解密每个对象的数据密钥
+type KeyProvider interface {
+	// WrapKey 使用当前主密钥加密数据密钥，返回主密钥ID和加密后的数据密钥
+	WrapKey(dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey 使用keyID对应的主密钥解密数据密钥
+	UnwrapKey(keyID string, wrapped []byte) ([]byte, error)
+}
+
+// MasterKeyProvider 使用本地主密钥的KeyProvider
+// 支持主密钥轮换：新对象使用current加密，旧对象仍然可以用历史主密钥解密
+type MasterKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewMasterKeyProvider keys为主密钥ID到主密钥的映射，主密钥长度必须为16｜24｜32字节
+func NewMasterKeyProvider(current string, keys map[string][]byte) (*MasterKeyProvider, error) {
+	if _, ok := keys[current]; !ok {
+		return nil, errors.Errorf("master key %s not found", current)
+	}
+	return &MasterKeyProvider{current: current, keys: keys}, nil
+}
+
+func (p *MasterKeyProvider) WrapKey(dataKey []byte) (string, []byte, error) {
+	wrapped, err := crypto.SealKey(p.keys[p.current], dataKey)
+	if err != nil {
+		return "", nil, err
+	}
+	return p.current, wrapped, nil
+}
+
+func (p *MasterKeyProvider) UnwrapKey(keyID string, wrapped []byte) ([]byte, error) {
+	masterKey, ok := p.keys[keyID]
+	if !ok {
+		return nil, errors.Errorf("master key %s not found", keyID)
+	}
+	return crypto.OpenKey(masterKey, wrapped)
+}
+
+// EncryptedWrapper 上传时透明加密，下载时透明解密
+// 其他不涉及文件内容的操作（列举、删除、签名等）请使用Wrapper()
+type EncryptedWrapper struct {
+	w  *Wrapper
+	kp KeyProvider
+}
+
+func NewEncryptedWrapper(w *Wrapper, kp KeyProvider) *EncryptedWrapper {
+	return &EncryptedWrapper{w: w, kp: kp}
+}
+
+func (e *EncryptedWrapper) Wrapper() *Wrapper {
+	return e.w
+}
+
+func (e *EncryptedWrapper) PutObject(key string, data []byte, options ...Option) error {
+	stream, encOption, err := e.newStream()
+	if err != nil {
+		return err
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, stream.CipherSize(int64(len(data)))))
+	ew := stream.EncryptWriter(buf)
+	if _, err = ew.Write(data); err != nil {
+		return err
+	}
+	if err = ew.Close(); err != nil {
+		return err
+	}
+	return e.w.PutObject(key, buf.Bytes(), append(options, encOption)...)
+}
+
+// PutFile 先加密到临时文件，再上传（大文件仍然可以使用分片上传）
+func (e *EncryptedWrapper) PutFile(key string, filePath string, options ...Option) error {
+	stream, encOption, err := e.newStream()
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = src.Close()
+	}()
+	tmp, err := os.CreateTemp("", "oss-enc-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+	}()
+
+	ew := stream.EncryptWriter(tmp)
+	if _, err = io.Copy(ew, src); err != nil {
+		return err
+	}
+	if err = ew.Close(); err != nil {
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return e.w.PutFile(key, tmp.Name(), append(options, encOption)...)
+}
+
+// PutReader 边读边加密边上传
+func (e *EncryptedWrapper) PutReader(key string, r io.Reader, options ...Option) error {
+	stream, encOption, err := e.newStream()
+	if err != nil {
+		return err
+	}
+	pr, pw := io.Pipe()
+	go func() {
+		ew := stream.EncryptWriter(pw)
+		_, err := io.Copy(ew, r)
+		if err == nil {
+			err = ew.Close()
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	err = e.w.PutReader(key, pr, append(options, encOption)...)
+	// 上传失败时，保证加密协程可以退出
+	_ = pr.Close()
+	return err
+}
+
+func (e *EncryptedWrapper) GetObject(key string) ([]byte, error) {
+	r, err := e.GetReader(key)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	return io.ReadAll(r)
+}
+
+func (e *EncryptedWrapper) GetFile(key string, localFile string) error {
+	r, err := e.GetReader(key)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	fd, err := os.Create(localFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fd.Close()
+	}()
+	_, err = io.Copy(fd, r)
+	return err
+}
+
+// GetReader 流式读取并解密，使用完需要Close
+func (e *EncryptedWrapper) GetReader(key string) (io.ReadCloser, error) {
+	body, meta, err := e.w.getReader(key, 0, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := e.openStream(meta)
+	if err != nil {
+		_ = body.Close()
+		return nil, err
+	}
+	plainSize := stream.PlainSize(meta.Size)
+	return &readCloser{Reader: stream.DecryptReader(body, 0, stream.LastChunk(plainSize)), Closer: body}, nil
+}
+
+// GetRange 读取明文[offset, offset+length)范围的数据，length<0表示读到结尾，只会下载涉及的密文块
+func (e *EncryptedWrapper) GetRange(key string, offset int64, length int64) (io.ReadCloser, error) {
+	meta, err := e.w.GetObjectMeta(key)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := e.openStream(meta)
+	if err != nil {
+		return nil, err
+	}
+	plainSize := stream.PlainSize(meta.Size)
+	if offset >= plainSize || length == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	cipherOffset, cipherLength, firstChunk := stream.CipherRange(offset, length, plainSize)
+	body, err := e.w.GetRange(key, cipherOffset, cipherLength)
+	if err != nil {
+		return nil, err
+	}
+	full := int64(stream.ChunkSize() + crypto.GcmTagSize)
+	endChunk := firstChunk + (cipherLength+full-1)/full - 1
+	var r io.Reader = stream.DecryptRangeReader(body, firstChunk, endChunk, stream.LastChunk(plainSize))
+	// 跳过第一块中offset之前的数据
+	skip := offset - firstChunk*int64(stream.ChunkSize())
+	if _, err = io.CopyN(io.Discard, r, skip); err != nil {
+		_ = body.Close()
+		return nil, err
+	}
+	if length > 0 {
+		r = io.LimitReader(r, length)
+	}
+	return &readCloser{Reader: r, Closer: body}, nil
+}
+
+// GetObjectMeta 返回的Size为明文大小
+func (e *EncryptedWrapper) GetObjectMeta(key string) (*FileMeta, error) {
+	meta, err := e.w.GetObjectMeta(key)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := e.openStream(meta)
+	if err != nil {
+		return nil, err
+	}
+	meta.Size = stream.PlainSize(meta.Size)
+	return meta, nil
+}
+
+// 生成新的数据密钥和nonce，返回加密流和保存加密信息的Option
+func (e *EncryptedWrapper) newStream() (*crypto.GcmStream, Option, error) {
+	dataKey, err := crypto.RandomBytes(encDataKeySize)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce, err := crypto.RandomBytes(crypto.GcmNonceSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyID, wrapped, err := e.kp.WrapKey(dataKey)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "wrap data key")
+	}
+	stream, err := crypto.NewGcmStream(dataKey, nonce, crypto.DefaultGcmChunkSize)
+	if err != nil {
+		return nil, nil, err
+	}
+	option := func(m *Metadata) {
+		AddUserMeta(encMetaAlg, encAlgGcmChunk)(m)
+		AddUserMeta(encMetaKeyID, keyID)(m)
+		AddUserMeta(encMetaKey, base64.StdEncoding.EncodeToString(wrapped))(m)
+		AddUserMeta(encMetaNonce, base64.StdEncoding.EncodeToString(nonce))(m)
+		AddUserMeta(encMetaChunk, strconv.Itoa(stream.ChunkSize()))(m)
+	}
+	return stream, option, nil
+}
+
+// 根据对象的自定义元数据还原加密流
+func (e *EncryptedWrapper) openStream(meta *FileMeta) (*crypto.GcmStream, error) {
+	if meta.UserMeta[encMetaAlg] != encAlgGcmChunk {
+		return nil, errors.Errorf("object is not encrypted by client, key: %s", meta.Key)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(meta.UserMeta[encMetaKey])
+	if err != nil {
+		return nil, errors.Wrap(err, "decode data key")
+	}
+	nonce, err := base64.StdEncoding.DecodeString(meta.UserMeta[encMetaNonce])
+	if err != nil {
+		return nil, errors.Wrap(err, "decode nonce")
+	}
+	chunkSize, err := strconv.Atoi(meta.UserMeta[encMetaChunk])
+	if err != nil {
+		return nil, errors.Wrap(err, "parse chunk size")
+	}
+	// 元数据可以被修改，块大小决定解密时分配的内存
+	if chunkSize <= 0 || chunkSize > crypto.MaxGcmChunkSize {
+		return nil, errors.Errorf("invalid chunk size: %d, key: %s", chunkSize, meta.Key)
+	}
+	dataKey, err := e.kp.UnwrapKey(meta.UserMeta[encMetaKeyID], wrapped)
+	if err != nil {
+		return nil, errors.Wrap(err, "unwrap data key")
+	}
+	return crypto.NewGcmStream(dataKey, nonce, chunkSize)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
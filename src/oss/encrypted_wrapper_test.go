@@ -0,0 +1,61 @@
+package oss
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"testing"
+)
+
+func genEncryptedWrapper(t *testing.T) *EncryptedWrapper {
+	kp, err := NewMasterKeyProvider("v1", map[string][]byte{"v1": bytes.Repeat([]byte{0x01}, 32)})
+	if err != nil {
+		t.Fatalf("new master key provider failed, err: %s", err)
+	}
+	return NewEncryptedWrapper(ossHelper, kp)
+}
+
+func TestMasterKeyProvider(t *testing.T) {
+	kp, err := NewMasterKeyProvider("v2", map[string][]byte{
+		"v1": bytes.Repeat([]byte{0x01}, 32),
+		"v2": bytes.Repeat([]byte{0x02}, 32),
+	})
+	if err != nil {
+		t.Fatalf("new master key provider failed, err: %s", err)
+	}
+	dataKey := bytes.Repeat([]byte{0x03}, 32)
+	keyID, wrapped, err := kp.WrapKey(dataKey)
+	if err != nil || keyID != "v2" {
+		t.Fatalf("wrap key failed, keyID: %s, err: %v", keyID, err)
+	}
+	got, err := kp.UnwrapKey(keyID, wrapped)
+	if err != nil || !bytes.Equal(got, dataKey) {
+		t.Fatalf("unwrap key failed, err: %v", err)
+	}
+	if _, err = kp.UnwrapKey("v1", wrapped); err == nil {
+		t.Error("unwrap key with wrong master key should fail")
+	}
+}
+
+func TestEncryptedWrapper(t *testing.T) {
+	ew := genEncryptedWrapper(t)
+	ossPath := path.Join(testDir, "encrypted.txt")
+	data := bytes.Repeat([]byte("hello world "), 10000)
+	err := ew.PutObject(ossPath, data)
+	fmt.Println("put err:", err)
+
+	got, err := ew.GetObject(ossPath)
+	fmt.Println("get err:", err, "equal:", bytes.Equal(got, data))
+
+	r, err := ew.GetRange(ossPath, 70000, 100)
+	if err != nil {
+		fmt.Println("range err:", err)
+		return
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	part, err := io.ReadAll(r)
+	fmt.Println("range err:", err, "equal:", bytes.Equal(part, data[70000:70100]))
+}
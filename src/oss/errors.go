@@ -0,0 +1,73 @@
+package oss
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aliyun/aliyun-oss-go-sdk/oss"
+	"github.com/huaweicloud/huaweicloud-sdk-go-obs/obs"
+	"github.com/minio/minio-go/v6"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// ErrPreconditionFailed 条件写入的条件不满足：文件已存在，或者ETag不一致
+var ErrPreconditionFailed = errors.New("oss precondition failed")
+
+// ErrNotSupported 当前平台不支持该操作
+var ErrNotSupported = errors.New("oss operation not supported by provider")
+
+// ErrFetchTooLarge PutFromURL抓取的数据超过大小限制
+var ErrFetchTooLarge = errors.New("oss fetch source exceeds size limit")
+
+// ErrChecksumMismatch PutFromURL抓取的数据与期望的校验值不一致
+var ErrChecksumMismatch = errors.New("oss fetch checksum mismatch")
+
+// 把各平台条件不满足的错误统一转为ErrPreconditionFailed
+func preconditionError(err error) error {
+	if err == nil {
+		return nil
+	}
+	switch e := pkgerrors.Cause(err).(type) {
+	case oss.ServiceError:
+		// x-oss-forbid-overwrite时文件已存在返回409 FileAlreadyExists
+		if e.StatusCode == 412 || e.Code == "FileAlreadyExists" {
+			return ErrPreconditionFailed
+		}
+	case obs.ObsError:
+		if e.StatusCode == 412 {
+			return ErrPreconditionFailed
+		}
+	case minio.ErrorResponse:
+		if e.StatusCode == 412 || e.Code == "PreconditionFailed" {
+			return ErrPreconditionFailed
+		}
+	}
+	return err
+}
+
+// IsNotFound 是否为各平台文件不存在的错误
+func IsNotFound(err error) bool {
+	switch e := pkgerrors.Cause(err).(type) {
+	case oss.ServiceError:
+		return e.StatusCode == 404
+	case obs.ObsError:
+		return e.StatusCode == 404
+	case minio.ErrorResponse:
+		return e.StatusCode == 404 || e.Code == "NoSuchKey"
+	}
+	return false
+}
+
+// bucket没有设置生命周期、跨域、策略等配置时的错误，如NoSuchLifecycleConfiguration、NoSuchCORSConfiguration
+func isNoSuchConfig(err error) bool {
+	var code string
+	switch e := pkgerrors.Cause(err).(type) {
+	case oss.ServiceError:
+		code = e.Code
+	case obs.ObsError:
+		code = e.Code
+	case minio.ErrorResponse:
+		code = e.Code
+	}
+	return strings.HasPrefix(code, "NoSuch") && code != "NoSuchBucket" && code != "NoSuchKey"
+}
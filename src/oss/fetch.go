@@ -0,0 +1,310 @@
+package oss
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/logger"
+	"github.com/pkg/errors"
+)
+
+// 从HTTP(S)地址抓取文件上传到OSS
+// 1. 边下载边上传，不在内存或本地缓存完整的文件
+// 2. 没有指定ContentType时使用响应头，响应头为空或application/octet-stream时按前512字节识别
+// 3. 网络错误、429和5xx时从头重试，上传OSS失败不重试（SDK已有重试）
+// 4. 没有校验值时直接上传到key；指定了校验值时先上传到Tmp作用域（需要配置TmpRoot），校验通过后才复制到key，
+//    失败时原文件不受影响，临时文件总是会删除
+// 5. FetchAsync使用平台的异步抓取（目前只有阿里云），只支持MD5校验和NoOverwrite，其它参数不生效
+
+const (
+	fetchDefaultTimeout   = time.Hour
+	fetchDefaultRedirects = 10
+	fetchDefaultRetry     = 3
+	fetchDefaultInterval  = time.Second
+	fetchSniffLen         = 512
+)
+
+type fetchConfig struct {
+	maxSize       int64 // 0表示不限制
+	timeout       time.Duration
+	maxRedirects  int
+	retry         int
+	retryInterval time.Duration
+	md5           string // 期望的MD5，小写16进制
+	sha256        string // 期望的SHA-256，小写16进制
+	async         bool
+}
+
+// FetchResult 抓取结果，异步抓取时只有TaskID
+type FetchResult struct {
+	Size        int64
+	ContentType string
+	MD5         string // 小写16进制
+	SHA256      string // 小写16进制
+	TaskID      string
+}
+
+// FetchTask 平台异步抓取任务的状态
+type FetchTask struct {
+	ID       string
+	State    string // 平台返回的状态，如阿里云的Running、Success、Failed
+	Key      string // 作用域内的相对key
+	URL      string
+	ErrorMsg string
+}
+
+// 重定向次数超过限制，不重试
+var errFetchRedirects = errors.New("oss fetch stopped after too many redirects")
+
+func newFetchConfig() *fetchConfig {
+	return &fetchConfig{
+		timeout:       fetchDefaultTimeout,
+		maxRedirects:  fetchDefaultRedirects,
+		retry:         fetchDefaultRetry,
+		retryInterval: fetchDefaultInterval,
+	}
+}
+
+func fetchOption(fn func(c *fetchConfig)) Option {
+	return func(m *Metadata) {
+		if m.fetch == nil {
+			m.fetch = newFetchConfig()
+		}
+		fn(m.fetch)
+	}
+}
+
+// FetchMaxSize 抓取数据的大小上限，超过时返回ErrFetchTooLarge
+var FetchMaxSize = func(size int64) Option {
+	return fetchOption(func(c *fetchConfig) {
+		c.maxSize = size
+	})
+}
+
+// FetchTimeout 单次抓取（包括读取数据）的超时时间，默认1小时
+var FetchTimeout = func(timeout time.Duration) Option {
+	return fetchOption(func(c *fetchConfig) {
+		c.timeout = timeout
+	})
+}
+
+// FetchMaxRedirects 最多跟随的重定向次数，默认10次，0表示不跟随
+var FetchMaxRedirects = func(n int) Option {
+	return fetchOption(func(c *fetchConfig) {
+		c.maxRedirects = n
+	})
+}
+
+// FetchRetry 临时错误的重试次数和间隔（按次数递增），默认重试3次，间隔1秒
+var FetchRetry = func(times int, interval time.Duration) Option {
+	return fetchOption(func(c *fetchConfig) {
+		c.retry = times
+		c.retryInterval = interval
+	})
+}
+
+// FetchMD5 校验数据的MD5（16进制）
+var FetchMD5 = func(sum string) Option {
+	return fetchOption(func(c *fetchConfig) {
+		c.md5 = strings.ToLower(sum)
+	})
+}
+
+// FetchSHA256 校验数据的SHA-256（16进制）
+var FetchSHA256 = func(sum string) Option {
+	return fetchOption(func(c *fetchConfig) {
+		c.sha256 = strings.ToLower(sum)
+	})
+}
+
+// FetchAsync 使用平台的异步抓取，不支持时返回ErrNotSupported
+var FetchAsync = fetchOption(func(c *fetchConfig) {
+	c.async = true
+})
+
+// PutFromURL 抓取sourceURL上传到key
+func (o *Wrapper) PutFromURL(key string, sourceURL string, options ...Option) (*FetchResult, error) {
+	checkKey(key)
+	u, err := url.Parse(sourceURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, errors.Errorf("unsupported fetch url scheme: %s", u.Scheme)
+	}
+	md := buildMetadata(options)
+	if md.fetch == nil {
+		md.fetch = newFetchConfig()
+	}
+	if md.fetch.async {
+		taskID, err := o.st.AsyncFetch(o.oc.Bucket, o.fullKey(key), sourceURL, md)
+		if err != nil {
+			return nil, err
+		}
+		return &FetchResult{TaskID: taskID}, nil
+	}
+
+	client := &http.Client{
+		Timeout: md.fetch.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > md.fetch.maxRedirects {
+				return errFetchRedirects
+			}
+			return nil
+		},
+	}
+	for i := 0; ; i++ {
+		res, retryable, err := o.fetchOnce(client, key, sourceURL, md)
+		if err == nil {
+			return res, nil
+		}
+		if !retryable || i >= md.fetch.retry {
+			return nil, err
+		}
+		logger.Warn("oss fetch failed, retry %d, url: %s, err: %s", i+1, sourceURL, err)
+		time.Sleep(md.fetch.retryInterval * time.Duration(i+1))
+	}
+}
+
+// GetFetchTask 查询异步抓取任务
+func (o *Wrapper) GetFetchTask(taskID string) (*FetchTask, error) {
+	task, err := o.st.GetAsyncFetch(o.oc.Bucket, taskID)
+	if err != nil {
+		return nil, err
+	}
+	task.Key = o.relKey(task.Key)
+	return task, nil
+}
+
+// 抓取一次，返回错误是否可以重试
+func (o *Wrapper) fetchOnce(client *http.Client, key string, sourceURL string,
+	md *Metadata) (*FetchResult, bool, error) {
+	resp, err := client.Get(sourceURL)
+	if err != nil {
+		return nil, !errors.Is(err, errFetchRedirects), err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retryable, errors.Errorf("fetch %s failed, status: %s", sourceURL, resp.Status)
+	}
+	if md.fetch.maxSize > 0 && resp.ContentLength > md.fetch.maxSize {
+		return nil, false, ErrFetchTooLarge
+	}
+
+	body := bufio.NewReaderSize(resp.Body, fetchSniffLen)
+	put := *md
+	if put.ContentType == "" {
+		put.ContentType = fetchContentType(resp.Header.Get("Content-Type"), body)
+	}
+	r := &fetchReader{r: body, maxSize: md.fetch.maxSize, md5: md5.New(), sha256: sha256.New()}
+	if md.fetch.md5 == "" && md.fetch.sha256 == "" {
+		return o.fetchDirect(key, r, &put)
+	}
+	// 临时文件不能放在正式的作用域中
+	if err = o.checkTmpScope(); err != nil {
+		return nil, false, errors.Wrap(err, "fetch with checksum needs tmp scope")
+	}
+	// 条件写入作用于复制到key，临时文件不需要
+	tmp := put
+	tmp.forbidOverwrite, tmp.ifMatch = false, ""
+	tmpKey := o.Tmp().fullKey(newTmpKey(key))
+	err = o.st.PutReaderWithMeta(o.oc.Bucket, tmpKey, r, &tmp)
+	// 读取源数据失败时，上传也可能已经完成（SDK读到错误后仍提交了已读取的数据）
+	defer o.removeFetched(tmpKey)
+	if r.err != nil {
+		return nil, r.err != ErrFetchTooLarge, r.err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	res := r.result(put.ContentType)
+	if (md.fetch.md5 != "" && md.fetch.md5 != res.MD5) || (md.fetch.sha256 != "" && md.fetch.sha256 != res.SHA256) {
+		return nil, false, ErrChecksumMismatch
+	}
+	put.srcSize = r.size
+	if err = preconditionError(o.copyObject(tmpKey, o.fullKey(key), &put)); err != nil {
+		return nil, false, err
+	}
+	return res, false, nil
+}
+
+// 没有校验值时直接上传到key
+func (o *Wrapper) fetchDirect(key string, r *fetchReader, md *Metadata) (*FetchResult, bool, error) {
+	fullKey := o.fullKey(key)
+	err := preconditionError(o.st.PutReaderWithMeta(o.oc.Bucket, fullKey, r, md))
+	if r.err != nil {
+		// 上传已经提交时删除不完整的文件
+		if err == nil {
+			o.removeFetched(fullKey)
+		}
+		return nil, r.err != ErrFetchTooLarge, r.err
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return r.result(md.ContentType), false, nil
+}
+
+// 删除临时文件，fullKey为bucket中的完整key
+func (o *Wrapper) removeFetched(fullKey string) {
+	if err := o.st.DeleteObject(o.oc.Bucket, fullKey); err != nil && !IsNotFound(err) {
+		logger.Error("oss remove fetched object failed, key: %s, err: %s", fullKey, err)
+	}
+}
+
+func fetchContentType(header string, body *bufio.Reader) string {
+	if header != "" {
+		if mediaType, _, err := mime.ParseMediaType(header); err == nil && mediaType != "application/octet-stream" {
+			return header
+		}
+	}
+	data, _ := body.Peek(fetchSniffLen)
+	return http.DetectContentType(data)
+}
+
+// 读取时统计大小和校验值，超过大小限制时返回ErrFetchTooLarge，记录读取源数据的错误
+type fetchReader struct {
+	r       io.Reader
+	maxSize int64
+	size    int64
+	md5     hash.Hash
+	sha256  hash.Hash
+	err     error
+}
+
+func (f *fetchReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	f.size += int64(n)
+	_, _ = f.md5.Write(p[:n])
+	_, _ = f.sha256.Write(p[:n])
+	if f.maxSize > 0 && f.size > f.maxSize {
+		f.err = ErrFetchTooLarge
+		return n, f.err
+	}
+	if err != nil && err != io.EOF {
+		f.err = err
+	}
+	return n, err
+}
+
+func (f *fetchReader) result(contentType string) *FetchResult {
+	return &FetchResult{
+		Size:        f.size,
+		ContentType: contentType,
+		MD5:         hex.EncodeToString(f.md5.Sum(nil)),
+		SHA256:      hex.EncodeToString(f.sha256.Sum(nil)),
+	}
+}
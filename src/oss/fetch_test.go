@@ -0,0 +1,108 @@
+package oss
+
+import (
+	"crypto/md5"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPutFromURL(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	var flaky int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/img", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(png)
+	})
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&flaky, 1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("hello"))
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/img", http.StatusFound)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	st := &memStorager{objects: map[string][]byte{}}
+	w := (&Wrapper{st: st, oc: &Config{Bucket: "bucket", TmpRoot: "tmp"}}).Sub("dir")
+	retry := FetchRetry(3, time.Millisecond)
+
+	// 按内容识别类型
+	res, err := w.PutFromURL("a.png", srv.URL+"/img", FetchMD5(fmt.Sprintf("%x", md5.Sum(png))))
+	if err != nil || res.Size != int64(len(png)) || res.ContentType != "image/png" || string(st.objects["dir/a.png"]) != string(png) {
+		t.Fatalf("unexpected result: %+v, err: %v", res, err)
+	}
+
+	// 5xx重试
+	res, err = w.PutFromURL("b.txt", srv.URL+"/flaky", retry)
+	if err != nil || flaky != 3 || res.ContentType != "text/plain; charset=utf-8" || string(st.objects["dir/b.txt"]) != "hello" {
+		t.Errorf("transient errors should be retried, result: %+v, tries: %d, err: %v", res, flaky, err)
+	}
+
+	// 4xx不重试
+	if _, err = w.PutFromURL("c", srv.URL+"/missing", retry); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("not found should fail, err: %v", err)
+	}
+
+	if _, err = w.PutFromURL("d", srv.URL+"/img", FetchMaxSize(10)); !errors.Is(err, ErrFetchTooLarge) {
+		t.Errorf("size limit should be enforced, err: %v", err)
+	}
+
+	if _, err = w.PutFromURL("e", srv.URL+"/img", FetchSHA256(strings.Repeat("0", 64))); !errors.Is(err, ErrChecksumMismatch) {
+		t.Errorf("checksum should be verified, err: %v", err)
+	}
+	if _, ok := st.objects["dir/e"]; ok {
+		t.Errorf("mismatched object should not be uploaded")
+	}
+	// 校验失败时不影响原文件
+	if _, err = w.PutFromURL("b.txt", srv.URL+"/img", FetchMD5(strings.Repeat("0", 32))); !errors.Is(err, ErrChecksumMismatch) ||
+		string(st.objects["dir/b.txt"]) != "hello" {
+		t.Errorf("previous object should be kept, data: %s, err: %v", st.objects["dir/b.txt"], err)
+	}
+
+	if _, err = w.PutFromURL("f", srv.URL+"/redirect"); err != nil {
+		t.Errorf("redirect should be followed, err: %v", err)
+	}
+	if _, err = w.PutFromURL("g", srv.URL+"/redirect", FetchMaxRedirects(0), retry); !errors.Is(err, errFetchRedirects) {
+		t.Errorf("redirect should be refused, err: %v", err)
+	}
+	for key := range st.objects {
+		if !strings.HasPrefix(key, "dir/") {
+			t.Errorf("tmp object should be removed: %s", key)
+		}
+	}
+
+	// 没有配置TmpRoot时不能校验，不带校验值时直接上传
+	noTmp := &Wrapper{st: st, oc: &Config{Bucket: "bucket"}}
+	if _, err = noTmp.PutFromURL("h", srv.URL+"/img", FetchMD5(fmt.Sprintf("%x", md5.Sum(png)))); err == nil {
+		t.Errorf("checksum without tmp scope should fail")
+	}
+	if res, err = noTmp.PutFromURL("h", srv.URL+"/img"); err != nil || res.Size != int64(len(png)) || string(st.objects["h"]) != string(png) {
+		t.Errorf("fetch without checksum should upload directly, result: %+v, err: %v", res, err)
+	}
+	if len(st.objects) != 4 {
+		t.Errorf("only fetched objects should be left: %d", len(st.objects))
+	}
+}
+
+func TestPutFromURLRemote(t *testing.T) {
+	res, err := ossHelper.PutFromURL(joinPath(testDir, "fetch.html"), "https://www.example.com/")
+	if err != nil {
+		fmt.Println("fetch err:", err)
+		return
+	}
+	fmt.Printf("fetch: %+v\n", res)
+}
@@ -0,0 +1,259 @@
+package oss
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// FS 把Wrapper的作用域作为只读的io/fs.FS，可用于template.ParseFS、http.FS等
+// 目录使用"/"分隔符列举，文件使用ObjectReader按需范围读取
+// 对象存储没有真正的目录：存在以"dir/"为前缀的文件时，dir就是目录
+// 压缩上传（Compress）的文件Open时解压到内存，Stat的大小为解压后的大小；ReadDir列举的仍是保存的大小
+type FS struct {
+	w *Wrapper
+}
+
+var (
+	_ fs.ReadDirFS  = (*FS)(nil)
+	_ fs.StatFS     = (*FS)(nil)
+	_ fs.ReadFileFS = (*FS)(nil)
+	_ fs.SubFS      = (*FS)(nil)
+)
+
+// FS 返回当前作用域的FS，需要限定在某个目录下时使用o.Sub(prefix).FS()
+func (o *Wrapper) FS() *FS {
+	return &FS{w: o}
+}
+
+func (f *FS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name != "." {
+		r, err := f.w.NewObjectReader(name)
+		if err == nil {
+			if r.meta.compressed() {
+				return f.openDecoded(name, r)
+			}
+			return &fsFile{ObjectReader: r, name: name}, nil
+		}
+		if !IsNotFound(err) {
+			return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+		}
+	}
+	entries, err := f.readDir("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return &fsDir{name: name, entries: entries}, nil
+}
+
+// 压缩的文件解压后才知道大小，不能按范围读取，读取完整的文件
+func (f *FS) openDecoded(name string, r *ObjectReader) (fs.File, error) {
+	_ = r.Close()
+	data, err := f.w.GetObject(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	info := &fsInfo{name: path.Base(name), size: int64(len(data)), modTime: r.ModTime()}
+	return &fsDecodedFile{Reader: bytes.NewReader(data), info: info}, nil
+}
+
+func (f *FS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrInvalid}
+	}
+	return f.readDir("readdir", name)
+}
+
+func (f *FS) Stat(name string) (fs.FileInfo, error) {
+	file, err := f.Open(name)
+	if err != nil {
+		if pe, ok := err.(*fs.PathError); ok {
+			pe.Op = "stat"
+		}
+		return nil, err
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+	return file.Stat()
+}
+
+func (f *FS) ReadFile(name string) ([]byte, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: fs.ErrInvalid}
+	}
+	data, err := f.w.GetObject(name)
+	if err != nil {
+		if IsNotFound(err) {
+			err = fs.ErrNotExist
+		}
+		return nil, &fs.PathError{Op: "readfile", Path: name, Err: err}
+	}
+	return data, nil
+}
+
+func (f *FS) Sub(dir string) (fs.FS, error) {
+	if !fs.ValidPath(dir) {
+		return nil, &fs.PathError{Op: "sub", Path: dir, Err: fs.ErrInvalid}
+	}
+	if dir == "." {
+		return f, nil
+	}
+	return f.w.Sub(dir).FS(), nil
+}
+
+// 列举目录，按名称排序；目录为空时视为不存在（根目录除外）
+func (f *FS) readDir(op string, name string) ([]fs.DirEntry, error) {
+	dir := name
+	if dir == "." {
+		dir = ""
+	}
+	dirs, files, err := f.w.ListDir(dir)
+	if err != nil {
+		return nil, &fs.PathError{Op: op, Path: name, Err: err}
+	}
+	if name != "." && len(dirs) == 0 && len(files) == 0 {
+		return nil, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+	}
+	entries := make([]fs.DirEntry, 0, len(dirs)+len(files))
+	for _, d := range dirs {
+		entries = append(entries, &fsInfo{name: path.Base(strings.TrimSuffix(d, "/")), dir: true})
+	}
+	for _, file := range files {
+		entries = append(entries, &fsInfo{name: path.Base(file.Key), size: file.Size, modTime: file.LastModified})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// 文件和目录的信息，同时实现fs.FileInfo和fs.DirEntry
+type fsInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+func (i *fsInfo) Name() string {
+	return i.name
+}
+
+func (i *fsInfo) Size() int64 {
+	return i.size
+}
+
+func (i *fsInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
+
+func (i *fsInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+func (i *fsInfo) IsDir() bool {
+	return i.dir
+}
+
+func (i *fsInfo) Sys() any {
+	return nil
+}
+
+func (i *fsInfo) Type() fs.FileMode {
+	return i.Mode().Type()
+}
+
+func (i *fsInfo) Info() (fs.FileInfo, error) {
+	return i, nil
+}
+
+// 文件，实现了io.Seeker，http.FileServer可以直接处理Range请求
+type fsFile struct {
+	*ObjectReader
+	name string
+}
+
+func (f *fsFile) Stat() (fs.FileInfo, error) {
+	return &fsInfo{name: path.Base(f.name), size: f.Size(), modTime: f.ModTime()}, nil
+}
+
+// ReadAt 每次单独发起范围请求，不影响Read的位置
+func (f *fsFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.Size() {
+		return 0, io.EOF
+	}
+	body, err := f.w.GetRange(f.key, off, int64(len(p)))
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+	n, err := io.ReadFull(body, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// 解压后的文件，同样实现了io.Seeker和io.ReaderAt
+type fsDecodedFile struct {
+	*bytes.Reader
+	info *fsInfo
+}
+
+func (f *fsDecodedFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+func (f *fsDecodedFile) Close() error {
+	return nil
+}
+
+// 目录，ReadDir的结果在Open时已经列举好
+type fsDir struct {
+	name    string
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *fsDir) Stat() (fs.FileInfo, error) {
+	return &fsInfo{name: path.Base(d.name), dir: true}, nil
+}
+
+func (d *fsDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.name, Err: errors.New("is a directory")}
+}
+
+func (d *fsDir) Close() error {
+	return nil
+}
+
+// ReadDir n<=0时返回剩余的全部，n>0时最多返回n个，没有更多时返回io.EOF
+func (d *fsDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
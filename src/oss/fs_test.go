@@ -0,0 +1,54 @@
+package oss
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFsDirReadDir(t *testing.T) {
+	d := &fsDir{name: "a", entries: []fs.DirEntry{
+		&fsInfo{name: "b", dir: true},
+		&fsInfo{name: "c.txt", size: 3},
+		&fsInfo{name: "d.txt", size: 4},
+	}}
+	entries, err := d.ReadDir(2)
+	if err != nil || len(entries) != 2 || entries[0].Name() != "b" || !entries[0].IsDir() {
+		t.Fatalf("read dir 2 failed, entries: %v, err: %v", entries, err)
+	}
+	entries, err = d.ReadDir(2)
+	if err != nil || len(entries) != 1 || entries[0].Name() != "d.txt" {
+		t.Fatalf("read dir rest failed, entries: %v, err: %v", entries, err)
+	}
+	if _, err = d.ReadDir(1); err != io.EOF {
+		t.Errorf("expected io.EOF, got: %v", err)
+	}
+	if entries, err = d.ReadDir(-1); err != nil || len(entries) != 0 {
+		t.Errorf("expected empty entries, got: %v, err: %v", entries, err)
+	}
+}
+
+func TestFS(t *testing.T) {
+	sub := ossHelper.Sub(testDir)
+	if err := sub.PutObject("fs/hello.txt", []byte("hello world")); err != nil {
+		fmt.Println("put object err:", err)
+		return
+	}
+	fsys := sub.FS()
+	err := fstest.TestFS(fsys, "fs/hello.txt")
+	fmt.Println("test fs err:", err)
+
+	data, err := fs.ReadFile(fsys, "fs/hello.txt")
+	fmt.Println("read file:", string(data), err)
+	entries, err := fs.ReadDir(fsys, "fs")
+	for _, entry := range entries {
+		fmt.Println("entry:", entry.Name(), entry.IsDir())
+	}
+	fmt.Println("read dir err:", err)
+
+	// 也可以直接用于http.FileServer
+	_ = http.FileServer(http.FS(fsys))
+}
@@ -0,0 +1,265 @@
+package httpgw
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/logger"
+	"github.com/hqmin9527/kits-go/src/oss"
+)
+
+// 对象存储的http网关，路径（去掉挂载前缀后）即为Wrapper作用域内的key：
+//   GET/HEAD /{key}               下载，支持Range、If-None-Match、If-Modified-Since
+//   PUT /{key}                    流式上传，请求头If-None-Match: *时不覆盖已有文件
+//   POST /{dir}?op=token          签发读写目录的临时token（GetDirToken）
+//   POST /{dir}?op=read-token     签发只读目录的临时token（GetDirTokenRead）
+//   POST /{key}?op=presign        签发上传的预签名url（PresignObject）
+// 挂载在子路径时使用http.StripPrefix，限定目录时传入w.Sub(prefix)
+
+// 操作类型，传给鉴权钩子
+const (
+	OpGet       = "get"
+	OpPut       = "put"
+	OpToken     = "token"
+	OpReadToken = "read-token"
+	OpPresign   = "presign"
+)
+
+// ErrUnauthorized 鉴权钩子返回该错误时响应401，返回其他错误时响应403
+var ErrUnauthorized = errors.New("unauthorized")
+
+// AuthFunc 鉴权钩子，返回nil表示允许，key为作用域内的相对路径
+type AuthFunc func(r *http.Request, op string, key string) error
+
+type Handler struct {
+	w             *oss.Wrapper
+	auth          AuthFunc
+	maxUploadSize int64
+	expires       time.Duration
+	cacheControl  string
+}
+
+type Option func(h *Handler)
+
+// WithAuth 设置鉴权钩子；没有设置时只允许下载，上传和签发token都会被拒绝
+func WithAuth(auth AuthFunc) Option {
+	return func(h *Handler) {
+		h.auth = auth
+	}
+}
+
+// WithMaxUploadSize 限制上传的大小，<=0表示不限制
+func WithMaxUploadSize(size int64) Option {
+	return func(h *Handler) {
+		h.maxUploadSize = size
+	}
+}
+
+// WithExpires 临时token和预签名url的有效期，默认15分钟
+func WithExpires(expires time.Duration) Option {
+	return func(h *Handler) {
+		h.expires = expires
+	}
+}
+
+// WithCacheControl 下载时的Cache-Control响应头
+func WithCacheControl(cacheControl string) Option {
+	return func(h *Handler) {
+		h.cacheControl = cacheControl
+	}
+}
+
+func New(w *oss.Wrapper, options ...Option) *Handler {
+	h := &Handler{w: w, expires: 15 * time.Minute}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
+
+func (h *Handler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	op := h.operation(r)
+	if op == "" {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	key, ok := cleanKey(r.URL.Path)
+	if !ok {
+		http.Error(rw, "invalid key", http.StatusBadRequest)
+		return
+	}
+	// 目录为空的token可以访问整个作用域，不允许签发
+	if key == "" {
+		http.Error(rw, "empty key", http.StatusBadRequest)
+		return
+	}
+	if err := h.authorize(r, op, key); err != nil {
+		if errors.Is(err, ErrUnauthorized) {
+			http.Error(rw, "unauthorized", http.StatusUnauthorized)
+		} else {
+			http.Error(rw, "forbidden", http.StatusForbidden)
+		}
+		return
+	}
+
+	switch op {
+	case OpGet:
+		h.serveObject(rw, r, key)
+	case OpPut:
+		h.upload(rw, r, key)
+	case OpToken:
+		h.writeToken(rw, key, h.w.GetDirToken)
+	case OpReadToken:
+		h.writeToken(rw, key, h.w.GetDirTokenRead)
+	case OpPresign:
+		url, err := h.w.PresignObject(key, h.expires)
+		if err != nil {
+			writeError(rw, err)
+			return
+		}
+		writeJSON(rw, http.StatusOK, map[string]string{"url": url})
+	}
+}
+
+// 把请求路径规范为作用域内的key，鉴权和访问OSS使用同一个key；包含..时返回false
+// 目录保留结尾的/，避免dir的token匹配到dir2
+func cleanKey(p string) (string, bool) {
+	for _, seg := range strings.Split(p, "/") {
+		if seg == ".." {
+			return "", false
+		}
+	}
+	key := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if key != "" && strings.HasSuffix(p, "/") {
+		key += "/"
+	}
+	return key, true
+}
+
+// 根据请求方法和op参数确定操作类型，不支持时返回空
+func (h *Handler) operation(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		return OpGet
+	case http.MethodPut:
+		return OpPut
+	case http.MethodPost:
+		switch op := r.URL.Query().Get("op"); op {
+		case OpToken, OpReadToken, OpPresign:
+			return op
+		}
+	}
+	return ""
+}
+
+func (h *Handler) authorize(r *http.Request, op string, key string) error {
+	if h.auth == nil {
+		if op == OpGet {
+			return nil
+		}
+		return errors.New("no auth hook")
+	}
+	return h.auth(r, op, key)
+}
+
+func (h *Handler) serveObject(rw http.ResponseWriter, r *http.Request, key string) {
+	reader, err := h.w.NewObjectReader(key)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	defer func() {
+		_ = reader.Close()
+	}()
+
+	meta := reader.Meta()
+	header := rw.Header()
+	// 设置了Content-Type，ServeContent就不会为了探测类型而读取文件内容
+	contentType := meta.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	header.Set("Content-Type", contentType)
+	if meta.ETag != "" {
+		header.Set("ETag", oss.QuoteETag(meta.ETag))
+	}
+	if meta.ContentDisposition != "" {
+		header.Set("Content-Disposition", meta.ContentDisposition)
+	}
+	if meta.ContentEncoding != "" {
+		header.Set("Content-Encoding", meta.ContentEncoding)
+	}
+	if h.cacheControl != "" {
+		header.Set("Cache-Control", h.cacheControl)
+	}
+	// 处理Range、条件请求和HEAD，只会下载实际需要的范围
+	http.ServeContent(rw, r, key, meta.LastModified, reader)
+}
+
+func (h *Handler) upload(rw http.ResponseWriter, r *http.Request, key string) {
+	body := r.Body
+	if h.maxUploadSize > 0 {
+		if r.ContentLength > h.maxUploadSize {
+			http.Error(rw, "request entity too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		body = http.MaxBytesReader(rw, r.Body, h.maxUploadSize)
+	}
+
+	var options []oss.Option
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		options = append(options, oss.SetContentType(contentType))
+	}
+	if fileName := r.URL.Query().Get("filename"); fileName != "" {
+		options = append(options, oss.AttachFileName(fileName))
+	}
+	if r.Header.Get("If-None-Match") == "*" {
+		options = append(options, oss.NoOverwrite)
+	}
+	if err := h.w.PutReader(key, body, options...); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			http.Error(rw, "request entity too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		writeError(rw, err)
+		return
+	}
+	writeJSON(rw, http.StatusCreated, map[string]string{"key": key})
+}
+
+func (h *Handler) writeToken(rw http.ResponseWriter, dir string,
+	fn func(remoteDir string, expires time.Duration) (*oss.StsTokenInfo, error)) {
+
+	token, err := fn(dir, h.expires)
+	if err != nil {
+		writeError(rw, err)
+		return
+	}
+	writeJSON(rw, http.StatusOK, token)
+}
+
+// 把错误转为http状态码，服务端错误不返回具体信息
+func writeError(rw http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, oss.ErrPreconditionFailed):
+		http.Error(rw, "precondition failed", http.StatusPreconditionFailed)
+	case oss.IsNotFound(err):
+		http.Error(rw, "not found", http.StatusNotFound)
+	default:
+		logger.Error("oss http gateway failed, err: %s", err)
+		http.Error(rw, "internal server error", http.StatusInternalServerError)
+	}
+}
+
+func writeJSON(rw http.ResponseWriter, status int, v any) {
+	rw.Header().Set("Content-Type", "application/json; charset=utf-8")
+	rw.WriteHeader(status)
+	if err := json.NewEncoder(rw).Encode(v); err != nil {
+		logger.Error("oss http gateway write json failed, err: %s", err)
+	}
+}
@@ -0,0 +1,146 @@
+package httpgw
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/oss"
+)
+
+func TestHandlerReject(t *testing.T) {
+	unauthorized := WithAuth(func(r *http.Request, op string, key string) error {
+		if r.Header.Get("Authorization") == "" {
+			return ErrUnauthorized
+		}
+		return nil
+	})
+	cases := []struct {
+		name     string
+		h        *Handler
+		method   string
+		target   string
+		expected int
+	}{
+		{"put without auth hook", New(nil), http.MethodPut, "/a.txt", http.StatusForbidden},
+		{"token without auth hook", New(nil), http.MethodPost, "/dir/?op=token", http.StatusForbidden},
+		{"token unauthorized", New(nil, unauthorized), http.MethodPost, "/dir/?op=token", http.StatusUnauthorized},
+		{"unknown op", New(nil), http.MethodPost, "/a.txt?op=unknown", http.StatusMethodNotAllowed},
+		{"delete", New(nil), http.MethodDelete, "/a.txt", http.StatusMethodNotAllowed},
+		{"empty key", New(nil), http.MethodGet, "/", http.StatusBadRequest},
+		{"token for empty dir", New(nil, unauthorized), http.MethodPost, "/?op=token", http.StatusBadRequest},
+		{"read token for empty dir", New(nil, unauthorized), http.MethodPost, "//?op=read-token", http.StatusBadRequest},
+		{"parent dir", New(nil), http.MethodGet, "/public/../private/x", http.StatusBadRequest},
+		{"escaped parent dir", New(nil), http.MethodGet, "/public/%2e%2e/private/x", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		c.h.ServeHTTP(rec, httptest.NewRequest(c.method, c.target, nil))
+		if rec.Code != c.expected {
+			t.Errorf("%s, expected: %d, got: %d", c.name, c.expected, rec.Code)
+		}
+	}
+}
+
+func TestCleanKey(t *testing.T) {
+	cases := map[string]string{
+		"/a.txt":       "a.txt",
+		"//dir//a.txt": "dir/a.txt",
+		"/dir/./a.txt": "dir/a.txt",
+		"/dir/":        "dir/",
+		"/./":          "",
+		"":             "",
+	}
+	for p, expected := range cases {
+		if key, ok := cleanKey(p); !ok || key != expected {
+			t.Errorf("clean %q, expected: %q, got: %q", p, expected, key)
+		}
+	}
+	if _, ok := cleanKey("/a/../b"); ok {
+		t.Errorf("parent dir should be rejected")
+	}
+}
+
+func TestWriteError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	writeError(rec, oss.ErrPreconditionFailed)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Errorf("expected: 412, got: %d", rec.Code)
+	}
+}
+
+// 内存中的s3服务，只支持HEAD、GET（包括Range）、获取ACL和bucket位置
+func newMemS3(objects map[string]string) *httptest.Server {
+	modTime := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			_, _ = w.Write([]byte(`<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/"></LocationConstraint>`))
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/bucket/")
+		data, ok := objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>not found</Message></Error>`))
+			return
+		}
+		if _, ok := r.URL.Query()["acl"]; ok {
+			_, _ = w.Write([]byte(`<AccessControlPolicy><AccessControlList></AccessControlList></AccessControlPolicy>`))
+			return
+		}
+		w.Header().Set("ETag", `"etag-`+key+`"`)
+		w.Header().Set("Content-Type", "text/plain")
+		http.ServeContent(w, r, key, modTime, strings.NewReader(data))
+	}))
+}
+
+func TestHandlerServe(t *testing.T) {
+	srv := newMemS3(map[string]string{"dir/a.txt": "0123456789"})
+	defer srv.Close()
+	w, err := oss.NewWrapper(&oss.Config{Provider: oss.MinIo, Endpoint: strings.TrimPrefix(srv.URL, "http://"),
+		Bucket: "bucket", AccessKeyId: "ak", AccessKeySecret: "sk"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := New(w.Sub("dir"), WithCacheControl("max-age=60"))
+	serve := func(method string, target string, header map[string]string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, nil)
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := serve(http.MethodGet, "/a.txt", nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" || rec.Header().Get("ETag") != `"etag-dir/a.txt"` ||
+		rec.Header().Get("Cache-Control") != "max-age=60" {
+		t.Errorf("unexpected response: %d %v %s", rec.Code, rec.Header(), rec.Body)
+	}
+
+	rec = serve(http.MethodGet, "/a.txt", map[string]string{"Range": "bytes=2-4"})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "234" || rec.Header().Get("Content-Range") != "bytes 2-4/10" {
+		t.Errorf("unexpected range response: %d %v %s", rec.Code, rec.Header(), rec.Body)
+	}
+
+	rec = serve(http.MethodGet, "/a.txt", map[string]string{"If-None-Match": `"etag-dir/a.txt"`})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("unexpected conditional response: %d %s", rec.Code, rec.Body)
+	}
+	rec = serve(http.MethodGet, "/a.txt", map[string]string{"If-None-Match": `"other"`})
+	if rec.Code != http.StatusOK || rec.Body.String() != "0123456789" {
+		t.Errorf("changed object should be served: %d %s", rec.Code, rec.Body)
+	}
+
+	rec = serve(http.MethodHead, "/a.txt", nil)
+	if rec.Code != http.StatusOK || rec.Body.Len() != 0 || rec.Header().Get("Content-Length") != "10" {
+		t.Errorf("unexpected head response: %d %v %s", rec.Code, rec.Header(), rec.Body)
+	}
+
+	if rec = serve(http.MethodGet, "/missing.txt", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected: 404, got: %d", rec.Code)
+	}
+}
@@ -0,0 +1,151 @@
+package oss
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 图片处理：缩放、裁剪、旋转、格式转换、质量、文字水印，以及视频截帧
+// 按添加顺序渲染为阿里云的x-oss-process或华为的x-image-process参数，minio不支持
+// 公开地址使用EscapeProcessUrl，签名地址使用SignFile(key, expires, WithImageProcess(p))
+
+// 缩放模式
+const (
+	ResizeLfit  = "lfit"  // 等比缩放，限制在宽高内
+	ResizeMfit  = "mfit"  // 等比缩放，覆盖宽高
+	ResizeFill  = "fill"  // 等比缩放覆盖宽高后居中裁剪
+	ResizePad   = "pad"   // 等比缩放限制在宽高内后填充
+	ResizeFixed = "fixed" // 强制缩放到指定宽高
+)
+
+// TextWatermark 文字水印，为空的参数使用平台默认值
+type TextWatermark struct {
+	Text    string
+	Size    int    // 字体大小
+	Color   string // RGB颜色，如FFFFFF
+	Gravity string // 位置：nw、north、ne、west、center、east、sw、south、se
+	X, Y    int    // 距离边缘的水平、垂直距离
+}
+
+type ImageProcess struct {
+	actions  []string // 各平台语法一致的图片操作，如resize,m_lfit,w_100
+	snapshot string   // 视频截帧，只有阿里云支持，不能和图片操作一起使用
+}
+
+func NewImageProcess() *ImageProcess {
+	return &ImageProcess{}
+}
+
+func (p *ImageProcess) add(action string, params ...string) *ImageProcess {
+	p.actions = append(p.actions, strings.Join(append([]string{action}, params...), ","))
+	return p
+}
+
+// Resize 缩放，width、height为0表示不限制
+func (p *ImageProcess) Resize(mode string, width int, height int) *ImageProcess {
+	var params []string
+	if mode != "" {
+		params = append(params, "m_"+mode)
+	}
+	params = appendIntParam(params, "w_", width)
+	params = appendIntParam(params, "h_", height)
+	return p.add("resize", params...)
+}
+
+// Crop 从(x, y)开始裁剪，width、height为0表示到图片边缘
+func (p *ImageProcess) Crop(x int, y int, width int, height int) *ImageProcess {
+	params := []string{fmt.Sprintf("x_%d", x), fmt.Sprintf("y_%d", y)}
+	params = appendIntParam(params, "w_", width)
+	params = appendIntParam(params, "h_", height)
+	return p.add("crop", params...)
+}
+
+// Rotate 顺时针旋转，[0, 360]
+func (p *ImageProcess) Rotate(degree int) *ImageProcess {
+	return p.add("rotate", fmt.Sprint(degree))
+}
+
+// Format 转换格式，如jpg、png、webp
+func (p *ImageProcess) Format(format string) *ImageProcess {
+	return p.add("format", format)
+}
+
+// Quality 相对质量，[1, 100]
+func (p *ImageProcess) Quality(quality int) *ImageProcess {
+	return p.add("quality", fmt.Sprintf("q_%d", quality))
+}
+
+func (p *ImageProcess) Watermark(w TextWatermark) *ImageProcess {
+	params := []string{"text_" + base64.RawURLEncoding.EncodeToString([]byte(w.Text))}
+	params = appendIntParam(params, "size_", w.Size)
+	if w.Color != "" {
+		params = append(params, "color_"+strings.TrimPrefix(w.Color, "#"))
+	}
+	if w.Gravity != "" {
+		params = append(params, "g_"+w.Gravity)
+	}
+	params = appendIntParam(params, "x_", w.X)
+	params = appendIntParam(params, "y_", w.Y)
+	return p.add("watermark", params...)
+}
+
+// Snapshot 视频截帧，截取at时刻的关键帧，format为jpg或png，width、height为0表示按视频原始大小
+func (p *ImageProcess) Snapshot(at time.Duration, format string, width int, height int) *ImageProcess {
+	params := []string{"snapshot", fmt.Sprintf("t_%d", at.Milliseconds()), "f_" + format}
+	params = appendIntParam(params, "w_", width)
+	params = appendIntParam(params, "h_", height)
+	p.snapshot = strings.Join(append(params, "m_fast"), ",")
+	return p
+}
+
+// 渲染为对应平台的参数名和参数值
+func (p *ImageProcess) render(provider string) (string, string, error) {
+	var name string
+	switch provider {
+	case Aliyun:
+		name = "x-oss-process"
+	case Huawei:
+		name = "x-image-process"
+	default:
+		return "", "", ErrNotSupported
+	}
+	if p.snapshot != "" {
+		if provider != Aliyun {
+			return "", "", ErrNotSupported
+		}
+		if len(p.actions) > 0 {
+			return "", "", errors.New("video snapshot cannot be combined with image actions")
+		}
+		return name, "video/" + p.snapshot, nil
+	}
+	if len(p.actions) == 0 {
+		return "", "", errors.New("empty image process")
+	}
+	return name, "image/" + strings.Join(p.actions, "/"), nil
+}
+
+func appendIntParam(params []string, prefix string, value int) []string {
+	if value <= 0 {
+		return params
+	}
+	return append(params, fmt.Sprintf("%s%d", prefix, value))
+}
+
+// WithImageProcess 签名地址带上图片处理参数，用于SignFile
+var WithImageProcess = func(p *ImageProcess) Option {
+	return func(m *Metadata) {
+		m.process = p
+	}
+}
+
+// EscapeProcessUrl 公开读文件的图片处理地址，在EscapePreviewUrl的基础上添加处理参数
+func (o *Wrapper) EscapeProcessUrl(key string, p *ImageProcess) (string, error) {
+	name, value, err := p.render(o.oc.Provider)
+	if err != nil {
+		return "", err
+	}
+	return o.EscapePreviewUrl(key) + "?" + name + "=" + value, nil
+}
@@ -0,0 +1,44 @@
+package oss
+
+import (
+	"fmt"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestImageProcessRender(t *testing.T) {
+	p := NewImageProcess().Resize(ResizeLfit, 200, 0).Crop(10, 20, 100, 100).Rotate(90).
+		Format("webp").Quality(80).Watermark(TextWatermark{Text: "kits", Color: "#FFFFFF", Gravity: "se", X: 10})
+	expected := "image/resize,m_lfit,w_200/crop,x_10,y_20,w_100,h_100/rotate,90/format,webp/quality,q_80/" +
+		"watermark,text_a2l0cw,color_FFFFFF,g_se,x_10"
+	for provider, param := range map[string]string{Aliyun: "x-oss-process", Huawei: "x-image-process"} {
+		name, value, err := p.render(provider)
+		if err != nil || name != param || value != expected {
+			t.Errorf("provider: %s, got: %s=%s, err: %v", provider, name, value, err)
+		}
+	}
+	if _, _, err := p.render(MinIo); err != ErrNotSupported {
+		t.Errorf("minio should not be supported, err: %v", err)
+	}
+
+	snapshot := NewImageProcess().Snapshot(7*time.Second, "jpg", 800, 0)
+	if _, value, err := snapshot.render(Aliyun); err != nil || value != "video/snapshot,t_7000,f_jpg,w_800,m_fast" {
+		t.Errorf("unexpected snapshot: %s, err: %v", value, err)
+	}
+	if _, _, err := snapshot.render(Huawei); err != ErrNotSupported {
+		t.Errorf("obs snapshot should not be supported, err: %v", err)
+	}
+	if _, _, err := NewImageProcess().render(Aliyun); err == nil {
+		t.Error("empty process should fail")
+	}
+}
+
+func TestImageProcessUrl(t *testing.T) {
+	ossPath := path.Join(testDir, "image.png")
+	p := NewImageProcess().Resize(ResizeFill, 100, 100).Format("webp")
+	u, err := ossHelper.EscapeProcessUrl(ossPath, p)
+	fmt.Println("process url:", u, "err:", err)
+	u, err = ossHelper.SignFile(ossPath, time.Hour, WithImageProcess(p))
+	fmt.Println("signed process url:", u, "err:", err)
+}
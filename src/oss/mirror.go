@@ -0,0 +1,593 @@
+package oss
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/go_limit"
+	"github.com/hqmin9527/kits-go/src/grace_stop"
+	"github.com/hqmin9527/kits-go/src/logger"
+	"github.com/hqmin9527/kits-go/src/safe"
+	pkgerrors "github.com/pkg/errors"
+)
+
+// 多存储镜像（如阿里云 + 本地MinIO容灾）
+// 1. 写入：先写主存储，成功后写备份；同步模式下直接对备份执行相同的操作，异步模式下把需要同步的key持久化到本地队列，由后台协程重试直到成功
+// 2. 读取：主存储出错或超时时依次读取备份，文件不存在时不切换，以主存储为准
+// 3. 修复：Reconcile对比主备的列举结果和ETag，复制缺失或不一致的文件，删除备份中多余的文件
+// 异步同步和修复都是从主存储读取最新的文件写入备份，重复执行没有副作用
+
+var errMirrorReadTimeout = errors.New("oss mirror read timeout")
+
+const (
+	defaultMirrorRetryInterval = time.Minute
+	mirrorTaskExt              = ".json"
+)
+
+// Mirror 主备双写的Wrapper，默认同步写入
+type Mirror struct {
+	primary     *Wrapper
+	secondaries []*Wrapper
+	readTimeout time.Duration
+	queue       *mirrorQueue // 为nil时同步写入
+	stop        chan struct{}
+	once        sync.Once
+}
+
+// 需要同步到备份的key
+type mirrorTask struct {
+	Target int    `json:"target"` // secondaries的下标
+	Key    string `json:"key"`
+	Folder bool   `json:"folder"` // Key为目录，同步整个目录
+}
+
+// 持久化的重试队列，每个任务保存为dir下的一个文件，同步成功后删除
+type mirrorQueue struct {
+	dir           string
+	retryInterval time.Duration
+	notify        chan struct{}
+	mu            sync.Mutex
+	seq           uint64
+}
+
+func NewMirror(primary *Wrapper, secondaries ...*Wrapper) *Mirror {
+	return &Mirror{primary: primary, secondaries: secondaries, stop: make(chan struct{})}
+}
+
+func (m *Mirror) Primary() *Wrapper {
+	return m.primary
+}
+
+// SetReadTimeout 读取主存储超过timeout时切换到备份，0表示不限制
+// GetReader、GetRange只限制获取reader的时间，不限制读取数据的时间
+func (m *Mirror) SetReadTimeout(timeout time.Duration) *Mirror {
+	m.readTimeout = timeout
+	return m
+}
+
+// EnableAsync 异步写入备份，queueDir保存未完成的同步任务，重启后继续同步
+// 同步失败时每隔retryInterval重试，retryInterval<=0时为1分钟
+func (m *Mirror) EnableAsync(queueDir string, retryInterval time.Duration) error {
+	if err := os.MkdirAll(queueDir, 0755); err != nil {
+		return err
+	}
+	if retryInterval <= 0 {
+		retryInterval = defaultMirrorRetryInterval
+	}
+	m.queue = &mirrorQueue{dir: queueDir, retryInterval: retryInterval, notify: make(chan struct{}, 1)}
+	go safe.Safego(m.runQueue, "oss mirror queue")
+	return nil
+}
+
+// StartReconciler 每隔interval修复一次prefix下的文件
+func (m *Mirror) StartReconciler(prefix string, interval time.Duration) {
+	go safe.Safego(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				return
+			case <-grace_stop.GetStopChan():
+				return
+			case <-ticker.C:
+				n, err := m.Reconcile(prefix)
+				if err != nil {
+					logger.Error("oss mirror reconcile failed, repaired: %d, err: %s", n, err)
+				} else if n > 0 {
+					logger.Info("oss mirror reconcile success, repaired: %d", n)
+				}
+			}
+		}
+	}, "oss mirror reconciler")
+}
+
+// Close 停止后台的同步和修复协程，未完成的同步任务保留在队列中
+func (m *Mirror) Close() {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+}
+
+// Pending 队列中未完成的同步任务数
+func (m *Mirror) Pending() int {
+	if m.queue == nil {
+		return 0
+	}
+	names, _ := m.queue.list()
+	return len(names)
+}
+
+func (m *Mirror) GetObject(key string, options ...Option) ([]byte, error) {
+	v, err := m.read(func(w *Wrapper) (any, error) {
+		return w.GetObject(key, options...)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return v.([]byte), nil
+}
+
+func (m *Mirror) GetFile(key string, localFile string, options ...Option) error {
+	r, err := m.GetReader(key, options...)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	fd, err := os.Create(localFile)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = fd.Close()
+	}()
+	_, err = io.Copy(fd, r)
+	return err
+}
+
+// GetReader 使用完需要Close
+func (m *Mirror) GetReader(key string, options ...Option) (io.ReadCloser, error) {
+	return m.GetRange(key, 0, -1, options...)
+}
+
+// GetRange 读取[offset, offset+length)范围的数据，length<0表示读到结尾，使用完需要Close
+func (m *Mirror) GetRange(key string, offset int64, length int64, options ...Option) (io.ReadCloser, error) {
+	v, err := m.read(func(w *Wrapper) (any, error) {
+		return w.GetRange(key, offset, length, options...)
+	}, func(v any) {
+		_ = v.(io.ReadCloser).Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return v.(io.ReadCloser), nil
+}
+
+func (m *Mirror) GetObjectMeta(key string, options ...Option) (*FileMeta, error) {
+	v, err := m.read(func(w *Wrapper) (any, error) {
+		return w.GetObjectMeta(key, options...)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return v.(*FileMeta), nil
+}
+
+func (m *Mirror) IsObjectExist(key string) (bool, error) {
+	v, err := m.read(func(w *Wrapper) (any, error) {
+		return w.IsObjectExist(key)
+	}, nil)
+	if err != nil {
+		return false, err
+	}
+	return v.(bool), nil
+}
+
+func (m *Mirror) ListObjects(prefix string) ([]FileMeta, error) {
+	v, err := m.read(func(w *Wrapper) (any, error) {
+		return w.ListObjects(prefix)
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return v.([]FileMeta), nil
+}
+
+func (m *Mirror) PutObject(key string, data []byte, options ...Option) error {
+	return m.write(func(w *Wrapper) error {
+		return w.PutObject(key, data, options...)
+	}, func(w *Wrapper) error {
+		return w.PutObject(key, data, replicaOptions(options)...)
+	}, mirrorTask{Key: key})
+}
+
+func (m *Mirror) PutFile(key string, filePath string, options ...Option) error {
+	return m.write(func(w *Wrapper) error {
+		return w.PutFile(key, filePath, options...)
+	}, func(w *Wrapper) error {
+		return w.PutFile(key, filePath, replicaOptions(options)...)
+	}, mirrorTask{Key: key})
+}
+
+// PutReader reader只能读取一次，备份从主存储复制
+func (m *Mirror) PutReader(key string, r io.Reader, options ...Option) error {
+	return m.write(func(w *Wrapper) error {
+		return w.PutReader(key, r, options...)
+	}, func(w *Wrapper) error {
+		return m.syncKey(w, key)
+	}, mirrorTask{Key: key})
+}
+
+func (m *Mirror) DeleteObject(key string) error {
+	return m.write(func(w *Wrapper) error {
+		return w.DeleteObject(key)
+	}, nil, mirrorTask{Key: key})
+}
+
+func (m *Mirror) DeleteFolder(remoteDir string) error {
+	return m.write(func(w *Wrapper) error {
+		return w.DeleteFolder(remoteDir)
+	}, nil, mirrorTask{Key: remoteDir, Folder: true})
+}
+
+func (m *Mirror) CopyObject(srcKey string, destKey string, options ...Option) error {
+	return m.write(func(w *Wrapper) error {
+		return w.CopyObject(srcKey, destKey, options...)
+	}, func(w *Wrapper) error {
+		return w.CopyObject(srcKey, destKey, replicaOptions(options)...)
+	}, mirrorTask{Key: destKey})
+}
+
+func (m *Mirror) CopyFolder(remoteDir string, remoteDistDir string) error {
+	return m.write(func(w *Wrapper) error {
+		return w.CopyFolder(remoteDir, remoteDistDir)
+	}, nil, mirrorTask{Key: remoteDistDir, Folder: true})
+}
+
+func (m *Mirror) Move(srcKey string, destKey string) error {
+	return m.write(func(w *Wrapper) error {
+		return w.Move(srcKey, destKey)
+	}, nil, mirrorTask{Key: srcKey}, mirrorTask{Key: destKey})
+}
+
+func (m *Mirror) MoveFolder(remoteDir string, remoteDistDir string) error {
+	return m.write(func(w *Wrapper) error {
+		return w.MoveFolder(remoteDir, remoteDistDir)
+	}, nil, mirrorTask{Key: remoteDir, Folder: true}, mirrorTask{Key: remoteDistDir, Folder: true})
+}
+
+func (m *Mirror) SetObjectMeta(ossPath string, options ...Option) error {
+	return m.write(func(w *Wrapper) error {
+		return w.SetObjectMeta(ossPath, options...)
+	}, nil, mirrorTask{Key: ossPath})
+}
+
+func (m *Mirror) SetFolderMeta(remoteDir string, options ...Option) error {
+	return m.write(func(w *Wrapper) error {
+		return w.SetFolderMeta(remoteDir, options...)
+	}, nil, mirrorTask{Key: remoteDir, Folder: true})
+}
+
+// Reconcile 修复所有备份中prefix下和主存储不一致的文件，返回修复的文件数
+func (m *Mirror) Reconcile(prefix string) (int, error) {
+	total := 0
+	var firstErr error
+	for _, target := range m.secondaries {
+		n, err := m.reconcile(target, prefix)
+		total += n
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return total, firstErr
+}
+
+// 依次读取主存储和备份，出错或超时时切换，文件不存在时直接返回
+func (m *Mirror) read(f func(w *Wrapper) (any, error), release func(v any)) (any, error) {
+	var err error
+	for i, w := range append([]*Wrapper{m.primary}, m.secondaries...) {
+		var v any
+		v, err = m.readWithTimeout(w, f, release)
+		if err == nil || IsNotFound(err) {
+			return v, err
+		}
+		logger.Warn("oss mirror read from %d failed, bucket: %s, err: %s", i, w.GetBucketName(), err)
+	}
+	return nil, err
+}
+
+// 超时后的结果由后台协程通过release释放
+func (m *Mirror) readWithTimeout(w *Wrapper, f func(w *Wrapper) (any, error), release func(v any)) (any, error) {
+	if m.readTimeout <= 0 {
+		return f(w)
+	}
+	type result struct {
+		v   any
+		err error
+	}
+	ch := make(chan result, 1)
+	go safe.Safego(func() {
+		v, err := f(w)
+		ch <- result{v: v, err: err}
+	}, "oss mirror read")
+
+	timer := time.NewTimer(m.readTimeout)
+	defer timer.Stop()
+	select {
+	case res := <-ch:
+		return res.v, res.err
+	case <-timer.C:
+		if release != nil {
+			go func() {
+				if res := <-ch; res.err == nil {
+					release(res.v)
+				}
+			}()
+		}
+		return nil, errMirrorReadTimeout
+	}
+}
+
+// 条件写入只对主存储判断，备份的文件可能落后于主存储，直接覆盖
+func replicaOptions(options []Option) []Option {
+	return append(options[:len(options):len(options)], withoutCondition)
+}
+
+// 写入主存储后同步到备份，replicate为nil时对备份执行op
+// 同步模式下备份写入失败时返回错误，此时主存储已经写入成功，可以由Reconcile修复
+func (m *Mirror) write(op func(w *Wrapper) error, replicate func(w *Wrapper) error, tasks ...mirrorTask) error {
+	if err := op(m.primary); err != nil {
+		return err
+	}
+	if m.queue != nil {
+		return m.queue.push(len(m.secondaries), tasks)
+	}
+	if replicate == nil {
+		replicate = op
+	}
+	goLimit := go_limit.New(goLimitCount)
+	for _, target := range m.secondaries {
+		targetTmp := target
+		goLimit.RunError(func() error {
+			if err := replicate(targetTmp); err != nil {
+				logger.Error("oss mirror write failed, bucket: %s, err: %s", targetTmp.GetBucketName(), err)
+				return pkgerrors.Wrapf(err, "oss mirror write %s failed", targetTmp.GetBucketName())
+			}
+			return nil
+		})
+	}
+	goLimit.Wait()
+	return goLimit.FirstError()
+}
+
+func (m *Mirror) runQueue() {
+	ticker := time.NewTicker(m.queue.retryInterval)
+	defer ticker.Stop()
+	for {
+		m.drain()
+		select {
+		case <-m.stop:
+			return
+		case <-grace_stop.GetStopChan():
+			return
+		case <-m.queue.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// 执行队列中的所有任务，失败的任务等待下次重试
+func (m *Mirror) drain() {
+	names, err := m.queue.list()
+	if err != nil {
+		logger.Error("oss mirror list queue failed, err: %s", err)
+		return
+	}
+	goLimit := go_limit.New(goLimitCount)
+	for _, name := range names {
+		nameTmp := name
+		goLimit.Run(func() {
+			task, err := m.queue.load(nameTmp)
+			if err == nil {
+				err = m.replay(task)
+			}
+			if err != nil {
+				logger.Warn("oss mirror sync failed, task: %s, err: %s", nameTmp, err)
+				return
+			}
+			m.queue.remove(nameTmp)
+		})
+	}
+	goLimit.Wait()
+}
+
+func (m *Mirror) replay(task *mirrorTask) error {
+	if task.Target < 0 || task.Target >= len(m.secondaries) {
+		return fmt.Errorf("oss mirror target %d not found", task.Target)
+	}
+	target := m.secondaries[task.Target]
+	if task.Folder {
+		_, err := m.reconcile(target, task.Key)
+		return err
+	}
+	return m.syncKey(target, task.Key)
+}
+
+// 按主存储中key的当前状态同步备份：不存在时删除，不一致时复制
+func (m *Mirror) syncKey(target *Wrapper, key string) error {
+	src, err := m.primary.GetObjectMeta(key)
+	if IsNotFound(err) {
+		if err = target.DeleteObject(key); IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if dest, err := target.GetObjectMeta(key); err == nil && sameObject(src, dest) {
+		return nil
+	}
+	return m.copyTo(target, src)
+}
+
+// 先列举备份再列举主存储，避免把两次列举之间新写入的文件当作多余的文件删除
+func (m *Mirror) reconcile(target *Wrapper, prefix string) (int, error) {
+	destList, err := target.ListObjects(prefix)
+	if err != nil {
+		return 0, err
+	}
+	srcList, err := m.primary.ListObjects(prefix)
+	if err != nil {
+		return 0, err
+	}
+	dest := make(map[string]FileMeta, len(destList))
+	for _, meta := range destList {
+		dest[meta.Key] = meta
+	}
+
+	var mu sync.Mutex
+	count := 0
+	goLimit := go_limit.New(goLimitCount)
+	repair := func(f func() error) {
+		goLimit.RunError(func() error {
+			if err := f(); err != nil {
+				return err
+			}
+			mu.Lock()
+			count++
+			mu.Unlock()
+			return nil
+		})
+	}
+	for _, src := range srcList {
+		d, ok := dest[src.Key]
+		delete(dest, src.Key)
+		if ok && sameObject(&src, &d) {
+			continue
+		}
+		// 列举结果中没有Content-Type等元数据，需要重新获取
+		keyTmp := src.Key
+		repair(func() error {
+			return m.syncKey(target, keyTmp)
+		})
+	}
+	for k := range dest {
+		keyTmp := k
+		repair(func() error {
+			return target.DeleteObject(keyTmp)
+		})
+	}
+	goLimit.Wait()
+	return count, goLimit.FirstError()
+}
+
+// 从主存储读取文件写入备份，保留Content-Type等元数据，压缩的文件不解压
+func (m *Mirror) copyTo(target *Wrapper, src *FileMeta) error {
+	r, err := m.primary.GetReader(src.Key, RawContent)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	md := &Metadata{
+		ContentType:        src.ContentType,
+		ContentEncoding:    src.ContentEncoding,
+		ContentDisposition: src.ContentDisposition,
+		Acl:                src.Acl,
+		UserMeta:           src.UserMeta,
+	}
+	return target.st.PutReaderWithMeta(target.oc.Bucket, target.fullKey(src.Key), r, md)
+}
+
+// 分片上传的ETag（带"-"）和分片大小有关，不同平台不可比较，此时只比较大小
+func sameObject(a *FileMeta, b *FileMeta) bool {
+	etagA := strings.ToLower(strings.Trim(a.ETag, "\""))
+	etagB := strings.ToLower(strings.Trim(b.ETag, "\""))
+	if etagA == "" || etagB == "" || strings.Contains(etagA, "-") || strings.Contains(etagB, "-") {
+		return a.Size == b.Size
+	}
+	return etagA == etagB
+}
+
+// 为每个备份保存一个任务
+func (q *mirrorQueue) push(targets int, tasks []mirrorTask) error {
+	for target := 0; target < targets; target++ {
+		for _, task := range tasks {
+			task.Target = target
+			if err := q.save(&task); err != nil {
+				return err
+			}
+		}
+	}
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// 先写临时文件再重命名，避免读到不完整的任务
+func (q *mirrorQueue) save(task *mirrorTask) error {
+	data, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	q.mu.Lock()
+	q.seq++
+	name := fmt.Sprintf("%019d-%06d%s", time.Now().UnixNano(), q.seq%1000000, mirrorTaskExt)
+	q.mu.Unlock()
+	file := filepath.Join(q.dir, name)
+	if err = os.WriteFile(file+".tmp", data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+// 按写入顺序返回任务文件名
+func (q *mirrorQueue) list() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), mirrorTaskExt) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (q *mirrorQueue) load(name string) (*mirrorTask, error) {
+	data, err := os.ReadFile(filepath.Join(q.dir, name))
+	if err != nil {
+		return nil, err
+	}
+	task := &mirrorTask{}
+	if err = json.Unmarshal(data, task); err != nil {
+		// 无法解析的任务重试也不会成功，直接删除
+		logger.Error("oss mirror drop invalid task: %s, err: %s", name, err)
+		q.remove(name)
+		return nil, err
+	}
+	return task, nil
+}
+
+func (q *mirrorQueue) remove(name string) {
+	if err := os.Remove(filepath.Join(q.dir, name)); err != nil && !os.IsNotExist(err) {
+		logger.Error("oss mirror remove task failed: %s, err: %s", name, err)
+	}
+}
@@ -0,0 +1,180 @@
+package oss
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v6"
+)
+
+func (m *memStorager) GetObject(bucket string, key string, metadata *Metadata) ([]byte, error) {
+	_, data, err := m.meta(key)
+	return data, err
+}
+
+func (m *memStorager) PutObjectWithMeta(bucket string, key string, data []byte, metadata *Metadata) error {
+	if m.down.Load() {
+		return io.ErrUnexpectedEOF
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old, ok := m.objects[key]; metadata.hasCondition() &&
+		((metadata.forbidOverwrite && ok) || (metadata.ifMatch != "" && metadata.ifMatch != QuoteETag(fmt.Sprintf("%x", old)))) {
+		return minio.ErrorResponse{StatusCode: 412}
+	}
+	m.objects[key] = data
+	delete(m.encs, key)
+	if metadata.ContentEncoding != "" {
+		if m.encs == nil {
+			m.encs = make(map[string]string)
+		}
+		m.encs[key] = metadata.ContentEncoding
+	}
+	delete(m.users, key)
+	if len(metadata.UserMeta) > 0 {
+		if m.users == nil {
+			m.users = make(map[string]map[string]string)
+		}
+		m.users[key] = metadata.UserMeta
+	}
+	return nil
+}
+
+func (m *memStorager) PutReaderWithMeta(bucket string, key string, r io.Reader, metadata *Metadata) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return m.PutObjectWithMeta(bucket, key, data, metadata)
+}
+
+func (m *memStorager) DeleteObject(bucket string, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.objects, key)
+	return nil
+}
+
+func (m *memStorager) ListObjects(bucket string, prefix string) ([]FileMeta, error) {
+	m.mu.Lock()
+	keys := make([]string, 0, len(m.objects))
+	for k := range m.objects {
+		keys = append(keys, k)
+	}
+	m.mu.Unlock()
+	var res []FileMeta
+	for _, k := range keys {
+		if meta, _, err := m.meta(k); err == nil && len(k) >= len(prefix) && k[:len(prefix)] == prefix {
+			// 和各平台一样，列举结果中没有元数据
+			meta.Metadata = Metadata{}
+			res = append(res, *meta)
+		}
+	}
+	return res, nil
+}
+
+func newMemWrapper() (*Wrapper, *memStorager) {
+	st := &memStorager{objects: map[string][]byte{}}
+	return &Wrapper{st: st, oc: &Config{Bucket: "bucket"}}, st
+}
+
+func TestMirror(t *testing.T) {
+	primary, pst := newMemWrapper()
+	secondary, sst := newMemWrapper()
+	m := NewMirror(primary, secondary)
+
+	// 同步写入
+	if err := m.PutObject("a", []byte("aaaa")); err != nil || string(sst.objects["a"]) != "aaaa" {
+		t.Errorf("secondary should be written, err: %v", err)
+	}
+	// 条件写入只对主存储判断，备份中的旧文件直接覆盖
+	sst.put("new", []byte("stale"))
+	if err := m.PutObject("new", []byte("new"), NoOverwrite); err != nil || string(sst.objects["new"]) != "new" {
+		t.Errorf("secondary should be overwritten, data: %s, err: %v", sst.objects["new"], err)
+	}
+	if err := m.PutObject("new", []byte("again"), NoOverwrite); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("primary condition should be checked, err: %v", err)
+	}
+
+	// 主存储不可用时读取备份，文件不存在时不切换
+	pst.down.Store(true)
+	if data, err := m.GetObject("a"); err != nil || string(data) != "aaaa" {
+		t.Errorf("read should fail over, data: %s, err: %v", data, err)
+	}
+	pst.down.Store(false)
+	sst.put("only-secondary", []byte("x"))
+	if _, err := m.GetObject("only-secondary"); !IsNotFound(err) {
+		t.Errorf("not found should not fail over, err: %v", err)
+	}
+
+	// 修复：复制不一致的文件，删除多余的文件
+	sst.put("a", []byte("stale"))
+	pst.put("b", []byte("bbbb"))
+	_ = primary.PutObject("c.json", []byte(`{"c":1}`), Compress)
+	n, err := m.Reconcile("")
+	if sst.encs["c.json"] != encodingGzip {
+		t.Errorf("metadata should be copied, encoding: %s", sst.encs["c.json"])
+	}
+	if err != nil || n != 4 || string(sst.objects["a"]) != "aaaa" || string(sst.objects["b"]) != "bbbb" ||
+		sst.objects["only-secondary"] != nil {
+		t.Errorf("reconcile result not expected, repaired: %d, err: %v, secondary: %v", n, err, sst.objects)
+	}
+}
+
+func TestMirrorAsync(t *testing.T) {
+	primary, _ := newMemWrapper()
+	secondary, sst := newMemWrapper()
+	dir := t.TempDir()
+
+	// 备份不可用时任务保留在队列中
+	sst.down.Store(true)
+	m := NewMirror(primary, secondary)
+	if err := m.EnableAsync(dir, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.PutObject("a", []byte("aaaa")); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	m.Close()
+	if m.Pending() != 1 {
+		t.Fatalf("task should be kept in queue, pending: %d", m.Pending())
+	}
+
+	// 重启后继续同步
+	sst.down.Store(false)
+	m = NewMirror(primary, secondary)
+	if err := m.EnableAsync(dir, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	deadline := time.Now().Add(time.Second)
+	for m.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	sst.mu.Lock()
+	defer sst.mu.Unlock()
+	if m.Pending() != 0 || string(sst.objects["a"]) != "aaaa" {
+		t.Errorf("queued task should be replayed, pending: %d", m.Pending())
+	}
+}
+
+func TestSameObject(t *testing.T) {
+	cases := []struct {
+		a, b     FileMeta
+		expected bool
+	}{
+		{FileMeta{ETag: "\"ABC\"", Size: 1}, FileMeta{ETag: "abc", Size: 1}, true},
+		{FileMeta{ETag: "abc", Size: 1}, FileMeta{ETag: "abd", Size: 1}, false},
+		{FileMeta{ETag: "abc-2", Size: 10}, FileMeta{ETag: "def", Size: 10}, true},
+		{FileMeta{ETag: "abc-2", Size: 10}, FileMeta{ETag: "def", Size: 11}, false},
+	}
+	for _, c := range cases {
+		if sameObject(&c.a, &c.b) != c.expected {
+			t.Errorf("a: %+v, b: %+v, expected: %v", c.a, c.b, c.expected)
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package oss
+
+import (
+	"errors"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/go_limit"
+	"github.com/hqmin9527/kits-go/src/logger"
+)
+
+// 分片上传管理
+// 1. 服务端协调客户端直传：InitiateMultipartUpload -> PresignUploadPart（客户端PUT分片） -> ListParts -> CompleteMultipartUpload
+// 2. 中断的分片上传会一直占用存储并计费，定期调用CleanupIncompleteUploads清理，或在bucket生命周期中配置AbortMultipartDays
+
+const (
+	maxPartNumber          = 10000              // 各平台分片号的范围都是1~10000
+	multipartCopyThreshold = 1024 * 1024 * 1024 // 超过1GB时分片复制，阿里云单次复制最大1GB，其他平台最大5GB
+)
+
+// MultipartUpload 未完成的分片上传
+type MultipartUpload struct {
+	Key       string
+	UploadID  string
+	Initiated time.Time
+}
+
+// UploadedPart 已上传的分片，完成分片上传时只需要PartNumber和ETag
+type UploadedPart struct {
+	PartNumber   int
+	ETag         string
+	Size         int64
+	LastModified time.Time
+}
+
+// InitiateMultipartUpload 初始化分片上传，返回uploadID，options中的元数据、ACL、服务端加密作用于最终的文件
+func (o *Wrapper) InitiateMultipartUpload(key string, options ...Option) (string, error) {
+	checkKey(key)
+	return o.st.InitiateMultipartUpload(o.oc.Bucket, o.fullKey(key), buildMetadata(options))
+}
+
+// UploadPart 上传一个分片，partNumber为1~10000，除最后一个分片外每个分片至少100KB（MinIO为5MB）
+// SSE-C加密时options需要传入和初始化时相同的密钥
+func (o *Wrapper) UploadPart(key string, uploadID string, partNumber int, r io.Reader, size int64,
+	options ...Option) (*UploadedPart, error) {
+	if err := checkPartNumber(partNumber); err != nil {
+		return nil, err
+	}
+	etag, err := o.st.UploadPart(o.oc.Bucket, o.fullKey(key), uploadID, partNumber, r, size, buildMetadata(options))
+	if err != nil {
+		return nil, err
+	}
+	return &UploadedPart{PartNumber: partNumber, ETag: etag, Size: size, LastModified: time.Now()}, nil
+}
+
+// PresignUploadPart 上传分片的签名地址，客户端使用PUT请求上传，响应头中的ETag用于完成分片上传
+func (o *Wrapper) PresignUploadPart(key string, uploadID string, partNumber int, expires time.Duration) (string, error) {
+	if err := checkPartNumber(partNumber); err != nil {
+		return "", err
+	}
+	return o.st.PresignUploadPart(o.oc.Bucket, o.fullKey(key), uploadID, partNumber, expires)
+}
+
+// CompleteMultipartUpload 合并分片，parts可以乱序，为空时使用ListParts的结果
+// 可以使用NoOverwrite避免覆盖已存在的文件
+func (o *Wrapper) CompleteMultipartUpload(key string, uploadID string, parts []UploadedPart, options ...Option) error {
+	if len(parts) == 0 {
+		var err error
+		if parts, err = o.ListParts(key, uploadID); err != nil {
+			return err
+		}
+		if len(parts) == 0 {
+			return errors.New("oss multipart upload has no parts")
+		}
+	}
+	return preconditionError(o.st.CompleteMultipartUpload(o.oc.Bucket, o.fullKey(key), uploadID,
+		sortParts(parts), buildMetadata(options)))
+}
+
+// AbortMultipartUpload 取消分片上传，删除已上传的分片
+func (o *Wrapper) AbortMultipartUpload(key string, uploadID string) error {
+	return o.st.AbortMultipartUpload(o.oc.Bucket, o.fullKey(key), uploadID)
+}
+
+// ListMultipartUploads 列举prefix下未完成的分片上传
+func (o *Wrapper) ListMultipartUploads(prefix string) ([]MultipartUpload, error) {
+	uploads, err := o.st.ListMultipartUploads(o.oc.Bucket, o.fullKey(prefix))
+	for i := range uploads {
+		uploads[i].Key = o.relKey(uploads[i].Key)
+	}
+	return uploads, err
+}
+
+// ListParts 列举已上传的分片，按分片号升序
+func (o *Wrapper) ListParts(key string, uploadID string) ([]UploadedPart, error) {
+	parts, err := o.st.ListParts(o.oc.Bucket, o.fullKey(key), uploadID)
+	if err != nil {
+		return nil, err
+	}
+	return sortParts(parts), nil
+}
+
+// CleanupIncompleteUploads 取消当前作用域下初始化时间超过olderThan的分片上传，返回取消的数量
+func (o *Wrapper) CleanupIncompleteUploads(olderThan time.Duration) (int, error) {
+	uploads, err := o.ListMultipartUploads("")
+	if err != nil {
+		return 0, err
+	}
+	deadline := time.Now().Add(-olderThan)
+	var mu sync.Mutex
+	count := 0
+	goLimit := go_limit.New(goLimitCount)
+	for _, upload := range uploads {
+		if !upload.Initiated.Before(deadline) {
+			continue
+		}
+		uploadTmp := upload
+		goLimit.RunError(func() error {
+			if err := o.AbortMultipartUpload(uploadTmp.Key, uploadTmp.UploadID); err != nil {
+				return err
+			}
+			mu.Lock()
+			count++
+			mu.Unlock()
+			return nil
+		})
+	}
+	goLimit.Wait()
+	return count, goLimit.FirstError()
+}
+
+// 复制bucket中的完整key，源文件超过multipartCopyThreshold时分片复制
+func (o *Wrapper) copyObject(srcKey string, destKey string, md *Metadata) error {
+	size := md.srcSize
+	if size <= 0 {
+		// 只获取大小，不需要ACL
+		src, err := o.st.HeadObject(o.oc.Bucket, srcKey, md)
+		if err != nil {
+			return err
+		}
+		size = src.Size
+	}
+	if size <= multipartCopyThreshold {
+		return o.st.CopyObject(o.oc.Bucket, srcKey, destKey, md)
+	}
+	return o.multipartCopy(srcKey, destKey, size, md)
+}
+
+// 分片复制，并发复制各个分片，失败时取消分片上传
+// 目标文件保留源文件的元数据和ACL，md中非空的字段覆盖，和单次复制的结果一致
+func (o *Wrapper) multipartCopy(srcKey string, destKey string, size int64, md *Metadata) error {
+	src, err := o.st.GetObjectMeta(o.oc.Bucket, srcKey, md)
+	if err != nil {
+		return err
+	}
+	merged := mergeMetadata(src.Metadata, md)
+	merged.versionID, merged.forbidOverwrite, merged.ifMatch = md.versionID, md.forbidOverwrite, md.ifMatch
+	uploadID, err := o.st.InitiateMultipartUpload(o.oc.Bucket, destKey, &merged)
+	if err != nil {
+		return err
+	}
+
+	partSize := copyPartSize(size)
+	parts := make([]UploadedPart, (size+partSize-1)/partSize)
+	goLimit := go_limit.New(goLimitCount)
+	for i := range parts {
+		index := i
+		goLimit.RunError(func() error {
+			offset := int64(index) * partSize
+			partLen := min(partSize, size-offset)
+			etag, err := o.st.UploadPartCopy(o.oc.Bucket, srcKey, destKey, uploadID, index+1, offset, partLen, &merged)
+			if err != nil {
+				return err
+			}
+			parts[index] = UploadedPart{PartNumber: index + 1, ETag: etag, Size: partLen}
+			return nil
+		})
+	}
+	goLimit.Wait()
+	err = goLimit.FirstError()
+	if err == nil {
+		err = o.st.CompleteMultipartUpload(o.oc.Bucket, destKey, uploadID, parts, &merged)
+	}
+	if err != nil {
+		if abortErr := o.st.AbortMultipartUpload(o.oc.Bucket, destKey, uploadID); abortErr != nil {
+			logger.Error("[OSS] abort multipart copy failed, key: %s, err: %s", destKey, abortErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// 分片复制的分片大小，分片数不超过maxPartNumber
+func copyPartSize(size int64) int64 {
+	return max(chunkSize, (size+maxPartNumber-1)/maxPartNumber)
+}
+
+func checkPartNumber(partNumber int) error {
+	if partNumber < 1 || partNumber > maxPartNumber {
+		return errors.New("oss part number should be between 1 and 10000")
+	}
+	return nil
+}
+
+// 合并分片时要求分片号升序，同一个分片号重复上传时保留后面的
+func sortParts(parts []UploadedPart) []UploadedPart {
+	res := make([]UploadedPart, 0, len(parts))
+	index := make(map[int]int, len(parts))
+	for _, part := range parts {
+		if i, ok := index[part.PartNumber]; ok {
+			res[i] = part
+			continue
+		}
+		index[part.PartNumber] = len(res)
+		res = append(res, part)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].PartNumber < res[j].PartNumber
+	})
+	return res
+}
@@ -0,0 +1,81 @@
+package oss
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestSortParts(t *testing.T) {
+	parts := sortParts([]UploadedPart{
+		{PartNumber: 3, ETag: "c"},
+		{PartNumber: 1, ETag: "a"},
+		{PartNumber: 2, ETag: "b"},
+		{PartNumber: 1, ETag: "a2"},
+	})
+	expected := []string{"a2", "b", "c"}
+	if len(parts) != len(expected) {
+		t.Fatalf("expected %d parts, got: %v", len(expected), parts)
+	}
+	for i, part := range parts {
+		if part.PartNumber != i+1 || part.ETag != expected[i] {
+			t.Errorf("unexpected part at %d: %+v", i, part)
+		}
+	}
+
+	for _, n := range []int{0, maxPartNumber + 1} {
+		if checkPartNumber(n) == nil {
+			t.Errorf("part number %d should be invalid", n)
+		}
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	ossPath := path.Join(testDir, "multipart.txt")
+	uploadID, err := ossHelper.InitiateMultipartUpload(ossPath, SetContentType("text/plain"))
+	if err != nil {
+		fmt.Println("initiate err:", err)
+		return
+	}
+	data := []byte("hello multipart")
+	part, err := ossHelper.UploadPart(ossPath, uploadID, 1, bytes.NewReader(data), int64(len(data)))
+	fmt.Println("part:", part, "err:", err)
+	u, err := ossHelper.PresignUploadPart(ossPath, uploadID, 2, time.Hour)
+	fmt.Println("presign part url:", u, "err:", err)
+
+	uploads, err := ossHelper.ListMultipartUploads(testDir)
+	fmt.Println("uploads:", uploads, "err:", err)
+	parts, err := ossHelper.ListParts(ossPath, uploadID)
+	fmt.Println("parts:", parts, "err:", err)
+
+	err = ossHelper.CompleteMultipartUpload(ossPath, uploadID, nil)
+	fmt.Println("complete err:", err)
+	content, err := ossHelper.GetObject(ossPath)
+	fmt.Println("content:", string(content), "err:", err)
+}
+
+func TestCleanupIncompleteUploads(t *testing.T) {
+	_, err := ossHelper.InitiateMultipartUpload(path.Join(testDir, "abandoned.txt"))
+	fmt.Println("initiate err:", err)
+	count, err := ossHelper.Sub(testDir).CleanupIncompleteUploads(0)
+	fmt.Println("cleanup count:", count, "err:", err)
+}
+
+func TestCopyPartSize(t *testing.T) {
+	cases := []struct {
+		size     int64
+		expected int64
+	}{
+		{multipartCopyThreshold + 1, chunkSize},
+		{100 * 1024 * 1024 * 1024, chunkSize},
+		{2 * 1024 * 1024 * 1024 * 1024, (2*1024*1024*1024*1024 + maxPartNumber - 1) / maxPartNumber},
+	}
+	for _, c := range cases {
+		partSize := copyPartSize(c.size)
+		if partSize != c.expected || (c.size+partSize-1)/partSize > maxPartNumber {
+			t.Errorf("size: %d, expected: %d, got: %d", c.size, c.expected, partSize)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package oss
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// ObjectReader 按需读取文件的ReadSeeker：第一次Read时才发起请求，从当前位置读到结尾
+// Seek到其他位置后，下一次Read会重新发起范围请求，适用于http.ServeContent等只读取部分内容的场景
+// 返回保存的数据，压缩的文件不会解压，需要按Meta().ContentEncoding处理
+type ObjectReader struct {
+	w      *Wrapper
+	key    string
+	md     *Metadata
+	meta   *FileMeta
+	offset int64
+	body   io.ReadCloser
+}
+
+// NewObjectReader 先获取文件信息（大小、修改时间），不会下载文件内容，使用完需要Close
+func (o *Wrapper) NewObjectReader(key string, options ...Option) (*ObjectReader, error) {
+	meta, err := o.GetObjectMeta(key, options...)
+	if err != nil {
+		return nil, err
+	}
+	return &ObjectReader{w: o, key: key, md: buildMetadata(options), meta: meta}, nil
+}
+
+func (r *ObjectReader) Size() int64 {
+	return r.meta.Size
+}
+
+func (r *ObjectReader) ModTime() time.Time {
+	return r.meta.LastModified
+}
+
+// Meta 文件信息，Key为作用域内的相对路径
+func (r *ObjectReader) Meta() *FileMeta {
+	return r.meta
+}
+
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.meta.Size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, _, err := r.w.getReader(r.key, r.offset, -1, r.md)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.meta.Size
+	default:
+		return 0, errors.New("oss object reader: invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("oss object reader: negative position")
+	}
+	// 位置变化后，丢弃当前的请求
+	if offset != r.offset && r.body != nil {
+		_ = r.body.Close()
+		r.body = nil
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+func (r *ObjectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
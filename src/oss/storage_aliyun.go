@@ -2,6 +2,8 @@ package oss
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -50,10 +52,10 @@ func createAliStsClient(endpoint string, accessKeyId string, accessKeySecret str
 	return client, err
 }
 
-func (a *aliStorager) GetObject(bucket string, key string) ([]byte, error) {
+func (a *aliStorager) GetObject(bucket string, key string, metadata *Metadata) ([]byte, error) {
 	bucketObj, _ := a.client.Bucket(bucket)
 
-	body, err := bucketObj.GetObject(key)
+	body, err := bucketObj.GetObject(key, aliReadOptions(metadata)...)
 	if err != nil {
 		logger.Error("oss get remote file failed, key: %s, err: %s", key, err)
 		return nil, err
@@ -71,10 +73,10 @@ func (a *aliStorager) GetObject(bucket string, key string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func (a *aliStorager) GetFile(bucket string, key string, localFile string) error {
+func (a *aliStorager) GetFile(bucket string, key string, localFile string, metadata *Metadata) error {
 	bucketObj, _ := a.client.Bucket(bucket)
 
-	body, err := bucketObj.GetObject(key)
+	body, err := bucketObj.GetObject(key, aliReadOptions(metadata)...)
 	if err != nil {
 		logger.Error("oss get remote file failed, key: %s, err: %s", key, err)
 		return err
@@ -101,6 +103,25 @@ func (a *aliStorager) GetFile(bucket string, key string, localFile string) error
 	return nil
 }
 
+func (a *aliStorager) GetReader(bucket string, key string, offset int64, length int64,
+	metadata *Metadata) (io.ReadCloser, *FileMeta, error) {
+
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	options := aliReadOptions(metadata)
+	if rng := formatRange(offset, length); rng != "" {
+		options = append(options, oss.NormalizedRange(rng))
+	}
+	result, err := bucketObj.DoGetObject(&oss.GetObjectRequest{ObjectKey: key}, options)
+	if err != nil {
+		logger.Error("oss get remote file failed, key: %s, err: %s", key, err)
+		return nil, nil, err
+	}
+	return result.Response, aliHeaderToFileMeta(key, result.Response.Headers), nil
+}
+
 func (a *aliStorager) PutObjectWithMeta(bucket string, key string, data []byte, metadata *Metadata) error {
 	return a.PutReaderWithMeta(bucket, key, bytes.NewReader(data), metadata)
 }
@@ -116,13 +137,7 @@ func (a *aliStorager) PutFileWithMeta(bucket string, key string, localFile strin
 		logger.Debug("file size over 100m, use multipart upload, ossPath: %s", key)
 		// 向上取整
 		chunkNum := (fi.Size() + chunkSize - 1) / chunkSize
-		if err := a.putFileByMultipart(bucket, key, localFile, int(chunkNum), metadata); err != nil {
-			return err
-		}
-		if err := a.SetObjectMeta(bucket, key, metadata); err != nil {
-			return err
-		}
-		return nil
+		return a.putFileByMultipart(bucket, key, localFile, int(chunkNum), metadata)
 	} else {
 		return a.putFileByDirect(bucket, key, localFile, metadata)
 	}
@@ -135,7 +150,7 @@ func (a *aliStorager) putFileByDirect(bucket string, key string, localFile strin
 	}
 
 	// TODO 测试PutObjectFromFile
-	options := buildOptions(metadata)
+	options := append(buildOptions(metadata), aliConditionOptions(metadata)...)
 	return bucketObj.PutObjectFromFile(key, localFile, options...)
 }
 
@@ -151,9 +166,8 @@ func (a *aliStorager) putFileByMultipart(bucket string, key string, localFile st
 	if err != nil {
 		return err
 	}
-	options := buildOptions(metadata)
-	// TODO 怀疑options在这里设置无效，应该设置在后面的 bucketObj.CompleteMultipartUpload
-	imr, err := bucketObj.InitiateMultipartUpload(key, options...)
+	// 元数据和服务端加密在初始化时设置，ACL和条件写入在完成时设置
+	imr, err := bucketObj.InitiateMultipartUpload(key, buildOptions(metadata)...)
 	if err != nil {
 		return err
 	}
@@ -170,7 +184,7 @@ func (a *aliStorager) putFileByMultipart(bucket string, key string, localFile st
 	for _, chunk := range chunks {
 		_, _ = fd.Seek(chunk.Offset, io.SeekStart)
 		// 调用UploadPart方法上传每个分片。
-		part, err := bucketObj.UploadPart(imr, fd, chunk.Size, chunk.Number)
+		part, err := bucketObj.UploadPart(imr, fd, chunk.Size, chunk.Number, aliSseCustomerOptions(metadata)...)
 		if err != nil {
 			return err
 		}
@@ -178,7 +192,7 @@ func (a *aliStorager) putFileByMultipart(bucket string, key string, localFile st
 	}
 
 	// 步骤3：完成分片上传。
-	cmr, err := bucketObj.CompleteMultipartUpload(imr, parts)
+	cmr, err := bucketObj.CompleteMultipartUpload(imr, parts, aliCompleteOptions(metadata)...)
 	logger.Debug("upload file, result is %v", cmr)
 	return err
 }
@@ -189,14 +203,21 @@ func (a *aliStorager) PutReaderWithMeta(bucket string, key string, r io.Reader,
 		return err
 	}
 
-	options := buildOptions(metadata)
+	options := append(buildOptions(metadata), aliConditionOptions(metadata)...)
 	return bucketObj.PutObject(key, r, options...)
 }
 
 func (a *aliStorager) ListObjects(bucket string, prefix string) ([]FileMeta, error) {
-	bucketObj, _ := a.client.Bucket(bucket)
-
 	result := make([]FileMeta, 0, 32)
+	err := a.WalkObjects(bucket, prefix, func(meta *FileMeta) error {
+		result = append(result, *meta)
+		return nil
+	})
+	return result, err
+}
+
+func (a *aliStorager) WalkObjects(bucket string, prefix string, fn func(meta *FileMeta) error) error {
+	bucketObj, _ := a.client.Bucket(bucket)
 
 	prefixOption := oss.Prefix(prefix)
 	maxKeys := oss.MaxKeys(1000)
@@ -205,11 +226,46 @@ func (a *aliStorager) ListObjects(bucket string, prefix string) ([]FileMeta, err
 
 		lsRes, err := bucketObj.ListObjectsV2(prefixOption, maxKeys, oss.ContinuationToken(continueToken))
 		if err != nil {
-			return result, err
+			return err
+		}
+		for _, val := range lsRes.Objects {
+			content := FileMeta{Key: val.Key, Size: val.Size, ETag: val.ETag, LastModified: val.LastModified,
+				StorageClass: StorageClass(val.StorageClass)}
+			if err = fn(&content); err != nil {
+				return err
+			}
+		}
+
+		if lsRes.IsTruncated {
+			continueToken = lsRes.NextContinuationToken
+		} else {
+			break
+		}
+	}
+	return nil
+}
+
+func (a *aliStorager) ListDir(bucket string, prefix string) ([]string, []FileMeta, error) {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var dirs []string
+	files := make([]FileMeta, 0, 32)
+	continueToken := ""
+	for {
+		lsRes, err := bucketObj.ListObjectsV2(oss.Prefix(prefix), oss.Delimiter("/"), oss.MaxKeys(1000),
+			oss.ContinuationToken(continueToken))
+		if err != nil {
+			return dirs, files, err
 		}
+		dirs = append(dirs, lsRes.CommonPrefixes...)
 		for _, val := range lsRes.Objects {
-			content := FileMeta{Key: val.Key, Size: val.Size, ETag: val.ETag, LastModified: val.LastModified}
-			result = append(result, content)
+			if val.Key == prefix {
+				continue
+			}
+			files = append(files, FileMeta{Key: val.Key, Size: val.Size, ETag: val.ETag, LastModified: val.LastModified})
 		}
 
 		if lsRes.IsTruncated {
@@ -218,7 +274,7 @@ func (a *aliStorager) ListObjects(bucket string, prefix string) ([]FileMeta, err
 			break
 		}
 	}
-	return result, nil
+	return dirs, files, nil
 }
 
 func (a *aliStorager) DeleteObject(bucket string, key string) error {
@@ -228,9 +284,24 @@ func (a *aliStorager) DeleteObject(bucket string, key string) error {
 	return err
 }
 
+func (a *aliStorager) DeleteObjectIfMatch(bucket string, key string, etag string) error {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return bucketObj.DeleteObject(key, oss.IfMatch(etag))
+}
+
 func (a *aliStorager) CopyObject(bucket string, srcKey string, destKey string, metadata *Metadata) error {
 	bucketObj, err := a.client.Bucket(bucket)
-	_, err = bucketObj.CopyObject(srcKey, destKey)
+	// 目标文件的服务端加密，以及SSE-C源文件的密钥
+	options := append(aliSseOptions(metadata), aliSseCopySourceOptions(metadata)...)
+	options = append(options, aliConditionOptions(metadata)...)
+	if metadata.hasVersionID() {
+		// 复制源文件的指定版本
+		options = append(options, oss.VersionId(metadata.versionID))
+	}
+	_, err = bucketObj.CopyObject(srcKey, destKey, options...)
 	if err != nil {
 		return err
 	}
@@ -241,6 +312,58 @@ func (a *aliStorager) CopyObject(bucket string, srcKey string, destKey string, m
 	return nil
 }
 
+func (a *aliStorager) SetBucketVersioning(bucket string, enabled bool) error {
+	status := utils.If(enabled, VersioningEnabled, VersioningSuspended)
+	return a.client.SetBucketVersioning(bucket, oss.VersioningConfig{Status: status})
+}
+
+func (a *aliStorager) GetBucketVersioning(bucket string) (string, error) {
+	result, err := a.client.GetBucketVersioning(bucket)
+	if err != nil {
+		return "", err
+	}
+	return result.Status, nil
+}
+
+func (a *aliStorager) ListObjectVersions(bucket string, prefix string) ([]FileMeta, error) {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]FileMeta, 0, 32)
+	keyMarker, versionIdMarker := "", ""
+	for {
+		lsRes, err := bucketObj.ListObjectVersions(oss.Prefix(prefix), oss.MaxKeys(1000),
+			oss.KeyMarker(keyMarker), oss.VersionIdMarker(versionIdMarker))
+		if err != nil {
+			return sortVersions(result), err
+		}
+		for _, val := range lsRes.ObjectVersions {
+			result = append(result, FileMeta{Key: val.Key, Size: val.Size, ETag: val.ETag, LastModified: val.LastModified,
+				VersionID: val.VersionId, IsLatest: val.IsLatest})
+		}
+		for _, val := range lsRes.ObjectDeleteMarkers {
+			result = append(result, FileMeta{Key: val.Key, LastModified: val.LastModified,
+				VersionID: val.VersionId, IsLatest: val.IsLatest, IsDeleteMarker: true})
+		}
+
+		if !lsRes.IsTruncated {
+			break
+		}
+		keyMarker, versionIdMarker = lsRes.NextKeyMarker, lsRes.NextVersionIdMarker
+	}
+	return sortVersions(result), nil
+}
+
+func (a *aliStorager) DeleteObjectVersion(bucket string, key string, versionID string) error {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return bucketObj.DeleteObject(key, oss.VersionId(versionID))
+}
+
 func (a *aliStorager) SetObjectAcl(bucket string, key string, acl ACL) error {
 	bucketObj, err := a.client.Bucket(bucket)
 	err = bucketObj.SetObjectACL(key, oss.ACLType(acl))
@@ -249,12 +372,24 @@ func (a *aliStorager) SetObjectAcl(bucket string, key string, acl ACL) error {
 }
 
 func (a *aliStorager) SetObjectMeta(bucket string, key string, metadata *Metadata) error {
+	if metadata == nil || (!metadata.HasAcl() && !metadata.HasHeader()) {
+		return nil
+	}
 	bucketObj, err := a.client.Bucket(bucket)
 	if err != nil {
 		return err
 	}
+	if !metadata.HasHeader() {
+		return bucketObj.SetObjectACL(key, oss.ACLType(metadata.Acl))
+	}
 
-	options := buildOptions(metadata)
+	// SetObjectMeta会替换全部元数据，先合并已有的元数据，避免丢失自定义元数据等信息
+	props, err := bucketObj.GetObjectDetailedMeta(key, aliSseCustomerOptions(metadata)...)
+	if err != nil {
+		return err
+	}
+	merged := mergeMetadata(aliHeaderToFileMeta(key, props).Metadata, metadata)
+	options := append(buildOptions(&merged), aliSseCopySourceOptions(metadata)...)
 	return bucketObj.SetObjectMeta(key, options...)
 }
 
@@ -265,14 +400,149 @@ func (a *aliStorager) IsObjectExist(bucket string, key string) (bool, error) {
 	return isExists, err
 }
 
+func (a *aliStorager) CreateBucket(bucket string, acl ACL) error {
+	var options []oss.Option
+	if acl != "" {
+		options = append(options, oss.ACL(oss.ACLType(acl)))
+	}
+	return a.client.CreateBucket(bucket, options...)
+}
+
+func (a *aliStorager) DeleteBucket(bucket string) error {
+	return a.client.DeleteBucket(bucket)
+}
+
+func (a *aliStorager) IsBucketExist(bucket string) (bool, error) {
+	return a.client.IsBucketExist(bucket)
+}
+
+func (a *aliStorager) SetBucketAcl(bucket string, acl ACL) error {
+	return a.client.SetBucketACL(bucket, oss.ACLType(acl))
+}
+
+func (a *aliStorager) GetBucketAcl(bucket string) (ACL, error) {
+	result, err := a.client.GetBucketACL(bucket)
+	if err != nil {
+		return "", err
+	}
+	return ACL(result.ACL), nil
+}
+
+func (a *aliStorager) SetBucketPolicy(bucket string, policy string) error {
+	if policy == "" {
+		return a.client.DeleteBucketPolicy(bucket)
+	}
+	return a.client.SetBucketPolicy(bucket, policy)
+}
+
+func (a *aliStorager) GetBucketPolicy(bucket string) (string, error) {
+	return a.client.GetBucketPolicy(bucket)
+}
+
+// 阿里云的存储类型和StorageClass的值一致，不需要转换
+func (a *aliStorager) SetBucketLifecycle(bucket string, rules []LifecycleRule) error {
+	if len(rules) == 0 {
+		return a.client.DeleteBucketLifecycle(bucket)
+	}
+	aliRules := make([]oss.LifecycleRule, 0, len(rules))
+	for _, rule := range rules {
+		aliRule := oss.LifecycleRule{ID: rule.ID, Prefix: rule.Prefix, Status: lifecycleStatus(rule)}
+		if rule.ExpireDays > 0 {
+			aliRule.Expiration = &oss.LifecycleExpiration{Days: rule.ExpireDays}
+		}
+		for _, t := range rule.Transitions {
+			aliRule.Transitions = append(aliRule.Transitions,
+				oss.LifecycleTransition{Days: t.Days, StorageClass: oss.StorageClassType(t.StorageClass)})
+		}
+		if rule.AbortMultipartDays > 0 {
+			aliRule.AbortMultipartUpload = &oss.LifecycleAbortMultipartUpload{Days: rule.AbortMultipartDays}
+		}
+		aliRules = append(aliRules, aliRule)
+	}
+	return a.client.SetBucketLifecycle(bucket, aliRules)
+}
+
+func (a *aliStorager) GetBucketLifecycle(bucket string) ([]LifecycleRule, error) {
+	result, err := a.client.GetBucketLifecycle(bucket)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]LifecycleRule, 0, len(result.Rules))
+	for _, aliRule := range result.Rules {
+		rule := LifecycleRule{ID: aliRule.ID, Prefix: aliRule.Prefix, Disabled: aliRule.Status != "Enabled"}
+		if aliRule.Expiration != nil {
+			rule.ExpireDays = aliRule.Expiration.Days
+		}
+		for _, t := range aliRule.Transitions {
+			rule.Transitions = append(rule.Transitions,
+				LifecycleTransition{Days: t.Days, StorageClass: StorageClass(t.StorageClass)})
+		}
+		if aliRule.AbortMultipartUpload != nil {
+			rule.AbortMultipartDays = aliRule.AbortMultipartUpload.Days
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (a *aliStorager) SetBucketCORS(bucket string, rules []CORSRule) error {
+	if len(rules) == 0 {
+		return a.client.DeleteBucketCORS(bucket)
+	}
+	aliRules := make([]oss.CORSRule, 0, len(rules))
+	for _, rule := range rules {
+		aliRules = append(aliRules, oss.CORSRule{
+			AllowedOrigin: rule.AllowedOrigins,
+			AllowedMethod: rule.AllowedMethods,
+			AllowedHeader: rule.AllowedHeaders,
+			ExposeHeader:  rule.ExposeHeaders,
+			MaxAgeSeconds: rule.MaxAgeSeconds,
+		})
+	}
+	return a.client.SetBucketCORS(bucket, aliRules)
+}
+
+func (a *aliStorager) GetBucketCORS(bucket string) ([]CORSRule, error) {
+	result, err := a.client.GetBucketCORS(bucket)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]CORSRule, 0, len(result.CORSRules))
+	for _, aliRule := range result.CORSRules {
+		rules = append(rules, CORSRule{
+			AllowedOrigins: aliRule.AllowedOrigin,
+			AllowedMethods: aliRule.AllowedMethod,
+			AllowedHeaders: aliRule.AllowedHeader,
+			ExposeHeaders:  aliRule.ExposeHeader,
+			MaxAgeSeconds:  aliRule.MaxAgeSeconds,
+		})
+	}
+	return rules, nil
+}
+
+func (a *aliStorager) SetBucketReferer(bucket string, config RefererConfig) error {
+	// 白名单为空时必须允许空Referer，否则所有请求都会被拒绝
+	allowEmpty := config.AllowEmpty || len(config.Referers) == 0
+	return a.client.SetBucketReferer(bucket, config.Referers, allowEmpty)
+}
+
+func (a *aliStorager) GetBucketReferer(bucket string) (*RefererConfig, error) {
+	result, err := a.client.GetBucketReferer(bucket)
+	if err != nil {
+		return nil, err
+	}
+	return &RefererConfig{AllowEmpty: result.AllowEmptyReferer, Referers: result.RefererList}, nil
+}
+
 type Policy struct {
 	Version   string      `json:"Version"`
 	Statement []Statement `json:"Statement"`
 }
 type Statement struct {
-	Effect   string   `json:"Effect"`
-	Action   []string `json:"Action"`
-	Resource string   `json:"Resource"`
+	Effect    string                         `json:"Effect"`
+	Action    []string                       `json:"Action"`
+	Resource  string                         `json:"Resource"`
+	Condition map[string]map[string][]string `json:"Condition,omitempty"`
 }
 type TokenInfo struct {
 	AccessKeyId     string
@@ -281,7 +551,7 @@ type TokenInfo struct {
 	ExpireTimeStamp int64 // 时间戳毫秒
 }
 
-func (a *aliStorager) AssumeRole(policy Policy, expires time.Duration) (*TokenInfo, error) {
+func (a *aliStorager) AssumeRole(policy Policy, sessionName string, expires time.Duration) (*TokenInfo, error) {
 
 	policyByte, err := json.Marshal(&policy)
 	if err != nil {
@@ -290,7 +560,7 @@ func (a *aliStorager) AssumeRole(policy Policy, expires time.Duration) (*TokenIn
 	var assumeRoleFunc = func([]byte) (res *sts.AssumeRoleResponse, err error) {
 		request := sts.AssumeRoleRequest{}
 		request.SetPolicy(string(policyByte))
-		request.SetRoleSessionName("test")
+		request.SetRoleSessionName(sessionName)
 		request.SetRoleArn(a.config.RoleArn)
 		request.SetDurationSeconds(int64(expires / time.Second))
 		response, err := a.stsClient.AssumeRole(&request)
@@ -328,14 +598,25 @@ func (a *aliStorager) AssumeRole(policy Policy, expires time.Duration) (*TokenIn
 
 }
 
-func (a *aliStorager) SignFile(bucket string, key string, expires time.Duration) (string, error) {
+func (a *aliStorager) SignFile(bucket string, key string, expires time.Duration, metadata *Metadata) (string, error) {
 	// 获取存储空间。
 	bucketObj, err := a.client.Bucket(bucket)
 	if err != nil {
 		return "", err
 	}
+	var options []oss.Option
+	if metadata != nil && metadata.process != nil {
+		_, value, err := metadata.process.render(Aliyun)
+		if err != nil {
+			return "", err
+		}
+		options = append(options, oss.Process(value))
+	}
+	if metadata.hasResponseHeader() {
+		options = append(options, aliResponseOptions(metadata)...)
+	}
 	// 使用签名URL将OSS文件下载到流。
-	signedUrl, err := bucketObj.SignURL(key, oss.HTTPGet, int64(expires/time.Second))
+	signedUrl, err := bucketObj.SignURL(key, oss.HTTPGet, int64(expires/time.Second), options...)
 	if err != nil {
 		return "", err
 	}
@@ -349,6 +630,7 @@ const (
 	ossActionPut    = "oss:PutObject"
 	ossActionGet    = "oss:GetObject"
 	ossActionPutAcl = "oss:PutObjectAcl"
+	ossActionDelete = "oss:DeleteObject"
 )
 
 func (a *aliStorager) GetDirToken(bucket string, remoteDir string, expires time.Duration) (*StsTokenInfo, error) {
@@ -361,14 +643,30 @@ func (a *aliStorager) GetDirTokenRead(bucket string, remoteDir string, expires t
 
 func (a *aliStorager) createDirToken(bucket string, remoteDir string,
 	expires time.Duration, actions ...string) (*StsTokenInfo, error) {
+	return a.CreateToken(bucket, NewStsPolicy().Allow(actions...).Resource(remoteDir), expires)
+}
 
-	resource := fmt.Sprintf("acs:oss:*:*:%s/%s*", bucket, remoteDir)
-	policy := Policy{Version: "1", Statement: []Statement{{
-		Effect:   "Allow",
-		Action:   actions,
-		Resource: resource,
-	}}}
-	ossToken, err := a.AssumeRole(policy, expires)
+func (a *aliStorager) CreateToken(bucket string, stsPolicy *StsPolicy, expires time.Duration) (*StsTokenInfo, error) {
+	var condition map[string]map[string][]string
+	if len(stsPolicy.sourceIPs) > 0 {
+		condition = map[string]map[string][]string{"IpAddress": {"acs:SourceIp": stsPolicy.sourceIPs}}
+	}
+	if len(stsPolicy.referers) > 0 {
+		if condition == nil {
+			condition = make(map[string]map[string][]string)
+		}
+		condition["StringLike"] = map[string][]string{"acs:Referer": stsPolicy.referers}
+	}
+	policy := Policy{Version: "1"}
+	for _, resource := range stsPolicy.resources {
+		policy.Statement = append(policy.Statement, Statement{
+			Effect:    "Allow",
+			Action:    stsPolicy.providerActions(Aliyun),
+			Resource:  fmt.Sprintf("acs:oss:*:*:%s/%s*", bucket, resource),
+			Condition: condition,
+		})
+	}
+	ossToken, err := a.AssumeRole(policy, stsPolicy.session(), expires)
 	if err != nil {
 		return nil, err
 	}
@@ -380,7 +678,7 @@ func (a *aliStorager) createDirToken(bucket string, remoteDir string,
 		Bucket:          bucket,
 		Region:          a.config.Region,
 		Expire:          ossToken.ExpireTimeStamp,
-		UploadPath:      remoteDir,
+		UploadPath:      stsPolicy.resources[0],
 		Host:            a.config.Host,
 		Endpoint:        a.config.Endpoint,
 	}
@@ -399,28 +697,19 @@ func (a *aliStorager) PresignObject(bucket string, key string, expires time.Dura
 	return signedUrl, nil
 }
 
-func (a *aliStorager) GetObjectMeta(bucket string, key string) (*FileMeta, error) {
-	bucketObj, _ := a.client.Bucket(bucket)
-
-	props, err := bucketObj.GetObjectDetailedMeta(key)
+func (a *aliStorager) GetObjectMeta(bucket string, key string, metadata *Metadata) (*FileMeta, error) {
+	res, err := a.HeadObject(bucket, key, metadata)
 	if err != nil {
 		return nil, err
 	}
-
-	res := &FileMeta{Key: key}
-	res.ETag = props.Get("Etag")
-	res.Size, _ = strconv.ParseInt(props.Get("Content-Length"), 10, 64)
-	res.LastModified, err = time.Parse(http.TimeFormat, props.Get("Last-Modified"))
-
-	// 填充 Metadata 信息
-	res.Metadata = Metadata{
-		ContentType:        props.Get("Content-Type"),
-		ContentEncoding:    props.Get("Content-Encoding"),
-		ContentDisposition: props.Get("Content-Disposition"),
-	}
+	bucketObj, _ := a.client.Bucket(bucket)
 
 	// 获取对象的 ACL
-	aclResult, err := bucketObj.GetObjectACL(key)
+	var aclOptions []oss.Option
+	if metadata.hasVersionID() {
+		aclOptions = append(aclOptions, oss.VersionId(metadata.versionID))
+	}
+	aclResult, err := bucketObj.GetObjectACL(key, aclOptions...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get object ACL: %v", err)
 	}
@@ -429,6 +718,39 @@ func (a *aliStorager) GetObjectMeta(bucket string, key string) (*FileMeta, error
 	return res, nil
 }
 
+func (a *aliStorager) HeadObject(bucket string, key string, metadata *Metadata) (*FileMeta, error) {
+	bucketObj, _ := a.client.Bucket(bucket)
+	props, err := bucketObj.GetObjectDetailedMeta(key, aliReadOptions(metadata)...)
+	if err != nil {
+		return nil, err
+	}
+	return aliHeaderToFileMeta(key, props), nil
+}
+
+// 从响应头中解析文件信息，Range请求时Size为文件总大小
+func aliHeaderToFileMeta(key string, header http.Header) *FileMeta {
+	res := &FileMeta{Key: key}
+	res.ETag = header.Get("Etag")
+	res.Size, _ = strconv.ParseInt(header.Get("Content-Length"), 10, 64)
+	if size := parseContentRangeSize(header.Get("Content-Range")); size >= 0 {
+		res.Size = size
+	}
+	res.LastModified, _ = time.Parse(http.TimeFormat, header.Get("Last-Modified"))
+	res.VersionID = header.Get("X-Oss-Version-Id")
+
+	// 填充 Metadata 信息
+	res.Metadata = Metadata{
+		ContentType:        header.Get("Content-Type"),
+		ContentEncoding:    header.Get("Content-Encoding"),
+		ContentDisposition: header.Get("Content-Disposition"),
+		UserMeta:           headerToUserMeta(header, oss.HTTPHeaderOssMetaPrefix),
+		SSE: normalizeSSE(header.Get(oss.HTTPHeaderOssServerSideEncryption),
+			header.Get(oss.HTTPHeaderSSECAlgorithm)),
+		SSEKeyID: header.Get(oss.HTTPHeaderOssServerSideEncryptionKeyID),
+	}
+	return res
+}
+
 func buildOptions(metadata *Metadata) []oss.Option {
 	if metadata == nil {
 		return nil
@@ -447,5 +769,268 @@ func buildOptions(metadata *Metadata) []oss.Option {
 	if metadata.Acl != "" {
 		options = append(options, oss.ObjectACL(oss.ACLType(metadata.Acl)))
 	}
+	for k, v := range metadata.UserMeta {
+		options = append(options, oss.Meta(k, v))
+	}
+	options = append(options, aliSseOptions(metadata)...)
 	return options
 }
+
+// 服务端加密的请求头，用于上传、复制的目标文件、初始化分片上传
+func aliSseOptions(metadata *Metadata) []oss.Option {
+	if metadata == nil {
+		return nil
+	}
+	var options []oss.Option
+	switch metadata.SSE {
+	case SSEAes256:
+		options = append(options, oss.ServerSideEncryption("AES256"))
+	case SSEKms:
+		options = append(options, oss.ServerSideEncryption("KMS"))
+		if metadata.SSEKeyID != "" {
+			options = append(options, oss.ServerSideEncryptionKeyID(metadata.SSEKeyID))
+		}
+	}
+	return append(options, aliSseCustomerOptions(metadata)...)
+}
+
+// SSE-C的请求头，SSE-C的文件在读取、上传分片时也需要
+func aliSseCustomerOptions(metadata *Metadata) []oss.Option {
+	if !metadata.hasSSECustomerKey() {
+		return nil
+	}
+	key, keyMd5 := metadata.sseCustomerKeyBase64()
+	return []oss.Option{oss.SSECAlgorithm("AES256"), oss.SSECKey(key), oss.SSECKeyMd5(keyMd5)}
+}
+
+// 读取文件时的请求头：SSE-C的密钥和版本ID
+// 显式设置Accept-Encoding，避免Transport自动解压（解压后去掉了Content-Encoding和Content-Length），和其它平台一样返回保存的数据
+func aliReadOptions(metadata *Metadata) []oss.Option {
+	options := append(aliSseCustomerOptions(metadata), oss.AcceptEncoding("identity"))
+	if metadata.hasVersionID() {
+		options = append(options, oss.VersionId(metadata.versionID))
+	}
+	return options
+}
+
+// 条件写入的请求头，只用于上传、复制和完成分片上传，不能用于SetObjectMeta
+func aliConditionOptions(metadata *Metadata) []oss.Option {
+	if !metadata.hasCondition() {
+		return nil
+	}
+	if metadata.forbidOverwrite {
+		return []oss.Option{oss.ForbidOverWrite(true)}
+	}
+	return []oss.Option{oss.IfMatch(metadata.ifMatch)}
+}
+
+// 完成分片上传时的请求头：初始化时设置的ACL不生效，需要在完成时设置
+func aliCompleteOptions(metadata *Metadata) []oss.Option {
+	var options []oss.Option
+	if metadata != nil && metadata.Acl != "" {
+		options = append(options, oss.ObjectACL(oss.ACLType(metadata.Acl)))
+	}
+	return append(options, aliConditionOptions(metadata)...)
+}
+
+// 复制SSE-C的源文件时需要的请求头
+func aliSseCopySourceOptions(metadata *Metadata) []oss.Option {
+	if !metadata.hasSSECustomerKey() {
+		return nil
+	}
+	key, keyMd5 := metadata.sseCustomerKeyBase64()
+	return []oss.Option{
+		oss.SetHeader("X-Oss-Copy-Source-Server-Side-Encryption-Customer-Algorithm", "AES256"),
+		oss.SetHeader("X-Oss-Copy-Source-Server-Side-Encryption-Customer-Key", key),
+		oss.SetHeader("X-Oss-Copy-Source-Server-Side-Encryption-Customer-Key-MD5", keyMd5),
+	}
+}
+
+// 签名下载地址覆盖的响应头
+func aliResponseOptions(metadata *Metadata) []oss.Option {
+	var options []oss.Option
+	for name, value := range metadata.responseHeader {
+		switch name {
+		case responseContentDisposition:
+			options = append(options, oss.ResponseContentDisposition(value))
+		case responseContentType:
+			options = append(options, oss.ResponseContentType(value))
+		case responseCacheControl:
+			options = append(options, oss.ResponseCacheControl(value))
+		}
+	}
+	return options
+}
+
+func aliMultipartResult(bucket string, key string, uploadID string) oss.InitiateMultipartUploadResult {
+	return oss.InitiateMultipartUploadResult{Bucket: bucket, Key: key, UploadID: uploadID}
+}
+
+func (a *aliStorager) InitiateMultipartUpload(bucket string, key string, metadata *Metadata) (string, error) {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return "", err
+	}
+	imr, err := bucketObj.InitiateMultipartUpload(key, buildOptions(metadata)...)
+	if err != nil {
+		return "", err
+	}
+	return imr.UploadID, nil
+}
+
+func (a *aliStorager) UploadPart(bucket string, key string, uploadID string, partNumber int, r io.Reader,
+	size int64, metadata *Metadata) (string, error) {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return "", err
+	}
+	part, err := bucketObj.UploadPart(aliMultipartResult(bucket, key, uploadID), r, size, partNumber,
+		aliSseCustomerOptions(metadata)...)
+	if err != nil {
+		return "", err
+	}
+	return part.ETag, nil
+}
+
+func (a *aliStorager) PresignUploadPart(bucket string, key string, uploadID string, partNumber int,
+	expires time.Duration) (string, error) {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return "", err
+	}
+	signedUrl, err := bucketObj.SignURL(key, oss.HTTPPut, int64(expires/time.Second),
+		oss.AddParam("partNumber", strconv.Itoa(partNumber)), oss.AddParam("uploadId", uploadID))
+	if err != nil {
+		return "", err
+	}
+
+	signedUrl = strings.Replace(signedUrl, "http", "https", 1)
+	signedUrl = strings.Replace(signedUrl, a.config.EndpointInner, a.config.Endpoint, 1)
+	return signedUrl, nil
+}
+
+func (a *aliStorager) CompleteMultipartUpload(bucket string, key string, uploadID string, parts []UploadedPart,
+	metadata *Metadata) error {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return err
+	}
+	aliParts := make([]oss.UploadPart, 0, len(parts))
+	for _, part := range parts {
+		aliParts = append(aliParts, oss.UploadPart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	_, err = bucketObj.CompleteMultipartUpload(aliMultipartResult(bucket, key, uploadID), aliParts,
+		aliCompleteOptions(metadata)...)
+	return err
+}
+
+func (a *aliStorager) AbortMultipartUpload(bucket string, key string, uploadID string) error {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return err
+	}
+	return bucketObj.AbortMultipartUpload(aliMultipartResult(bucket, key, uploadID))
+}
+
+func (a *aliStorager) ListMultipartUploads(bucket string, prefix string) ([]MultipartUpload, error) {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	var res []MultipartUpload
+	keyMarker, uploadIDMarker := "", ""
+	for {
+		lmr, err := bucketObj.ListMultipartUploads(oss.Prefix(prefix), oss.KeyMarker(keyMarker),
+			oss.UploadIDMarker(uploadIDMarker))
+		if err != nil {
+			return res, err
+		}
+		for _, upload := range lmr.Uploads {
+			res = append(res, MultipartUpload{Key: upload.Key, UploadID: upload.UploadID, Initiated: upload.Initiated})
+		}
+		if !lmr.IsTruncated {
+			return res, nil
+		}
+		keyMarker, uploadIDMarker = lmr.NextKeyMarker, lmr.NextUploadIDMarker
+	}
+}
+
+func (a *aliStorager) ListParts(bucket string, key string, uploadID string) ([]UploadedPart, error) {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return nil, err
+	}
+	var res []UploadedPart
+	marker := 0
+	for {
+		lpr, err := bucketObj.ListUploadedParts(aliMultipartResult(bucket, key, uploadID), oss.PartNumberMarker(marker))
+		if err != nil {
+			return res, err
+		}
+		for _, part := range lpr.UploadedParts {
+			res = append(res, UploadedPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: int64(part.Size),
+				LastModified: part.LastModified})
+		}
+		if !lpr.IsTruncated {
+			return res, nil
+		}
+		if marker, err = strconv.Atoi(lpr.NextPartNumberMarker); err != nil {
+			return res, err
+		}
+	}
+}
+
+func (a *aliStorager) UploadPartCopy(bucket string, srcKey string, destKey string, uploadID string, partNumber int,
+	offset int64, size int64, metadata *Metadata) (string, error) {
+	bucketObj, err := a.client.Bucket(bucket)
+	if err != nil {
+		return "", err
+	}
+	// 目标文件和源文件的SSE-C密钥相同
+	options := append(aliSseCustomerOptions(metadata), aliSseCopySourceOptions(metadata)...)
+	if metadata.hasVersionID() {
+		options = append(options, oss.VersionId(metadata.versionID))
+	}
+	part, err := bucketObj.UploadPartCopy(aliMultipartResult(bucket, destKey, uploadID), bucket, srcKey, offset, size,
+		partNumber, options...)
+	if err != nil {
+		return "", err
+	}
+	return part.ETag, nil
+}
+
+// oss的事件通知需要通过MNS或函数计算接收
+func (a *aliStorager) ListenObjectEvents(bucket string, prefix string, done <-chan struct{}) (<-chan ObjectEvent, error) {
+	return nil, ErrNotSupported
+}
+
+// 只支持MD5校验和NoOverwrite
+func (a *aliStorager) AsyncFetch(bucket string, key string, url string, metadata *Metadata) (string, error) {
+	conf := oss.AsyncFetchTaskConfiguration{Url: url, Object: key, IgnoreSameKey: !metadata.forbidOverwrite}
+	if metadata.fetch != nil && metadata.fetch.md5 != "" {
+		sum, err := hex.DecodeString(metadata.fetch.md5)
+		if err != nil {
+			return "", errors.Wrap(err, "decode fetch md5")
+		}
+		conf.ContentMD5 = base64.StdEncoding.EncodeToString(sum)
+	}
+	res, err := a.client.SetBucketAsyncTask(bucket, conf)
+	if err != nil {
+		return "", err
+	}
+	return res.TaskId, nil
+}
+
+func (a *aliStorager) GetAsyncFetch(bucket string, taskID string) (*FetchTask, error) {
+	info, err := a.client.GetBucketAsyncTask(bucket, taskID)
+	if err != nil {
+		return nil, err
+	}
+	return &FetchTask{
+		ID:       info.TaskId,
+		State:    info.State,
+		Key:      info.TaskInfo.Object,
+		URL:      info.TaskInfo.Url,
+		ErrorMsg: info.ErrorMsg,
+	}, nil
+}
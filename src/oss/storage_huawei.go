@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/hqmin9527/kits-go/src/logger"
@@ -20,8 +21,9 @@ import (
 // https://support.huaweicloud.com/sdk-go-devg-obs/obs_23_0002.html
 
 const (
-	obsPutAction = "obs:object:PutObject"
-	obsGetAction = "obs:object:GetObject"
+	obsPutAction    = "obs:object:PutObject"
+	obsGetAction    = "obs:object:GetObject"
+	obsDeleteAction = "obs:object:DeleteObject"
 )
 
 type hwStorager struct {
@@ -49,10 +51,12 @@ func newHwStorager(c *Config) (*hwStorager, error) {
 	return &hwStorager{config: c, client: client, iamClient: iamClient}, nil
 }
 
-func (h *hwStorager) GetObject(bucket string, key string) ([]byte, error) {
+func (h *hwStorager) GetObject(bucket string, key string, metadata *Metadata) ([]byte, error) {
 	input := new(obs.GetObjectInput)
 	input.Bucket = bucket
 	input.Key = key
+	input.VersionId = obsVersionID(metadata)
+	input.SseHeader = obsSseCustomerHeader(metadata)
 	output, err := h.client.GetObject(input)
 	if err != nil {
 		logger.Error("obs get remote file failed, key: %s err: %s", key, err)
@@ -76,10 +80,12 @@ func (h *hwStorager) GetObject(bucket string, key string) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-func (h *hwStorager) GetFile(bucket string, key string, localFile string) error {
+func (h *hwStorager) GetFile(bucket string, key string, localFile string, metadata *Metadata) error {
 	input := new(obs.GetObjectInput)
 	input.Bucket = bucket
 	input.Key = key
+	input.VersionId = obsVersionID(metadata)
+	input.SseHeader = obsSseCustomerHeader(metadata)
 	output, err := h.client.GetObject(input)
 	if err != nil {
 		logger.Error("obs get remote file failed, key: %s, err: %s", key, err)
@@ -107,6 +113,31 @@ func (h *hwStorager) GetFile(bucket string, key string, localFile string) error
 	return nil
 }
 
+func (h *hwStorager) GetReader(bucket string, key string, offset int64, length int64,
+	metadata *Metadata) (io.ReadCloser, *FileMeta, error) {
+
+	input := new(obs.GetObjectInput)
+	input.Bucket = bucket
+	input.Key = key
+	input.VersionId = obsVersionID(metadata)
+	input.SseHeader = obsSseCustomerHeader(metadata)
+	if rng := formatRange(offset, length); rng != "" {
+		input.Range = "bytes=" + rng
+	}
+	output, err := h.client.GetObject(input)
+	if err != nil {
+		logger.Error("obs get remote file failed, key: %s, err: %s", key, err)
+		return nil, nil, err
+	}
+	res := obsOutputToFileMeta(key, &output.GetObjectMetadataOutput)
+	if values := output.ResponseHeaders["content-range"]; len(values) > 0 {
+		if size := parseContentRangeSize(values[0]); size >= 0 {
+			res.Size = size
+		}
+	}
+	return output.Body, res, nil
+}
+
 func (h *hwStorager) PutObjectWithMeta(bucket string, key string, data []byte, metadata *Metadata) error {
 	return h.PutReaderWithMeta(bucket, key, bytes.NewReader(data), metadata)
 }
@@ -118,7 +149,8 @@ func (h *hwStorager) PutFileWithMeta(bucket string, key string, localFile string
 	}
 
 	// 分流，大于100M使用分片上传，小于100M直接上传
-	if fi.Size() > chunkSize {
+	// 断点续传的分片上传不支持条件写入，条件写入时直接上传（单次上传最大5GB）
+	if fi.Size() > chunkSize && !metadata.hasCondition() {
 		logger.Debug("obs file size over 100m, use multipart upload, ossPath: %s", key)
 		return h.putFileByMultipart(bucket, key, localFile, metadata)
 	} else {
@@ -131,9 +163,16 @@ func (h *hwStorager) putFileByDirect(bucket string, key string, localFile string
 	input.Bucket = bucket
 	input.Key = key
 	input.SourceFile = localFile
+	input.SseHeader = obsSseHeader(metadata)
 	setObsInput(&input.ACL, &input.HttpHeader, metadata)
+	setObsUserMeta(&input.Metadata, metadata)
 
-	_, err := h.client.PutFile(input)
+	var err error
+	if name, value := obsConditionHeader(metadata); name != "" {
+		_, err = h.client.PutFile(input, obs.WithCustomHeader(name, value))
+	} else {
+		_, err = h.client.PutFile(input)
+	}
 	if err != nil {
 		logger.Error("obs putFileByDirect failed, key: %s, err: %s", key, err)
 		return err
@@ -149,6 +188,7 @@ func (h *hwStorager) putFileByMultipart(bucket string, key string, localFile str
 	input.EnableCheckpoint = true // 开启断点续传模式
 	input.PartSize = chunkSize    // 指定分片大小100MB
 	input.TaskNum = 5             // 指定分片上传时最大并发数
+	input.SseHeader = obsSseHeader(metadata)
 
 	_, err := h.client.UploadFile(input)
 	if err != nil {
@@ -163,12 +203,19 @@ func (h *hwStorager) PutReaderWithMeta(bucket string, key string, r io.Reader, m
 	input.Bucket = bucket
 	input.Key = key
 	input.Body = r
+	input.SseHeader = obsSseHeader(metadata)
 	if metadata != nil && metadata.Acl != "" {
 		input.ACL = obs.AclType(metadata.Acl)
 	}
 	setObsInput(&input.ACL, &input.HttpHeader, metadata)
+	setObsUserMeta(&input.Metadata, metadata)
 
-	_, err := h.client.PutObject(input)
+	var err error
+	if name, value := obsConditionHeader(metadata); name != "" {
+		_, err = h.client.PutObject(input, obs.WithCustomHeader(name, value))
+	} else {
+		_, err = h.client.PutObject(input)
+	}
 	if err != nil {
 		logger.Error("obs PutReaderWithMeta failed, key: %s, err: %s", key, err)
 		return err
@@ -177,20 +224,31 @@ func (h *hwStorager) PutReaderWithMeta(bucket string, key string, r io.Reader, m
 }
 
 func (h *hwStorager) ListObjects(bucket string, prefix string) ([]FileMeta, error) {
+	result := make([]FileMeta, 0, 32)
+	err := h.WalkObjects(bucket, prefix, func(meta *FileMeta) error {
+		result = append(result, *meta)
+		return nil
+	})
+	return result, err
+}
+
+func (h *hwStorager) WalkObjects(bucket string, prefix string, fn func(meta *FileMeta) error) error {
 	input := new(obs.ListObjectsInput)
 	input.Bucket = bucket
 	input.Prefix = prefix
 	input.MaxKeys = 1000 // 一次调用ListObjects取1000条，相当于分页取
 
-	result := make([]FileMeta, 0, 32)
 	for {
 		output, err := h.client.ListObjects(input)
 		if err != nil {
-			return result, err
+			return err
 		}
 		for _, val := range output.Contents {
-			content := FileMeta{Key: val.Key, Size: val.Size, ETag: val.ETag, LastModified: val.LastModified}
-			result = append(result, content)
+			content := FileMeta{Key: val.Key, Size: val.Size, ETag: val.ETag, LastModified: val.LastModified,
+				StorageClass: fromObsStorageClass(val.StorageClass)}
+			if err = fn(&content); err != nil {
+				return err
+			}
 		}
 
 		if output.IsTruncated {
@@ -200,7 +258,38 @@ func (h *hwStorager) ListObjects(bucket string, prefix string) ([]FileMeta, erro
 		}
 
 	}
-	return result, nil
+	return nil
+}
+
+func (h *hwStorager) ListDir(bucket string, prefix string) ([]string, []FileMeta, error) {
+	input := new(obs.ListObjectsInput)
+	input.Bucket = bucket
+	input.Prefix = prefix
+	input.Delimiter = "/"
+	input.MaxKeys = 1000
+
+	var dirs []string
+	files := make([]FileMeta, 0, 32)
+	for {
+		output, err := h.client.ListObjects(input)
+		if err != nil {
+			return dirs, files, err
+		}
+		dirs = append(dirs, output.CommonPrefixes...)
+		for _, val := range output.Contents {
+			if val.Key == prefix {
+				continue
+			}
+			files = append(files, FileMeta{Key: val.Key, Size: val.Size, ETag: val.ETag, LastModified: val.LastModified})
+		}
+
+		if output.IsTruncated {
+			input.Marker = output.NextMarker
+		} else {
+			break
+		}
+	}
+	return dirs, files, nil
 }
 
 func (h *hwStorager) DeleteObject(bucket string, key string) error {
@@ -211,14 +300,30 @@ func (h *hwStorager) DeleteObject(bucket string, key string) error {
 	return err
 }
 
+func (h *hwStorager) DeleteObjectIfMatch(bucket string, key string, etag string) error {
+	input := new(obs.DeleteObjectInput)
+	input.Bucket = bucket
+	input.Key = key
+	_, err := h.client.DeleteObject(input, obs.WithCustomHeader("If-Match", etag))
+	return err
+}
+
 func (h *hwStorager) CopyObject(bucket string, srcKey string, destKey string, metadata *Metadata) error {
 	input := new(obs.CopyObjectInput)
 	input.Bucket = bucket
 	input.Key = destKey
 	input.CopySourceBucket = bucket
 	input.CopySourceKey = srcKey
+	input.SseHeader = obsSseHeader(metadata)
+	input.SourceSseHeader = obsSseCustomerHeader(metadata)
+	input.CopySourceVersionId = obsVersionID(metadata)
 
-	_, err := h.client.CopyObject(input)
+	var err error
+	if name, value := obsConditionHeader(metadata); name != "" {
+		_, err = h.client.CopyObject(input, obs.WithCustomHeader(name, value))
+	} else {
+		_, err = h.client.CopyObject(input)
+	}
 	if err != nil {
 		return err
 	}
@@ -226,7 +331,7 @@ func (h *hwStorager) CopyObject(bucket string, srcKey string, destKey string, me
 	// CopyObject时，目标文件的acl默认是私有的
 	// 没有指定目标文件acl时，尝试获取源文件acl
 	if metadata != nil && !metadata.HasAcl() {
-		acl, _ := h.getObjectAcl(bucket, srcKey)
+		acl, _ := h.getObjectAcl(bucket, srcKey, obsVersionID(metadata))
 		if acl != "" {
 			metadata.Acl = acl
 		}
@@ -236,10 +341,255 @@ func (h *hwStorager) CopyObject(bucket string, srcKey string, destKey string, me
 	return h.SetObjectMeta(bucket, destKey, metadata)
 }
 
-func (h *hwStorager) getObjectAcl(bucket string, key string) (ACL, error) {
+func (h *hwStorager) SetBucketVersioning(bucket string, enabled bool) error {
+	input := new(obs.SetBucketVersioningInput)
+	input.Bucket = bucket
+	input.Status = utils.If(enabled, obs.VersioningStatusEnabled, obs.VersioningStatusSuspended)
+	_, err := h.client.SetBucketVersioning(input)
+	return err
+}
+
+func (h *hwStorager) GetBucketVersioning(bucket string) (string, error) {
+	output, err := h.client.GetBucketVersioning(bucket)
+	if err != nil {
+		return "", err
+	}
+	return string(output.Status), nil
+}
+
+func (h *hwStorager) ListObjectVersions(bucket string, prefix string) ([]FileMeta, error) {
+	input := new(obs.ListVersionsInput)
+	input.Bucket = bucket
+	input.Prefix = prefix
+	input.MaxKeys = 1000
+
+	result := make([]FileMeta, 0, 32)
+	for {
+		output, err := h.client.ListVersions(input)
+		if err != nil {
+			return sortVersions(result), err
+		}
+		for _, val := range output.Versions {
+			result = append(result, FileMeta{Key: val.Key, Size: val.Size, ETag: val.ETag, LastModified: val.LastModified,
+				VersionID: val.VersionId, IsLatest: val.IsLatest})
+		}
+		for _, val := range output.DeleteMarkers {
+			result = append(result, FileMeta{Key: val.Key, LastModified: val.LastModified,
+				VersionID: val.VersionId, IsLatest: val.IsLatest, IsDeleteMarker: true})
+		}
+
+		if !output.IsTruncated {
+			break
+		}
+		input.KeyMarker, input.VersionIdMarker = output.NextKeyMarker, output.NextVersionIdMarker
+	}
+	return sortVersions(result), nil
+}
+
+func (h *hwStorager) DeleteObjectVersion(bucket string, key string, versionID string) error {
+	input := new(obs.DeleteObjectInput)
+	input.Bucket = bucket
+	input.Key = key
+	input.VersionId = versionID
+	_, err := h.client.DeleteObject(input)
+	return err
+}
+
+func (h *hwStorager) CreateBucket(bucket string, acl ACL) error {
+	input := new(obs.CreateBucketInput)
+	input.Bucket = bucket
+	input.ACL = obs.AclType(acl)
+	input.Location = h.config.Region
+	_, err := h.client.CreateBucket(input)
+	return err
+}
+
+func (h *hwStorager) DeleteBucket(bucket string) error {
+	_, err := h.client.DeleteBucket(bucket)
+	return err
+}
+
+func (h *hwStorager) IsBucketExist(bucket string) (bool, error) {
+	_, err := h.client.HeadBucket(bucket)
+	if err != nil {
+		if isObsNotFoundError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (h *hwStorager) SetBucketAcl(bucket string, acl ACL) error {
+	input := new(obs.SetBucketAclInput)
+	input.Bucket = bucket
+	input.ACL = obs.AclType(acl)
+	_, err := h.client.SetBucketAcl(input)
+	return err
+}
+
+// 根据所有用户组的授权判断公共读写
+func (h *hwStorager) GetBucketAcl(bucket string) (ACL, error) {
+	output, err := h.client.GetBucketAcl(bucket)
+	if err != nil {
+		return "", err
+	}
+	acl := ACL_PRIVATE
+	for _, grant := range output.Grants {
+		if grant.Grantee.URI != obs.GroupAllUsers {
+			continue
+		}
+		switch grant.Permission {
+		case obs.PermissionWrite, obs.PermissionFullControl:
+			return ACL_PUBLIC_READ_WRITE, nil
+		case obs.PermissionRead:
+			acl = ACL_PUBLIC_READ
+		}
+	}
+	return acl, nil
+}
+
+func (h *hwStorager) SetBucketPolicy(bucket string, policy string) error {
+	if policy == "" {
+		_, err := h.client.DeleteBucketPolicy(bucket)
+		return err
+	}
+	input := new(obs.SetBucketPolicyInput)
+	input.Bucket = bucket
+	input.Policy = policy
+	_, err := h.client.SetBucketPolicy(input)
+	return err
+}
+
+func (h *hwStorager) GetBucketPolicy(bucket string) (string, error) {
+	output, err := h.client.GetBucketPolicy(bucket)
+	if err != nil {
+		return "", err
+	}
+	return output.Policy, nil
+}
+
+func (h *hwStorager) SetBucketLifecycle(bucket string, rules []LifecycleRule) error {
+	if len(rules) == 0 {
+		_, err := h.client.DeleteBucketLifecycleConfiguration(bucket)
+		return err
+	}
+	input := new(obs.SetBucketLifecycleConfigurationInput)
+	input.Bucket = bucket
+	for _, rule := range rules {
+		obsRule := obs.LifecycleRule{ID: rule.ID, Prefix: rule.Prefix, Status: obs.RuleStatusType(lifecycleStatus(rule))}
+		obsRule.Expiration.Days = rule.ExpireDays
+		for _, t := range rule.Transitions {
+			obsRule.Transitions = append(obsRule.Transitions,
+				obs.Transition{Days: t.Days, StorageClass: obsStorageClass(t.StorageClass)})
+		}
+		obsRule.AbortIncompleteMultipartUpload.DaysAfterInitiation = rule.AbortMultipartDays
+		input.LifecycleRules = append(input.LifecycleRules, obsRule)
+	}
+	_, err := h.client.SetBucketLifecycleConfiguration(input)
+	return err
+}
+
+func (h *hwStorager) GetBucketLifecycle(bucket string) ([]LifecycleRule, error) {
+	output, err := h.client.GetBucketLifecycleConfiguration(bucket)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]LifecycleRule, 0, len(output.LifecycleRules))
+	for _, obsRule := range output.LifecycleRules {
+		rule := LifecycleRule{
+			ID:                 obsRule.ID,
+			Prefix:             obsRule.Prefix,
+			Disabled:           obsRule.Status != obs.RuleStatusEnabled,
+			ExpireDays:         obsRule.Expiration.Days,
+			AbortMultipartDays: obsRule.AbortIncompleteMultipartUpload.DaysAfterInitiation,
+		}
+		for _, t := range obsRule.Transitions {
+			rule.Transitions = append(rule.Transitions,
+				LifecycleTransition{Days: t.Days, StorageClass: fromObsStorageClass(t.StorageClass)})
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (h *hwStorager) SetBucketCORS(bucket string, rules []CORSRule) error {
+	if len(rules) == 0 {
+		_, err := h.client.DeleteBucketCors(bucket)
+		return err
+	}
+	input := new(obs.SetBucketCorsInput)
+	input.Bucket = bucket
+	for _, rule := range rules {
+		input.CorsRules = append(input.CorsRules, obs.CorsRule{
+			AllowedOrigin: rule.AllowedOrigins,
+			AllowedMethod: rule.AllowedMethods,
+			AllowedHeader: rule.AllowedHeaders,
+			ExposeHeader:  rule.ExposeHeaders,
+			MaxAgeSeconds: rule.MaxAgeSeconds,
+		})
+	}
+	_, err := h.client.SetBucketCors(input)
+	return err
+}
+
+func (h *hwStorager) GetBucketCORS(bucket string) ([]CORSRule, error) {
+	output, err := h.client.GetBucketCors(bucket)
+	if err != nil {
+		return nil, err
+	}
+	rules := make([]CORSRule, 0, len(output.CorsRules))
+	for _, obsRule := range output.CorsRules {
+		rules = append(rules, CORSRule{
+			AllowedOrigins: obsRule.AllowedOrigin,
+			AllowedMethods: obsRule.AllowedMethod,
+			AllowedHeaders: obsRule.AllowedHeader,
+			ExposeHeaders:  obsRule.ExposeHeader,
+			MaxAgeSeconds:  obsRule.MaxAgeSeconds,
+		})
+	}
+	return rules, nil
+}
+
+// obs没有防盗链接口，需要在bucket策略中使用Referer条件
+func (h *hwStorager) SetBucketReferer(bucket string, config RefererConfig) error {
+	return ErrNotSupported
+}
+
+func (h *hwStorager) GetBucketReferer(bucket string) (*RefererConfig, error) {
+	return nil, ErrNotSupported
+}
+
+// 华为的低频访问和归档分别为WARM和COLD
+func obsStorageClass(class StorageClass) obs.StorageClassType {
+	switch class {
+	case StorageIA:
+		return obs.StorageClassWarm
+	case StorageArchive:
+		return obs.StorageClassCold
+	case StorageStandard:
+		return obs.StorageClassStandard
+	}
+	return obs.StorageClassType(class)
+}
+
+func fromObsStorageClass(class obs.StorageClassType) StorageClass {
+	switch class {
+	case obs.StorageClassWarm:
+		return StorageIA
+	case obs.StorageClassCold:
+		return StorageArchive
+	case obs.StorageClassStandard:
+		return StorageStandard
+	}
+	return StorageClass(class)
+}
+
+func (h *hwStorager) getObjectAcl(bucket string, key string, versionID string) (ACL, error) {
 	input := new(obs.GetObjectAclInput)
 	input.Bucket = bucket
 	input.Key = key
+	input.VersionId = versionID
 
 	output, err := h.client.GetObjectAcl(input)
 	if err != nil {
@@ -291,13 +641,21 @@ func (h *hwStorager) setObjectAcl(bucket string, key string, metadata *Metadata)
 	return err
 }
 
+// SetObjectMetadata会替换全部的header和自定义元数据，先合并已有的元数据
 func (h *hwStorager) setObjectHeader(bucket string, key string, metadata *Metadata) error {
+	old, err := h.HeadObject(bucket, key, metadata)
+	if err != nil {
+		return err
+	}
+	merged := mergeMetadata(old.Metadata, metadata)
+
 	input := new(obs.SetObjectMetadataInput)
 	input.Bucket = bucket
 	input.Key = key
-	setObsInput(nil, &input.HttpHeader, metadata)
+	setObsInput(nil, &input.HttpHeader, &merged)
+	setObsUserMeta(&input.Metadata, &merged)
 
-	_, err := h.client.SetObjectMetadata(input)
+	_, err = h.client.SetObjectMetadata(input)
 	return err
 }
 
@@ -335,19 +693,36 @@ func (h *hwStorager) GetDirTokenRead(bucket string, remoteDir string, expires ti
 // expires: 15min ~ 24h，默认15min
 func (h *hwStorager) createDirToken(bucket string, remoteDir string,
 	expires time.Duration, obsActions ...string) (*StsTokenInfo, error) {
+	return h.CreateToken(bucket, NewStsPolicy().Allow(obsActions...).Resource(remoteDir), expires)
+}
 
+// 通过token获取的临时AK没有会话名称
+func (h *hwStorager) CreateToken(bucket string, stsPolicy *StsPolicy, expires time.Duration) (*StsTokenInfo, error) {
 	identify := new(model.TokenAuthIdentity)
 	identify.Methods = []model.TokenAuthIdentityMethods{model.GetTokenAuthIdentityMethodsEnum().TOKEN}
 	identify.Token = new(model.IdentityToken)
 	identify.Token.DurationSeconds = utils.Ref(int32(expires.Seconds()))
 	policy := new(model.ServicePolicy)
 	policy.Version = "1.1"
-	resource := []string{fmt.Sprintf("obs:*:*:object:%s/%s*", bucket, remoteDir)}
+	resource := make([]string, 0, len(stsPolicy.resources))
+	for _, prefix := range stsPolicy.resources {
+		resource = append(resource, fmt.Sprintf("obs:*:*:object:%s/%s*", bucket, prefix))
+	}
+	var condition map[string]map[string][]string
+	if len(stsPolicy.sourceIPs) > 0 {
+		condition = map[string]map[string][]string{"IpAddress": {"g:SourceIp": stsPolicy.sourceIPs}}
+	}
+	if len(stsPolicy.referers) > 0 {
+		if condition == nil {
+			condition = make(map[string]map[string][]string)
+		}
+		condition["StringLike"] = map[string][]string{"obs:Referer": stsPolicy.referers}
+	}
 	policy.Statement = []model.ServiceStatement{{
 		Effect:    model.GetServiceStatementEffectEnum().ALLOW,
-		Action:    obsActions,
+		Action:    stsPolicy.providerActions(Huawei),
 		Resource:  &resource,
-		Condition: nil,
+		Condition: condition,
 	}}
 	auth := new(model.TokenAuth)
 	auth.Identity = identify
@@ -369,7 +744,7 @@ func (h *hwStorager) createDirToken(bucket string, remoteDir string,
 		Region:          h.config.Region,
 		Provider:        providerObs,
 		Expire:          time.Now().Add(expires).UnixMilli(),
-		UploadPath:      remoteDir,
+		UploadPath:      stsPolicy.resources[0],
 		Host:            h.config.Host,
 		Endpoint:        h.config.Endpoint,
 	}
@@ -392,12 +767,25 @@ func (h *hwStorager) PresignObject(bucket string, key string, expires time.Durat
 	return output.SignedUrl, nil
 }
 
-func (h *hwStorager) SignFile(bucket string, key string, expires time.Duration) (string, error) {
+func (h *hwStorager) SignFile(bucket string, key string, expires time.Duration, metadata *Metadata) (string, error) {
 	input := new(obs.CreateSignedUrlInput)
 	input.Bucket = bucket
 	input.Key = key
 	input.Expires = int(expires / time.Second)
 	input.Method = obs.HttpMethodGet
+	input.QueryParams = make(map[string]string)
+	if metadata != nil && metadata.process != nil {
+		name, value, err := metadata.process.render(Huawei)
+		if err != nil {
+			return "", err
+		}
+		input.QueryParams[name] = value
+	}
+	if metadata.hasResponseHeader() {
+		for name, value := range metadata.responseHeader {
+			input.QueryParams[name] = value
+		}
+	}
 
 	output, err := h.client.CreateSignedUrl(input)
 	if err != nil {
@@ -407,33 +795,100 @@ func (h *hwStorager) SignFile(bucket string, key string, expires time.Duration)
 	return output.SignedUrl, nil
 }
 
-func (h *hwStorager) GetObjectMeta(bucket string, key string) (*FileMeta, error) {
+func (h *hwStorager) GetObjectMeta(bucket string, key string, metadata *Metadata) (*FileMeta, error) {
+	res, err := h.HeadObject(bucket, key, metadata)
+	if err != nil {
+		return nil, err
+	}
+	acl, err := h.getObjectAcl(bucket, key, obsVersionID(metadata))
+	if err != nil {
+		return nil, err
+	}
+	res.Metadata.Acl = acl
+	return res, nil
+}
+
+func (h *hwStorager) HeadObject(bucket string, key string, metadata *Metadata) (*FileMeta, error) {
 	input := new(obs.GetObjectMetadataInput)
 	input.Bucket = bucket
 	input.Key = key
+	input.VersionId = obsVersionID(metadata)
+	input.SseHeader = obsSseCustomerHeader(metadata)
 
 	output, err := h.client.GetObjectMetadata(input)
 	if err != nil {
 		return nil, err
 	}
+	return obsOutputToFileMeta(key, output), nil
+}
+
+func obsOutputToFileMeta(key string, output *obs.GetObjectMetadataOutput) *FileMeta {
 	res := &FileMeta{
 		Key:          key,
 		Size:         output.ContentLength,
 		ETag:         output.ETag,
 		LastModified: output.LastModified,
-	}
-
-	acl, err := h.getObjectAcl(bucket, key)
-	if err != nil {
-		return nil, err
+		VersionID:    output.VersionId,
 	}
 	res.Metadata = Metadata{
 		ContentDisposition: output.ContentDisposition,
 		ContentType:        output.ContentType,
 		ContentEncoding:    output.ContentEncoding,
-		Acl:                acl,
+		UserMeta:           lowerUserMeta(output.Metadata),
 	}
-	return res, nil
+	switch sse := output.SseHeader.(type) {
+	case obs.SseCHeader:
+		res.Metadata.SSE = normalizeSSE("", sse.Encryption)
+	case obs.SseKmsHeader:
+		res.Metadata.SSE = normalizeSSE(sse.Encryption, "")
+		res.Metadata.SSEKeyID = sse.Key
+	}
+	return res
+}
+
+// 服务端加密的请求头，用于上传、复制的目标文件
+func obsSseHeader(metadata *Metadata) obs.ISseHeader {
+	if metadata == nil {
+		return nil
+	}
+	if metadata.hasSSECustomerKey() {
+		return obsSseCustomerHeader(metadata)
+	}
+	switch metadata.SSE {
+	case SSEAes256:
+		return obs.SseKmsHeader{Encryption: "AES256"}
+	case SSEKms:
+		return obs.SseKmsHeader{Encryption: obs.DEFAULT_SSE_KMS_ENCRYPTION_OBS, Key: metadata.SSEKeyID}
+	}
+	return nil
+}
+
+// SSE-C的请求头，SSE-C的文件在读取、复制源文件时也需要
+func obsSseCustomerHeader(metadata *Metadata) obs.ISseHeader {
+	if !metadata.hasSSECustomerKey() {
+		return nil
+	}
+	key, keyMd5 := metadata.sseCustomerKeyBase64()
+	return obs.SseCHeader{Encryption: obs.DEFAULT_SSE_C_ENCRYPTION, Key: key, KeyMD5: keyMd5}
+}
+
+// 读取、复制源文件的版本ID，为空表示最新版本
+func obsVersionID(metadata *Metadata) string {
+	if !metadata.hasVersionID() {
+		return ""
+	}
+	return metadata.versionID
+}
+
+// 条件写入的请求头，sdk的扩展参数类型未导出，所以返回请求头的key和value，key为空表示没有条件
+func obsConditionHeader(metadata *Metadata) (string, string) {
+	if !metadata.hasCondition() {
+		return "", ""
+	}
+	if metadata.forbidOverwrite {
+		return "If-None-Match", "*"
+	}
+	return "If-Match", metadata.ifMatch
 }
 
 func setObsInput(acl *obs.AclType, header *obs.HttpHeader, metadata *Metadata) {
@@ -459,3 +914,167 @@ func setObsInput(acl *obs.AclType, header *obs.HttpHeader, metadata *Metadata) {
 		}
 	}
 }
+
+func setObsUserMeta(meta *map[string]string, metadata *Metadata) {
+	if metadata == nil || len(metadata.UserMeta) == 0 {
+		return
+	}
+	if *meta == nil {
+		*meta = make(map[string]string, len(metadata.UserMeta))
+	}
+	for k, v := range metadata.UserMeta {
+		(*meta)[k] = v
+	}
+}
+
+func (h *hwStorager) InitiateMultipartUpload(bucket string, key string, metadata *Metadata) (string, error) {
+	input := new(obs.InitiateMultipartUploadInput)
+	input.Bucket = bucket
+	input.Key = key
+	input.SseHeader = obsSseHeader(metadata)
+	setObsInput(&input.ACL, &input.HttpHeader, metadata)
+	setObsUserMeta(&input.Metadata, metadata)
+	output, err := h.client.InitiateMultipartUpload(input)
+	if err != nil {
+		logger.Error("obs InitiateMultipartUpload failed, key: %s, err: %s", key, err)
+		return "", err
+	}
+	return output.UploadId, nil
+}
+
+func (h *hwStorager) UploadPart(bucket string, key string, uploadID string, partNumber int, r io.Reader,
+	size int64, metadata *Metadata) (string, error) {
+	input := new(obs.UploadPartInput)
+	input.Bucket = bucket
+	input.Key = key
+	input.UploadId = uploadID
+	input.PartNumber = partNumber
+	input.Body = r
+	input.PartSize = size
+	input.SseHeader = obsSseCustomerHeader(metadata)
+	output, err := h.client.UploadPart(input)
+	if err != nil {
+		return "", err
+	}
+	return output.ETag, nil
+}
+
+func (h *hwStorager) PresignUploadPart(bucket string, key string, uploadID string, partNumber int,
+	expires time.Duration) (string, error) {
+	input := new(obs.CreateSignedUrlInput)
+	input.Bucket = bucket
+	input.Key = key
+	input.Expires = int(expires / time.Second)
+	input.Method = obs.HttpMethodPut
+	input.QueryParams = map[string]string{"partNumber": strconv.Itoa(partNumber), "uploadId": uploadID}
+	output, err := h.client.CreateSignedUrl(input)
+	if err != nil {
+		logger.Error("obs createSignedUrl[UploadPart] failed, key: %s, err: %s", key, err)
+		return "", err
+	}
+	return output.SignedUrl, nil
+}
+
+func (h *hwStorager) CompleteMultipartUpload(bucket string, key string, uploadID string, parts []UploadedPart,
+	metadata *Metadata) error {
+	input := new(obs.CompleteMultipartUploadInput)
+	input.Bucket = bucket
+	input.Key = key
+	input.UploadId = uploadID
+	for _, part := range parts {
+		input.Parts = append(input.Parts, obs.Part{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+
+	var err error
+	if name, value := obsConditionHeader(metadata); name != "" {
+		_, err = h.client.CompleteMultipartUpload(input, obs.WithCustomHeader(name, value))
+	} else {
+		_, err = h.client.CompleteMultipartUpload(input)
+	}
+	return err
+}
+
+func (h *hwStorager) AbortMultipartUpload(bucket string, key string, uploadID string) error {
+	input := new(obs.AbortMultipartUploadInput)
+	input.Bucket = bucket
+	input.Key = key
+	input.UploadId = uploadID
+	_, err := h.client.AbortMultipartUpload(input)
+	return err
+}
+
+func (h *hwStorager) ListMultipartUploads(bucket string, prefix string) ([]MultipartUpload, error) {
+	input := new(obs.ListMultipartUploadsInput)
+	input.Bucket = bucket
+	input.Prefix = prefix
+	var res []MultipartUpload
+	for {
+		output, err := h.client.ListMultipartUploads(input)
+		if err != nil {
+			return res, err
+		}
+		for _, upload := range output.Uploads {
+			res = append(res, MultipartUpload{Key: upload.Key, UploadID: upload.UploadId, Initiated: upload.Initiated})
+		}
+		if !output.IsTruncated {
+			return res, nil
+		}
+		input.KeyMarker, input.UploadIdMarker = output.NextKeyMarker, output.NextUploadIdMarker
+	}
+}
+
+func (h *hwStorager) ListParts(bucket string, key string, uploadID string) ([]UploadedPart, error) {
+	input := new(obs.ListPartsInput)
+	input.Bucket = bucket
+	input.Key = key
+	input.UploadId = uploadID
+	var res []UploadedPart
+	for {
+		output, err := h.client.ListParts(input)
+		if err != nil {
+			return res, err
+		}
+		for _, part := range output.Parts {
+			res = append(res, UploadedPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: part.Size,
+				LastModified: part.LastModified})
+		}
+		if !output.IsTruncated {
+			return res, nil
+		}
+		input.PartNumberMarker = output.NextPartNumberMarker
+	}
+}
+
+func (h *hwStorager) UploadPartCopy(bucket string, srcKey string, destKey string, uploadID string, partNumber int,
+	offset int64, size int64, metadata *Metadata) (string, error) {
+	input := new(obs.CopyPartInput)
+	input.Bucket = bucket
+	input.Key = destKey
+	input.UploadId = uploadID
+	input.PartNumber = partNumber
+	input.CopySourceBucket = bucket
+	input.CopySourceKey = srcKey
+	input.CopySourceVersionId = obsVersionID(metadata)
+	input.CopySourceRangeStart = offset
+	input.CopySourceRangeEnd = offset + size - 1
+	input.SseHeader = obsSseCustomerHeader(metadata)
+	input.SourceSseHeader = obsSseCustomerHeader(metadata)
+	output, err := h.client.CopyPart(input)
+	if err != nil {
+		return "", err
+	}
+	return output.ETag, nil
+}
+
+// obs的事件通知需要通过SMN推送
+func (h *hwStorager) ListenObjectEvents(bucket string, prefix string, done <-chan struct{}) (<-chan ObjectEvent, error) {
+	return nil, ErrNotSupported
+}
+
+func (h *hwStorager) AsyncFetch(bucket string, key string, url string, metadata *Metadata) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (h *hwStorager) GetAsyncFetch(bucket string, taskID string) (*FetchTask, error) {
+	return nil, ErrNotSupported
+}
@@ -2,20 +2,37 @@ package oss
 
 import (
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/hqmin9527/kits-go/src/logger"
 	"github.com/hqmin9527/kits-go/src/utils"
 	"github.com/minio/minio-go/v6"
 	"github.com/minio/minio-go/v6/pkg/credentials"
+	"github.com/minio/minio-go/v6/pkg/encrypt"
+	"github.com/minio/minio-go/v6/pkg/s3utils"
+	"github.com/minio/minio-go/v6/pkg/signer"
 	"github.com/pkg/errors"
 )
 
+// MinIO要求token的有效期不少于15分钟
+const minioMinStsSeconds = 900
+
 type minStorager struct {
-	config *Config
-	client *minio.Client
+	config    *Config
+	client    *minio.Client
+	transport http.RoundTripper // 预签名请求和STS请求使用，与client共用连接
 }
 
 func newMinioStorager(c *Config) (*minStorager, error) {
@@ -25,11 +42,76 @@ func newMinioStorager(c *Config) (*minStorager, error) {
 	if err != nil {
 		return nil, errors.Wrap(err, "create minio client")
 	}
-	return &minStorager{config: c, client: client}, nil
+	transport, err := minio.DefaultTransport(false)
+	if err != nil {
+		return nil, errors.Wrap(err, "create minio transport")
+	}
+	client.SetCustomTransport(&minioHeaderTransport{base: transport})
+	return &minStorager{config: c, client: client, transport: transport}, nil
+}
+
+// minio-go v6不支持自定义请求头，条件请求头通过context传给Transport，在签名之后添加（不参与签名）
+type minioHeaderKey struct{}
+
+func minioHeaderContext(header http.Header) context.Context {
+	ctx := context.Background()
+	if len(header) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, minioHeaderKey{}, header)
+}
+
+type minioHeaderTransport struct {
+	base http.RoundTripper
+}
+
+func (t *minioHeaderTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	header, _ := req.Context().Value(minioHeaderKey{}).(http.Header)
+	if len(header) == 0 {
+		return t.base.RoundTrip(req)
+	}
+	// 分片上传的初始化和上传分片不需要条件，只作用于最终的PUT、完成分片上传、复制和删除
+	query := req.URL.Query()
+	if _, ok := query["uploads"]; ok || query.Get("partNumber") != "" {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	return t.base.RoundTrip(req)
 }
 
-func (m *minStorager) GetObject(bucket string, key string) (byte []byte, er error) {
-	obj, err := m.client.GetObject(bucket, key, minio.GetObjectOptions{})
+// 条件写入的请求头
+func minioConditionHeader(metadata *Metadata) http.Header {
+	if !metadata.hasCondition() {
+		return nil
+	}
+	header := make(http.Header)
+	if metadata.forbidOverwrite {
+		header.Set("If-None-Match", "*")
+	} else {
+		header.Set("If-Match", metadata.ifMatch)
+	}
+	return header
+}
+
+func (m *minStorager) GetObject(bucket string, key string, metadata *Metadata) (byte []byte, er error) {
+	if metadata.hasVersionID() {
+		body, _, err := m.getVersion(bucket, key, "", metadata)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = body.Close()
+		}()
+		return io.ReadAll(body)
+	}
+	opts, err := metadataToGetObjOptions(metadata)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := m.client.GetObject(bucket, key, opts)
 	if err != nil {
 		return nil, err
 	}
@@ -39,8 +121,56 @@ func (m *minStorager) GetObject(bucket string, key string) (byte []byte, er erro
 	return buf.Bytes(), nil
 }
 
-func (m *minStorager) GetFile(bucket string, key string, localFile string) error {
-	return m.client.FGetObject(bucket, key, localFile, minio.GetObjectOptions{})
+func (m *minStorager) GetFile(bucket string, key string, localFile string, metadata *Metadata) error {
+	if metadata.hasVersionID() {
+		body, _, err := m.getVersion(bucket, key, "", metadata)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = body.Close()
+		}()
+		fd, err := os.Create(localFile)
+		if err != nil {
+			return err
+		}
+		if _, err = io.Copy(fd, body); err != nil {
+			_ = fd.Close()
+			return err
+		}
+		return fd.Close()
+	}
+	opts, err := metadataToGetObjOptions(metadata)
+	if err != nil {
+		return err
+	}
+	return m.client.FGetObject(bucket, key, localFile, opts)
+}
+
+func (m *minStorager) GetReader(bucket string, key string, offset int64, length int64,
+	metadata *Metadata) (io.ReadCloser, *FileMeta, error) {
+
+	if metadata.hasVersionID() {
+		return m.getVersion(bucket, key, formatRange(offset, length), metadata)
+	}
+	opts, err := metadataToGetObjOptions(metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	if rng := formatRange(offset, length); rng != "" {
+		opts.Set("Range", "bytes="+rng)
+	}
+	core := minio.Core{Client: m.client}
+	body, info, header, err := core.GetObject(bucket, key, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := objectInfoToContent(&info)
+	res.VersionID = header.Get("X-Amz-Version-Id")
+	if size := parseContentRangeSize(header.Get("Content-Range")); size >= 0 {
+		res.Size = size
+	}
+	return body, res, nil
 }
 
 func (m *minStorager) PutObject(bucket string, key string, data []byte, metadata map[string]string) error {
@@ -49,7 +179,12 @@ func (m *minStorager) PutObject(bucket string, key string, data []byte, metadata
 }
 
 func (m *minStorager) PutObjectWithMeta(bucket string, key string, data []byte, metadata *Metadata) error {
-	_, err := m.client.PutObject(bucket, key, bytes.NewBuffer(data), int64(len(data)), metadataToPutObjOptions(metadata))
+	opts, err := metadataToPutObjOptions(metadata)
+	if err != nil {
+		return err
+	}
+	ctx := minioHeaderContext(minioConditionHeader(metadata))
+	_, err = m.client.PutObjectWithContext(ctx, bucket, key, bytes.NewBuffer(data), int64(len(data)), opts)
 	return err
 }
 
@@ -59,7 +194,11 @@ func (m *minStorager) PutFile(bucket string, key string, srcFile string, metadat
 }
 
 func (m *minStorager) PutFileWithMeta(bucket string, key string, srcFile string, metadata *Metadata) error {
-	_, err := m.client.FPutObject(bucket, key, srcFile, metadataToPutObjOptions(metadata))
+	opts, err := metadataToPutObjOptions(metadata)
+	if err != nil {
+		return err
+	}
+	_, err = m.client.FPutObjectWithContext(minioHeaderContext(minioConditionHeader(metadata)), bucket, key, srcFile, opts)
 	return err
 }
 
@@ -72,22 +211,55 @@ func (m *minStorager) PutReaderWithMeta(bucket string, key string, r io.Reader,
 }
 
 func (m *minStorager) ListObjects(bucket string, prefix string) ([]FileMeta, error) {
+	res := make([]FileMeta, 0, 32)
+	err := m.WalkObjects(bucket, prefix, func(meta *FileMeta) error {
+		// protect
+		if len(res) >= 100000 {
+			return errors.New("too much data, break")
+		}
+		res = append(res, *meta)
+		return nil
+	})
+	return res, err
+}
+
+func (m *minStorager) WalkObjects(bucket string, prefix string, fn func(meta *FileMeta) error) error {
 	doneCh := make(chan struct{})
 	defer close(doneCh)
 
-	res := make([]FileMeta, 0, 32)
 	// List all objects from a bucket-name with a matching prefix.
 	for object := range m.client.ListObjectsV2(bucket, prefix, true, doneCh) {
 		if object.Err != nil {
-			return res, object.Err
+			return object.Err
 		}
-		// protect
-		if len(res) >= 100000 {
-			return res, errors.New("too much data, break")
+		if err := fn(objectInfoToContent(&object)); err != nil {
+			return err
 		}
-		res = append(res, *objectInfoToContent(&object))
 	}
-	return res, nil
+	return nil
+}
+
+func (m *minStorager) ListDir(bucket string, prefix string) ([]string, []FileMeta, error) {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+
+	var dirs []string
+	files := make([]FileMeta, 0, 32)
+	// 非递归列举时，公共前缀也作为对象返回，key以"/"结尾
+	for object := range m.client.ListObjectsV2(bucket, prefix, false, doneCh) {
+		if object.Err != nil {
+			return dirs, files, object.Err
+		}
+		if object.Key == prefix {
+			continue
+		}
+		if strings.HasSuffix(object.Key, "/") {
+			dirs = append(dirs, object.Key)
+			continue
+		}
+		files = append(files, *objectInfoToContent(&object))
+	}
+	return dirs, files, nil
 }
 
 func objectInfoToContent(obj *minio.ObjectInfo) *FileMeta {
@@ -96,33 +268,108 @@ func objectInfoToContent(obj *minio.ObjectInfo) *FileMeta {
 		Size:         obj.Size,
 		ETag:         obj.ETag,
 		LastModified: obj.LastModified,
+		StorageClass: fromMinioStorageClass(obj.StorageClass),
 	}
 	res.Metadata = Metadata{
 		ContentType:        obj.ContentType,
 		ContentEncoding:    obj.Metadata.Get("content-encoding"),
 		ContentDisposition: obj.Metadata.Get("content-disposition"),
+		UserMeta:           lowerUserMeta(obj.UserMetadata),
+		SSE: normalizeSSE(obj.Metadata.Get("X-Amz-Server-Side-Encryption"),
+			obj.Metadata.Get("X-Amz-Server-Side-Encryption-Customer-Algorithm")),
+		SSEKeyID: obj.Metadata.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"),
 	}
 	return res
 }
 
+// S3的存储类型为STANDARD、STANDARD_IA、GLACIER等，MinIO默认只有STANDARD
+func fromMinioStorageClass(class string) StorageClass {
+	switch class {
+	case "", "STANDARD":
+		return StorageStandard
+	case "STANDARD_IA":
+		return StorageIA
+	case "GLACIER", "DEEP_ARCHIVE":
+		return StorageArchive
+	}
+	return StorageClass(class)
+}
+
 func (m *minStorager) DeleteObject(bucket string, key string) error {
 	return m.client.RemoveObject(bucket, key)
 }
 
+// 旧版本的minio会忽略DELETE的If-Match，先HEAD比较ETag，不一致时返回ErrPreconditionFailed
+// HEAD和DELETE之间文件被修改时仍会删除，支持If-Match的版本由服务端再次判断
+func (m *minStorager) DeleteObjectIfMatch(bucket string, key string, etag string) error {
+	info, err := m.client.StatObject(bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return err
+	}
+	if QuoteETag(info.ETag) != etag {
+		return ErrPreconditionFailed
+	}
+	// RemoveObject不支持context，使用预签名请求
+	header := make(http.Header)
+	header.Set("If-Match", etag)
+	resp, err := m.doPresigned(http.MethodDelete, bucket, key, nil, header, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
 func (m *minStorager) CopyObject(bucket string, srcKey string, destKey string, metadata *Metadata) error {
+	if metadata.hasVersionID() {
+		return m.copyVersion(bucket, srcKey, destKey, metadata)
+	}
 	// Source object
-	src := minio.NewSourceInfo(bucket, srcKey, nil)
+	// SSE-C的源文件需要密钥才能读取
+	srcSse, err := minioSseCustomer(metadata)
+	if err != nil {
+		return err
+	}
+	src := minio.NewSourceInfo(bucket, srcKey, srcSse)
 	// _ = src.SetModifiedSinceCond(time.Now())
 	// Destination object
-	userMeta := metadataToUserMeta(metadata)
-	dst, err := minio.NewDestinationInfo(bucket, destKey, nil, userMeta)
+	dstSse, err := minioSse(metadata)
 	if err != nil {
 		return err
 	}
-	if err = m.client.CopyObject(dst, src); err != nil {
+	userMeta := metadataToUserMeta(metadata)
+	dst, err := minio.NewDestinationInfo(bucket, destKey, dstSse, userMeta)
+	if err != nil {
 		return err
 	}
-	return nil
+	if !metadata.hasCondition() {
+		return m.client.CopyObject(dst, src)
+	}
+	// Client.CopyObject不支持context，条件复制使用Core，调用方保证源文件不超过5GB
+	header := make(http.Header)
+	if srcSse != nil {
+		encrypt.SSECopy(srcSse).Marshal(header)
+	}
+	if dstSse != nil {
+		dstSse.Marshal(header)
+	}
+	copyMeta := make(map[string]string, len(header)+len(userMeta)+1)
+	for k := range header {
+		copyMeta[k] = header.Get(k)
+	}
+	if len(userMeta) > 0 {
+		copyMeta["x-amz-metadata-directive"] = "REPLACE"
+	}
+	for k, v := range userMeta {
+		if strings.HasPrefix(k, "Content-") {
+			copyMeta[k] = v
+		} else {
+			copyMeta["x-amz-meta-"+k] = v
+		}
+	}
+	core := minio.Core{Client: m.client}
+	_, err = core.CopyObjectWithContext(minioHeaderContext(minioConditionHeader(metadata)), bucket, srcKey, bucket, destKey,
+		copyMeta)
+	return err
 }
 
 func (m *minStorager) SetObjectAcl(bucket string, key string, acl ACL) error {
@@ -136,7 +383,7 @@ func (m *minStorager) SetObjectMeta(bucket string, key string, metadata *Metadat
 }
 
 func (m *minStorager) IsObjectExist(bucket string, key string) (bool, error) {
-	res, err := m.GetObjectMeta(bucket, key)
+	res, err := m.GetObjectMeta(bucket, key, nil)
 	switch err := err.(type) {
 	case minio.ErrorResponse:
 		if err.Code == "NoSuchKey" {
@@ -150,33 +397,105 @@ func (m *minStorager) IsObjectExist(bucket string, key string) (bool, error) {
 }
 
 func (m *minStorager) GetDirToken(bucket string, remoteDir string, expires time.Duration) (*StsTokenInfo, error) {
-	li, err := credentials.NewSTSAssumeRole("http://"+m.config.Endpoint, credentials.STSAssumeRoleOptions{
-		AccessKey:       "rw_client",
-		SecretKey:       "#$infi0831",
-		DurationSeconds: int(expires.Seconds()),
-	})
+	return m.CreateToken(bucket, NewStsPolicy().Allow(StsActionPut, StsActionGet).Resource(remoteDir), expires)
+}
+
+// 使用Config中的StsAccessKey签发，token的权限通过会话策略限制，不能限制来源IP和Referer
+func (m *minStorager) CreateToken(bucket string, stsPolicy *StsPolicy, expires time.Duration) (*StsTokenInfo, error) {
+	if stsPolicy.hasCondition() || m.config.StsAccessKey == "" {
+		return nil, ErrNotSupported
+	}
+	policy, err := minioPolicy(bucket, stsPolicy)
 	if err != nil {
 		return nil, err
 	}
-	to, err := li.Get()
+	res, err := m.assumeRole(policy, stsPolicy.session(), expires)
 	if err != nil {
 		return nil, err
 	}
+	cred := res.Result.Credentials
 	// url to StsTokenInfo
 	return &StsTokenInfo{
 		Provider:        providerMinio,
-		AccessKeyID:     to.AccessKeyID,
-		AccessKeySecret: to.SecretAccessKey,
-		StsToken:        to.SessionToken,
+		AccessKeyID:     cred.AccessKey,
+		AccessKeySecret: cred.SecretKey,
+		StsToken:        cred.SessionToken,
 		Bucket:          bucket,
 		Region:          m.config.Region,
 		Expire:          time.Now().Add(expires).UnixMilli(),
-		UploadPath:      remoteDir,
+		UploadPath:      stsPolicy.resources[0],
 		Host:            fmt.Sprintf("%s://%s", m.config.Protocol, m.config.Host),
 		Endpoint:        m.config.Endpoint,
 	}, nil
 }
 
+// 平台无关的action对应的MinIO action，put包括分片上传
+var minioStsActions = map[string][]string{
+	StsActionGet:    {"s3:GetObject"},
+	StsActionPut:    {"s3:PutObject", "s3:AbortMultipartUpload", "s3:ListMultipartUploadParts"},
+	StsActionDelete: {"s3:DeleteObject"},
+}
+
+// 会话策略，不是s3:开头的平台原生action无法限制，返回ErrNotSupported
+func minioPolicy(bucket string, stsPolicy *StsPolicy) (string, error) {
+	var actions []string
+	for _, action := range stsPolicy.actions {
+		if mapped, ok := minioStsActions[action]; ok {
+			actions = append(actions, mapped...)
+		} else if strings.HasPrefix(action, "s3:") {
+			actions = append(actions, action)
+		} else {
+			return "", ErrNotSupported
+		}
+	}
+	policy := Policy{Version: "2012-10-17"}
+	for _, resource := range stsPolicy.resources {
+		policy.Statement = append(policy.Statement, Statement{
+			Effect:   "Allow",
+			Action:   actions,
+			Resource: fmt.Sprintf("arn:aws:s3:::%s/%s*", bucket, resource),
+		})
+	}
+	data, err := json.Marshal(policy)
+	return string(data), err
+}
+
+// SDK的STSAssumeRoleOptions不支持会话策略，按SDK的实现发送AssumeRole请求，并带上Policy
+func (m *minStorager) assumeRole(policy string, session string, expires time.Duration) (*credentials.AssumeRoleResponse, error) {
+	v := url.Values{}
+	v.Set("Action", "AssumeRole")
+	v.Set("Version", "2011-06-15")
+	v.Set("RoleSessionName", session)
+	v.Set("Policy", policy)
+	v.Set("DurationSeconds", strconv.Itoa(max(int(expires.Seconds()), minioMinStsSeconds)))
+	body := v.Encode()
+	sum := sha256.Sum256([]byte(body))
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+m.config.Endpoint+"/", strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(sum[:]))
+	req = signer.SignV4STS(*req, m.config.StsAccessKey, m.config.StsSecretKey, "")
+
+	resp, err := (&http.Client{Transport: m.transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("minio assume role failed, status: %s", resp.Status)
+	}
+	res := &credentials.AssumeRoleResponse{}
+	if err = xml.NewDecoder(resp.Body).Decode(res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
 func (m *minStorager) GetDirTokenRead(bucket string, remoteDir string, expires time.Duration) (*StsTokenInfo, error) {
 	return m.GetDirToken(bucket, remoteDir, expires)
 }
@@ -194,7 +513,22 @@ func (m *minStorager) PresignObject(bucket string, key string, expires time.Dura
 	// return uploadUrl, nil
 }
 
-func (m *minStorager) SignFile(bucket string, key string, expires time.Duration) (string, error) {
+func (m *minStorager) SignFile(bucket string, key string, expires time.Duration, metadata *Metadata) (string, error) {
+	if metadata != nil && metadata.process != nil {
+		return "", ErrNotSupported
+	}
+	// 覆盖响应头时需要签名，否则返回公开地址
+	if metadata.hasResponseHeader() {
+		reqParams := make(url.Values)
+		for name, value := range metadata.responseHeader {
+			reqParams.Set(name, value)
+		}
+		u, err := m.client.PresignedGetObject(bucket, key, expires, reqParams)
+		if err != nil {
+			return "", err
+		}
+		return u.String(), nil
+	}
 	res := ""
 	if m.config.DownloadDomain != "" {
 		res = fmt.Sprintf("https://%s/%s/%s", m.config.DownloadDomain, bucket, key)
@@ -204,7 +538,11 @@ func (m *minStorager) SignFile(bucket string, key string, expires time.Duration)
 	return res, nil
 }
 
-func (m *minStorager) GetObjectMeta(bucket string, key string) (*FileMeta, error) {
+func (m *minStorager) GetObjectMeta(bucket string, key string, metadata *Metadata) (*FileMeta, error) {
+	// 多版本和SSE-C的文件需要带上版本ID和密钥，不获取ACL
+	if metadata.hasVersionID() || metadata.hasSSECustomerKey() {
+		return m.HeadObject(bucket, key, metadata)
+	}
 	objInfo, err := m.client.GetObjectACL(bucket, key)
 	if objInfo == nil {
 		return nil, err
@@ -212,14 +550,406 @@ func (m *minStorager) GetObjectMeta(bucket string, key string) (*FileMeta, error
 	return objectInfoToContent(objInfo), err
 }
 
-func metadataToPutObjOptions(metadata *Metadata) minio.PutObjectOptions {
+func (m *minStorager) HeadObject(bucket string, key string, metadata *Metadata) (*FileMeta, error) {
+	if metadata.hasVersionID() {
+		resp, err := m.doPresigned(http.MethodHead, bucket, key, minioVersionQuery(metadata), nil, metadata)
+		if err != nil {
+			return nil, err
+		}
+		_ = resp.Body.Close()
+		return minioHeaderToFileMeta(bucket, key, resp.Header)
+	}
+	opts, err := metadataToGetObjOptions(metadata)
+	if err != nil {
+		return nil, err
+	}
+	objInfo, err := m.client.StatObject(bucket, key, minio.StatObjectOptions{GetObjectOptions: opts})
+	if err != nil {
+		return nil, err
+	}
+	return objectInfoToContent(&objInfo), nil
+}
+
+func (m *minStorager) SetBucketVersioning(bucket string, enabled bool) error {
+	if enabled {
+		return m.client.EnableVersioning(bucket)
+	}
+	// minio的DisableVersioning实际是暂停多版本
+	return m.client.DisableVersioning(bucket)
+}
+
+func (m *minStorager) GetBucketVersioning(bucket string) (string, error) {
+	config, err := m.client.GetBucketVersioning(bucket)
+	if err != nil {
+		return "", err
+	}
+	return config.Status, nil
+}
+
+func (m *minStorager) ListObjectVersions(bucket string, prefix string) ([]FileMeta, error) {
+	query := make(url.Values)
+	query.Set("versions", "")
+	query.Set("prefix", prefix)
+	query.Set("max-keys", "1000")
+
+	result := make([]FileMeta, 0, 32)
+	for {
+		resp, err := m.doPresigned(http.MethodGet, bucket, "", query, nil, nil)
+		if err != nil {
+			return sortVersions(result), err
+		}
+		lsRes, err := parseMinioListVersions(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return sortVersions(result), err
+		}
+		result = append(result, lsRes.fileMetas()...)
+
+		if !lsRes.IsTruncated {
+			break
+		}
+		query.Set("key-marker", lsRes.NextKeyMarker)
+		query.Set("version-id-marker", lsRes.NextVersionIdMarker)
+	}
+	return sortVersions(result), nil
+}
+
+func (m *minStorager) DeleteObjectVersion(bucket string, key string, versionID string) error {
+	return m.client.RemoveObjectWithOptions(bucket, key, minio.RemoveObjectOptions{VersionID: versionID})
+}
+
+// minio-go v6不支持读取指定版本、列举版本，通过预签名url直接请求，和默认客户端共用连接
+// header为额外的请求头（如Range），SSE-C的文件会带上密钥
+func (m *minStorager) doPresigned(method string, bucket string, key string, query url.Values,
+	header http.Header, metadata *Metadata) (*http.Response, error) {
+
+	u, err := m.client.Presign(method, bucket, key, time.Minute, query)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	sse, err := minioSseCustomer(metadata)
+	if err != nil {
+		return nil, err
+	}
+	if sse != nil {
+		sse.Marshal(req.Header)
+	}
+	resp, err := (&http.Client{Transport: m.transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		defer func() {
+			_ = resp.Body.Close()
+		}()
+		return nil, minioErrorResponse(resp, bucket, key)
+	}
+	return resp, nil
+}
+
+// 读取指定版本，rng为空表示读取整个文件
+func (m *minStorager) getVersion(bucket string, key string, rng string,
+	metadata *Metadata) (io.ReadCloser, *FileMeta, error) {
+
+	var header http.Header
+	if rng != "" {
+		header = http.Header{"Range": []string{"bytes=" + rng}}
+	}
+	resp, err := m.doPresigned(http.MethodGet, bucket, key, minioVersionQuery(metadata), header, metadata)
+	if err != nil {
+		return nil, nil, err
+	}
+	res, err := minioHeaderToFileMeta(bucket, key, resp.Header)
+	if err != nil {
+		_ = resp.Body.Close()
+		return nil, nil, err
+	}
+	return resp.Body, res, nil
+}
+
+// 复制指定版本：服务端复制不支持指定源文件版本，读取后重新上传，保留源文件的元数据
+func (m *minStorager) copyVersion(bucket string, srcKey string, destKey string, metadata *Metadata) error {
+	body, src, err := m.getVersion(bucket, srcKey, "", metadata)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = body.Close()
+	}()
+	merged := mergeMetadata(src.Metadata, metadata)
+	opts, err := metadataToPutObjOptions(&merged)
+	if err != nil {
+		return err
+	}
+	_, err = m.client.PutObjectWithContext(minioHeaderContext(minioConditionHeader(metadata)), bucket, destKey, body,
+		src.Size, opts)
+	return err
+}
+
+func minioVersionQuery(metadata *Metadata) url.Values {
+	query := make(url.Values)
+	query.Set("versionId", metadata.versionID)
+	return query
+}
+
+// 从响应头中解析文件信息，Range请求时Size为文件总大小
+func minioHeaderToFileMeta(bucket string, key string, header http.Header) (*FileMeta, error) {
+	info, err := minio.ToObjectInfo(bucket, key, header)
+	if err != nil {
+		return nil, err
+	}
+	res := objectInfoToContent(&info)
+	res.VersionID = header.Get("X-Amz-Version-Id")
+	if size := parseContentRangeSize(header.Get("Content-Range")); size >= 0 {
+		res.Size = size
+	}
+	return res, nil
+}
+
+// 把错误响应转为minio.ErrorResponse，HEAD请求没有响应体时根据状态码填充
+func minioErrorResponse(resp *http.Response, bucket string, key string) error {
+	var errResp minio.ErrorResponse
+	if err := xml.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		errResp = minio.ErrorResponse{Code: http.StatusText(resp.StatusCode), BucketName: bucket, Key: key}
+		if resp.StatusCode == http.StatusNotFound {
+			errResp.Code = utils.If(key == "", "NoSuchBucket", "NoSuchKey")
+		}
+	}
+	errResp.StatusCode = resp.StatusCode
+	return errResp
+}
+
+// ListObjectVersions的响应，ETag带有引号
+type minioListVersionsResult struct {
+	IsTruncated         bool
+	NextKeyMarker       string
+	NextVersionIdMarker string
+	Versions            []minioObjectVersion `xml:"Version"`
+	DeleteMarkers       []minioObjectVersion `xml:"DeleteMarker"`
+}
+
+type minioObjectVersion struct {
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified time.Time
+	ETag         string
+	Size         int64
+}
+
+func parseMinioListVersions(r io.Reader) (*minioListVersionsResult, error) {
+	res := new(minioListVersionsResult)
+	if err := xml.NewDecoder(r).Decode(res); err != nil {
+		return nil, errors.Wrap(err, "decode minio list versions result")
+	}
+	return res, nil
+}
+
+func (l *minioListVersionsResult) fileMetas() []FileMeta {
+	res := make([]FileMeta, 0, len(l.Versions)+len(l.DeleteMarkers))
+	for _, val := range l.Versions {
+		res = append(res, FileMeta{Key: val.Key, Size: val.Size, ETag: strings.Trim(val.ETag, "\""),
+			LastModified: val.LastModified, VersionID: val.VersionId, IsLatest: val.IsLatest})
+	}
+	for _, val := range l.DeleteMarkers {
+		res = append(res, FileMeta{Key: val.Key, LastModified: val.LastModified,
+			VersionID: val.VersionId, IsLatest: val.IsLatest, IsDeleteMarker: true})
+	}
+	return res
+}
+
+func (m *minStorager) CreateBucket(bucket string, acl ACL) error {
+	// minio没有bucket的acl，公共读写需要创建后通过bucket策略设置
+	if acl != "" && acl != ACL_PRIVATE {
+		return ErrNotSupported
+	}
+	return m.client.MakeBucket(bucket, "")
+}
+
+func (m *minStorager) DeleteBucket(bucket string) error {
+	return m.client.RemoveBucket(bucket)
+}
+
+func (m *minStorager) IsBucketExist(bucket string) (bool, error) {
+	return m.client.BucketExists(bucket)
+}
+
+func (m *minStorager) SetBucketAcl(bucket string, acl ACL) error {
+	return ErrNotSupported
+}
+
+func (m *minStorager) GetBucketAcl(bucket string) (ACL, error) {
+	return "", ErrNotSupported
+}
+
+// policy为空时sdk会删除bucket策略
+func (m *minStorager) SetBucketPolicy(bucket string, policy string) error {
+	return m.client.SetBucketPolicy(bucket, policy)
+}
+
+func (m *minStorager) GetBucketPolicy(bucket string) (string, error) {
+	return m.client.GetBucketPolicy(bucket)
+}
+
+// minio只支持过期删除和清理分片上传，转换存储类型需要在服务端配置远程存储层级
+func (m *minStorager) SetBucketLifecycle(bucket string, rules []LifecycleRule) error {
+	if len(rules) == 0 {
+		return m.client.SetBucketLifecycle(bucket, "")
+	}
+	for _, rule := range rules {
+		if len(rule.Transitions) > 0 {
+			return ErrNotSupported
+		}
+	}
+	data, err := xml.Marshal(newMinioLifecycle(rules))
+	if err != nil {
+		return err
+	}
+	return m.client.SetBucketLifecycle(bucket, string(data))
+}
+
+func (m *minStorager) GetBucketLifecycle(bucket string) ([]LifecycleRule, error) {
+	data, err := m.client.GetBucketLifecycle(bucket)
+	if err != nil || data == "" {
+		return nil, err
+	}
+	config := new(minioLifecycle)
+	if err = xml.Unmarshal([]byte(data), config); err != nil {
+		return nil, errors.Wrap(err, "decode minio lifecycle")
+	}
+	return config.rules(), nil
+}
+
+func (m *minStorager) SetBucketCORS(bucket string, rules []CORSRule) error {
+	return ErrNotSupported
+}
+
+func (m *minStorager) GetBucketCORS(bucket string) ([]CORSRule, error) {
+	return nil, ErrNotSupported
+}
+
+func (m *minStorager) SetBucketReferer(bucket string, config RefererConfig) error {
+	return ErrNotSupported
+}
+
+func (m *minStorager) GetBucketReferer(bucket string) (*RefererConfig, error) {
+	return nil, ErrNotSupported
+}
+
+// S3格式的生命周期配置，minio-go v6只接受xml字符串
+type minioLifecycle struct {
+	XMLName xml.Name             `xml:"LifecycleConfiguration"`
+	Rules   []minioLifecycleRule `xml:"Rule"`
+}
+
+type minioLifecycleRule struct {
+	ID           string            `xml:"ID,omitempty"`
+	Status       string            `xml:"Status"`
+	Prefix       string            `xml:"Prefix,omitempty"` // 旧格式，只用于读取
+	FilterPrefix string            `xml:"Filter>Prefix"`
+	Expiration   *minioExpiration  `xml:"Expiration,omitempty"`
+	AbortUpload  *minioAbortUpload `xml:"AbortIncompleteMultipartUpload,omitempty"`
+}
+
+type minioExpiration struct {
+	Days int `xml:"Days"`
+}
+
+type minioAbortUpload struct {
+	DaysAfterInitiation int `xml:"DaysAfterInitiation"`
+}
+
+func newMinioLifecycle(rules []LifecycleRule) *minioLifecycle {
+	config := new(minioLifecycle)
+	for _, rule := range rules {
+		minioRule := minioLifecycleRule{ID: rule.ID, Status: lifecycleStatus(rule), FilterPrefix: rule.Prefix}
+		if rule.ExpireDays > 0 {
+			minioRule.Expiration = &minioExpiration{Days: rule.ExpireDays}
+		}
+		if rule.AbortMultipartDays > 0 {
+			minioRule.AbortUpload = &minioAbortUpload{DaysAfterInitiation: rule.AbortMultipartDays}
+		}
+		config.Rules = append(config.Rules, minioRule)
+	}
+	return config
+}
+
+func (l *minioLifecycle) rules() []LifecycleRule {
+	rules := make([]LifecycleRule, 0, len(l.Rules))
+	for _, minioRule := range l.Rules {
+		rule := LifecycleRule{
+			ID:       minioRule.ID,
+			Prefix:   utils.If(minioRule.FilterPrefix != "", minioRule.FilterPrefix, minioRule.Prefix),
+			Disabled: minioRule.Status != "Enabled",
+		}
+		if minioRule.Expiration != nil {
+			rule.ExpireDays = minioRule.Expiration.Days
+		}
+		if minioRule.AbortUpload != nil {
+			rule.AbortMultipartDays = minioRule.AbortUpload.DaysAfterInitiation
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+func metadataToPutObjOptions(metadata *Metadata) (minio.PutObjectOptions, error) {
 	ops := minio.PutObjectOptions{}
 	if metadata != nil {
 		ops.ContentType = metadata.ContentType
 		ops.ContentEncoding = metadata.ContentEncoding
 		ops.ContentDisposition = metadata.ContentDisposition
+		ops.UserMetadata = metadata.UserMeta
+		sse, err := minioSse(metadata)
+		if err != nil {
+			return ops, err
+		}
+		ops.ServerSideEncryption = sse
 	}
-	return ops
+	return ops, nil
+}
+
+// 读取时只需要SSE-C的密钥
+func metadataToGetObjOptions(metadata *Metadata) (minio.GetObjectOptions, error) {
+	ops := minio.GetObjectOptions{}
+	sse, err := minioSseCustomer(metadata)
+	if err != nil {
+		return ops, err
+	}
+	ops.ServerSideEncryption = sse
+	return ops, nil
+}
+
+// 服务端加密，用于上传、复制的目标文件
+func minioSse(metadata *Metadata) (encrypt.ServerSide, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+	if metadata.hasSSECustomerKey() {
+		return minioSseCustomer(metadata)
+	}
+	switch metadata.SSE {
+	case SSEAes256:
+		return encrypt.NewSSE(), nil
+	case SSEKms:
+		return encrypt.NewSSEKMS(metadata.SSEKeyID, nil)
+	}
+	return nil, nil
+}
+
+// SSE-C，SSE-C的文件在读取、复制源文件时也需要
+func minioSseCustomer(metadata *Metadata) (encrypt.ServerSide, error) {
+	if !metadata.hasSSECustomerKey() {
+		return nil, nil
+	}
+	return encrypt.NewSSEC(metadata.sseCustomerKey)
 }
 
 func mapToPutObjOptions(metadata map[string]string) minio.PutObjectOptions {
@@ -260,5 +990,165 @@ func metadataToUserMeta(metadata *Metadata) map[string]string {
 	if metadata.ContentDisposition != "" {
 		res["Content-Disposition"] = metadata.ContentDisposition
 	}
+	for k, v := range metadata.UserMeta {
+		res[k] = v
+	}
 	return res
 }
+
+func (m *minStorager) InitiateMultipartUpload(bucket string, key string, metadata *Metadata) (string, error) {
+	ops, err := metadataToPutObjOptions(metadata)
+	if err != nil {
+		return "", err
+	}
+	core := minio.Core{Client: m.client}
+	return core.NewMultipartUpload(bucket, key, ops)
+}
+
+func (m *minStorager) UploadPart(bucket string, key string, uploadID string, partNumber int, r io.Reader,
+	size int64, metadata *Metadata) (string, error) {
+	sse, err := minioSseCustomer(metadata)
+	if err != nil {
+		return "", err
+	}
+	core := minio.Core{Client: m.client}
+	part, err := core.PutObjectPart(bucket, key, uploadID, partNumber, r, size, "", "", sse)
+	if err != nil {
+		return "", err
+	}
+	return part.ETag, nil
+}
+
+func (m *minStorager) PresignUploadPart(bucket string, key string, uploadID string, partNumber int,
+	expires time.Duration) (string, error) {
+	query := url.Values{"partNumber": {strconv.Itoa(partNumber)}, "uploadId": {uploadID}}
+	u, err := m.client.Presign(http.MethodPut, bucket, key, expires, query)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (m *minStorager) CompleteMultipartUpload(bucket string, key string, uploadID string, parts []UploadedPart,
+	metadata *Metadata) error {
+	completeParts := make([]minio.CompletePart, 0, len(parts))
+	for _, part := range parts {
+		completeParts = append(completeParts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	}
+	core := minio.Core{Client: m.client}
+	_, err := core.CompleteMultipartUploadWithContext(minioHeaderContext(minioConditionHeader(metadata)), bucket, key,
+		uploadID, completeParts)
+	return err
+}
+
+func (m *minStorager) AbortMultipartUpload(bucket string, key string, uploadID string) error {
+	core := minio.Core{Client: m.client}
+	return core.AbortMultipartUpload(bucket, key, uploadID)
+}
+
+func (m *minStorager) ListMultipartUploads(bucket string, prefix string) ([]MultipartUpload, error) {
+	core := minio.Core{Client: m.client}
+	var res []MultipartUpload
+	keyMarker, uploadIDMarker := "", ""
+	for {
+		result, err := core.ListMultipartUploads(bucket, prefix, keyMarker, uploadIDMarker, "", 1000)
+		if err != nil {
+			return res, err
+		}
+		for _, upload := range result.Uploads {
+			res = append(res, MultipartUpload{Key: upload.Key, UploadID: upload.UploadID, Initiated: upload.Initiated})
+		}
+		if !result.IsTruncated {
+			return res, nil
+		}
+		keyMarker, uploadIDMarker = result.NextKeyMarker, result.NextUploadIDMarker
+	}
+}
+
+func (m *minStorager) ListParts(bucket string, key string, uploadID string) ([]UploadedPart, error) {
+	core := minio.Core{Client: m.client}
+	var res []UploadedPart
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(bucket, key, uploadID, marker, 1000)
+		if err != nil {
+			return res, err
+		}
+		for _, part := range result.ObjectParts {
+			res = append(res, UploadedPart{PartNumber: part.PartNumber, ETag: part.ETag, Size: part.Size,
+				LastModified: part.LastModified})
+		}
+		if !result.IsTruncated {
+			return res, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+func (m *minStorager) UploadPartCopy(bucket string, srcKey string, destKey string, uploadID string, partNumber int,
+	offset int64, size int64, metadata *Metadata) (string, error) {
+	header := make(http.Header)
+	sse, err := minioSseCustomer(metadata)
+	if err != nil {
+		return "", err
+	}
+	if sse != nil {
+		// 目标文件和源文件的SSE-C密钥相同
+		sse.Marshal(header)
+		encrypt.SSECopy(sse).Marshal(header)
+	}
+	if metadata.hasVersionID() {
+		header.Set("X-Amz-Copy-Source", s3utils.EncodePath(bucket+"/"+srcKey)+"?versionId="+url.QueryEscape(metadata.versionID))
+	}
+	headers := make(map[string]string, len(header))
+	for k := range header {
+		headers[k] = header.Get(k)
+	}
+	core := minio.Core{Client: m.client}
+	part, err := core.CopyObjectPart(bucket, srcKey, bucket, destKey, uploadID, partNumber, offset, size, headers)
+	if err != nil {
+		return "", err
+	}
+	return part.ETag, nil
+}
+
+// 使用MinIO的ListenBucketNotification扩展接口，出错时关闭返回的channel
+func (m *minStorager) ListenObjectEvents(bucket string, prefix string, done <-chan struct{}) (<-chan ObjectEvent, error) {
+	events := []string{"s3:ObjectCreated:*", "s3:ObjectRemoved:*"}
+	infoCh := m.client.ListenBucketNotification(bucket, prefix, "", events, done)
+	res := make(chan ObjectEvent)
+	go func() {
+		defer close(res)
+		for info := range infoCh {
+			if info.Err != nil {
+				logger.Error("minio listen bucket notification failed, bucket: %s, err: %s", bucket, info.Err)
+				return
+			}
+			for _, record := range info.Records {
+				event := ObjectEvent{Type: ObjectCreated, Size: record.S3.Object.Size, ETag: record.S3.Object.ETag}
+				if strings.HasPrefix(record.EventName, "s3:ObjectRemoved:") {
+					event.Type = ObjectDeleted
+				}
+				// 事件中的key经过URL编码
+				if event.Key, _ = url.QueryUnescape(record.S3.Object.Key); event.Key == "" {
+					event.Key = record.S3.Object.Key
+				}
+				event.LastModified, _ = time.Parse(time.RFC3339, record.EventTime)
+				select {
+				case res <- event:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+	return res, nil
+}
+
+func (m *minStorager) AsyncFetch(bucket string, key string, url string, metadata *Metadata) (string, error) {
+	return "", ErrNotSupported
+}
+
+func (m *minStorager) GetAsyncFetch(bucket string, taskID string) (*FetchTask, error) {
+	return nil, ErrNotSupported
+}
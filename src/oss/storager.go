@@ -7,19 +7,75 @@ import (
 
 // 屏蔽不同平台的oss接口
 type storager interface {
-	GetObject(bucket string, key string) ([]byte, error)
-	GetFile(bucket string, key string, localFile string) error
+	// 读取类接口的metadata只使用其中的SSE-C密钥等请求参数，可以为nil
+	GetObject(bucket string, key string, metadata *Metadata) ([]byte, error)
+	GetFile(bucket string, key string, localFile string, metadata *Metadata) error
+	// 读取[offset, offset+length)范围的数据，length<0表示读到结尾；返回的FileMeta中Size为文件总大小
+	GetReader(bucket string, key string, offset int64, length int64, metadata *Metadata) (io.ReadCloser, *FileMeta, error)
 	PutObjectWithMeta(bucket string, key string, data []byte, metadata *Metadata) error
 	PutFileWithMeta(bucket string, key string, filePath string, metadata *Metadata) error
 	PutReaderWithMeta(bucket string, key string, reader io.Reader, metadata *Metadata) error
 	ListObjects(bucket string, prefix string) ([]FileMeta, error)
+	// 分页列举，每个文件调用一次fn，fn返回错误时停止；FileMeta中包含存储类型
+	WalkObjects(bucket string, prefix string, fn func(meta *FileMeta) error) error
+	// 使用"/"分隔符只列举一层：返回子目录（完整的公共前缀，以"/"结尾）和文件，不包含prefix本身的目录标记
+	ListDir(bucket string, prefix string) ([]string, []FileMeta, error)
 	DeleteObject(bucket string, key string) error
+	// etag不一致时返回对应平台的412错误
+	DeleteObjectIfMatch(bucket string, key string, etag string) error
 	CopyObject(bucket string, srcKey string, destKey string, metadata *Metadata) error
 	SetObjectMeta(bucket string, key string, metadata *Metadata) error
 	IsObjectExist(bucket string, key string) (bool, error)
 	GetDirToken(bucket string, remoteDir string, expires time.Duration) (*StsTokenInfo, error)
 	GetDirTokenRead(bucket string, remoteDir string, expires time.Duration) (*StsTokenInfo, error)
+	// policy中的资源为bucket中的完整前缀
+	CreateToken(bucket string, policy *StsPolicy, expires time.Duration) (*StsTokenInfo, error)
 	PresignObject(bucket string, key string, expired time.Duration) (string, error)
-	SignFile(bucket string, key string, expired time.Duration) (string, error)
-	GetObjectMeta(bucket string, key string) (*FileMeta, error)
+	// metadata中的图片处理等参数会加入签名
+	SignFile(bucket string, key string, expired time.Duration, metadata *Metadata) (string, error)
+	GetObjectMeta(bucket string, key string, metadata *Metadata) (*FileMeta, error)
+	// 只HEAD获取文件信息，不包含ACL
+	HeadObject(bucket string, key string, metadata *Metadata) (*FileMeta, error)
+
+	// 多版本，metadata中的版本ID用于读取和复制源文件
+	SetBucketVersioning(bucket string, enabled bool) error
+	GetBucketVersioning(bucket string) (string, error)
+	// 返回所有版本和删除标记，同一个key按时间倒序
+	ListObjectVersions(bucket string, prefix string) ([]FileMeta, error)
+	DeleteObjectVersion(bucket string, key string, versionID string) error
+
+	// 分片上传，返回的ETag用于完成分片上传
+	InitiateMultipartUpload(bucket string, key string, metadata *Metadata) (string, error)
+	UploadPart(bucket string, key string, uploadID string, partNumber int, r io.Reader, size int64, metadata *Metadata) (string, error)
+	PresignUploadPart(bucket string, key string, uploadID string, partNumber int, expires time.Duration) (string, error)
+	// parts已按分片号升序排列
+	CompleteMultipartUpload(bucket string, key string, uploadID string, parts []UploadedPart, metadata *Metadata) error
+	AbortMultipartUpload(bucket string, key string, uploadID string) error
+	ListMultipartUploads(bucket string, prefix string) ([]MultipartUpload, error)
+	ListParts(bucket string, key string, uploadID string) ([]UploadedPart, error)
+	// 复制源文件[offset, offset+size)范围的数据作为分片，metadata中的版本ID和SSE-C密钥用于源文件
+	UploadPartCopy(bucket string, srcKey string, destKey string, uploadID string, partNumber int, offset int64,
+		size int64, metadata *Metadata) (string, error)
+
+	// 监听prefix下文件的创建和删除事件，done关闭后停止，Key为bucket中的完整key，不支持时返回ErrNotSupported
+	ListenObjectEvents(bucket string, prefix string, done <-chan struct{}) (<-chan ObjectEvent, error)
+
+	// 平台异步抓取url到key，返回任务ID，返回的FetchTask中Key为bucket中的完整key，不支持时返回ErrNotSupported
+	AsyncFetch(bucket string, key string, url string, metadata *Metadata) (string, error)
+	GetAsyncFetch(bucket string, taskID string) (*FetchTask, error)
+
+	// bucket管理，Set时配置为空表示删除，不支持时返回ErrNotSupported
+	CreateBucket(bucket string, acl ACL) error
+	DeleteBucket(bucket string) error
+	IsBucketExist(bucket string) (bool, error)
+	SetBucketAcl(bucket string, acl ACL) error
+	GetBucketAcl(bucket string) (ACL, error)
+	SetBucketPolicy(bucket string, policy string) error
+	GetBucketPolicy(bucket string) (string, error)
+	SetBucketLifecycle(bucket string, rules []LifecycleRule) error
+	GetBucketLifecycle(bucket string) ([]LifecycleRule, error)
+	SetBucketCORS(bucket string, rules []CORSRule) error
+	GetBucketCORS(bucket string) ([]CORSRule, error)
+	SetBucketReferer(bucket string, config RefererConfig) error
+	GetBucketReferer(bucket string) (*RefererConfig, error)
 }
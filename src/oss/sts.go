@@ -0,0 +1,207 @@
+package oss
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/lru_cache"
+	"golang.org/x/sync/singleflight"
+)
+
+// 临时token
+// StsPolicy 描述token的权限：操作、资源（目录前缀）、来源IP和Referer条件，以及用于审计的会话名称
+// TokenService 按策略缓存token（LRU，数量有上限），过期前refreshMargin内重新获取，并发获取同一个策略的token时只请求一次STS
+
+// 与平台无关的操作，其他值（如oss:PutObjectAcl）作为平台原生的action原样使用
+const (
+	StsActionGet    = "get"
+	StsActionPut    = "put" // 包括分片上传
+	StsActionDelete = "delete"
+)
+
+const (
+	defaultStsSessionName = "kits-oss"
+	tokenCacheMaxEntries  = 1000 // 缓存的token数量上限，超过时淘汰最久未使用的
+)
+
+var stsActions = map[string]map[string]string{
+	Aliyun: {StsActionGet: ossActionGet, StsActionPut: ossActionPut, StsActionDelete: ossActionDelete},
+	Huawei: {StsActionGet: obsGetAction, StsActionPut: obsPutAction, StsActionDelete: obsDeleteAction},
+}
+
+// StsPolicy token的权限策略
+type StsPolicy struct {
+	actions     []string
+	resources   []string
+	sourceIPs   []string
+	referers    []string
+	sessionName string
+}
+
+func NewStsPolicy() *StsPolicy {
+	return &StsPolicy{}
+}
+
+// Allow 允许的操作：StsActionGet、StsActionPut、StsActionDelete或平台原生的action
+func (p *StsPolicy) Allow(actions ...string) *StsPolicy {
+	p.actions = append(p.actions, actions...)
+	return p
+}
+
+// Resource 可以访问的目录或key前缀，相对Wrapper的作用域
+func (p *StsPolicy) Resource(prefixes ...string) *StsPolicy {
+	p.resources = append(p.resources, prefixes...)
+	return p
+}
+
+// SourceIP 只允许这些IP或网段（如10.0.0.0/8）使用，MinIO不支持
+func (p *StsPolicy) SourceIP(ips ...string) *StsPolicy {
+	p.sourceIPs = append(p.sourceIPs, ips...)
+	return p
+}
+
+// Referer 只允许这些Referer使用，支持通配符*，MinIO不支持
+func (p *StsPolicy) Referer(referers ...string) *StsPolicy {
+	p.referers = append(p.referers, referers...)
+	return p
+}
+
+// SessionName 会话名称，会记录在云厂商的审计日志中，只支持字母、数字和.@-_，默认为kits-oss
+func (p *StsPolicy) SessionName(name string) *StsPolicy {
+	p.sessionName = name
+	return p
+}
+
+func (p *StsPolicy) validate() error {
+	if len(p.actions) == 0 || len(p.resources) == 0 {
+		return errors.New("sts policy should have actions and resources")
+	}
+	return nil
+}
+
+func (p *StsPolicy) hasCondition() bool {
+	return len(p.sourceIPs) > 0 || len(p.referers) > 0
+}
+
+// 平台的action
+func (p *StsPolicy) providerActions(provider string) []string {
+	res := make([]string, 0, len(p.actions))
+	for _, action := range p.actions {
+		if mapped, ok := stsActions[provider][action]; ok {
+			res = append(res, mapped)
+		} else {
+			res = append(res, action)
+		}
+	}
+	return res
+}
+
+func (p *StsPolicy) session() string {
+	if p.sessionName == "" {
+		return defaultStsSessionName
+	}
+	return p.sessionName
+}
+
+// 资源转为bucket中的完整前缀
+func (p *StsPolicy) withPrefix(o *Wrapper) *StsPolicy {
+	res := *p
+	res.resources = make([]string, 0, len(p.resources))
+	for _, resource := range p.resources {
+		res.resources = append(res.resources, o.fullKey(resource))
+	}
+	return &res
+}
+
+// 缓存的key，策略相同的token可以共用
+func (p *StsPolicy) cacheKey() string {
+	return strings.Join([]string{strings.Join(p.actions, ","), strings.Join(p.resources, ","),
+		strings.Join(p.sourceIPs, ","), strings.Join(p.referers, ","), p.sessionName}, "|")
+}
+
+// GetToken 获取自定义权限的token，UploadPath为第一个资源
+func (o *Wrapper) GetToken(policy *StsPolicy, expires time.Duration) (*StsTokenInfo, error) {
+	if err := policy.validate(); err != nil {
+		return nil, err
+	}
+	return o.st.CreateToken(o.oc.Bucket, policy.withPrefix(o), expires)
+}
+
+// TokenService 缓存token，减少STS请求，避免被限流
+type TokenService struct {
+	expires time.Duration
+	margin  time.Duration
+	issue   func(policy *StsPolicy, expires time.Duration) (*StsTokenInfo, error)
+	now     func() time.Time // 测试时固定时间
+	mu      sync.Mutex
+	tokens  *lru_cache.LruCache
+	group   singleflight.Group
+}
+
+type cachedToken struct {
+	key   string // 策略的cacheKey
+	token *StsTokenInfo
+}
+
+func (c *cachedToken) Key() any {
+	return c.key
+}
+
+// NewTokenService expires为每个token的有效期，剩余有效期小于refreshMargin时重新获取
+// refreshMargin不合法时使用expires的1/5
+func (o *Wrapper) NewTokenService(expires time.Duration, refreshMargin time.Duration) *TokenService {
+	if refreshMargin <= 0 || refreshMargin >= expires {
+		refreshMargin = expires / 5
+	}
+	return &TokenService{
+		expires: expires,
+		margin:  refreshMargin,
+		issue:   o.GetToken,
+		now:     time.Now,
+		tokens:  lru_cache.NewLruCache(tokenCacheMaxEntries, nil),
+	}
+}
+
+// GetDirToken 读写remoteDir的token，同Wrapper.GetDirToken
+func (s *TokenService) GetDirToken(remoteDir string) (*StsTokenInfo, error) {
+	return s.GetToken(NewStsPolicy().Allow(StsActionPut, StsActionGet).Resource(remoteDir))
+}
+
+// GetDirTokenRead 只读remoteDir的token，同Wrapper.GetDirTokenRead
+func (s *TokenService) GetDirTokenRead(remoteDir string) (*StsTokenInfo, error) {
+	return s.GetToken(NewStsPolicy().Allow(StsActionGet).Resource(remoteDir))
+}
+
+// GetToken 返回缓存的token，返回的是副本，可以修改
+func (s *TokenService) GetToken(policy *StsPolicy) (*StsTokenInfo, error) {
+	key := policy.cacheKey()
+	s.mu.Lock()
+	cached, ok := s.tokens.Get(key)
+	s.mu.Unlock()
+	if ok && s.valid(cached.(*cachedToken).token) {
+		res := *cached.(*cachedToken).token
+		return &res, nil
+	}
+
+	v, err, _ := s.group.Do(key, func() (any, error) {
+		token, err := s.issue(policy, s.expires)
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		s.tokens.Add(&cachedToken{key: key, token: token})
+		s.mu.Unlock()
+		return token, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	res := *v.(*StsTokenInfo)
+	return &res, nil
+}
+
+func (s *TokenService) valid(token *StsTokenInfo) bool {
+	return s.now().Add(s.margin).UnixMilli() < token.Expire
+}
@@ -0,0 +1,128 @@
+package oss
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestStsPolicy(t *testing.T) {
+	p := NewStsPolicy().Allow(StsActionPut, StsActionGet, ossActionPutAcl).Resource("a/", "b/")
+	actions := p.providerActions(Aliyun)
+	expected := []string{ossActionPut, ossActionGet, ossActionPutAcl}
+	for i := range expected {
+		if actions[i] != expected[i] {
+			t.Errorf("expected: %v, got: %v", expected, actions)
+		}
+	}
+	if p.session() != defaultStsSessionName {
+		t.Errorf("unexpected session name: %s", p.session())
+	}
+	prefixed := p.withPrefix(&Wrapper{prefix: "root"})
+	if prefixed.resources[0] != "root/a/" || prefixed.resources[1] != "root/b/" || p.resources[0] != "a/" {
+		t.Errorf("unexpected resources: %v, origin: %v", prefixed.resources, p.resources)
+	}
+	if NewStsPolicy().Allow(StsActionGet).validate() == nil {
+		t.Error("policy without resources should be invalid")
+	}
+}
+
+func TestMinioCreateToken(t *testing.T) {
+	if _, err := minioPolicy("bucket", NewStsPolicy().Allow(ossActionPutAcl).Resource("a/")); err != ErrNotSupported {
+		t.Errorf("actions of other providers should not be supported, err: %v", err)
+	}
+	var form url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		form = r.PostForm
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/"><AssumeRoleResult>` +
+			`<Credentials><AccessKeyId>ak</AccessKeyId><SecretAccessKey>sk</SecretAccessKey><SessionToken>token</SessionToken>` +
+			`</Credentials></AssumeRoleResult></AssumeRoleResponse>`))
+	}))
+	defer srv.Close()
+
+	m := &minStorager{config: &Config{Endpoint: strings.TrimPrefix(srv.URL, "http://")}, transport: http.DefaultTransport}
+	policy := NewStsPolicy().Allow(StsActionGet).Resource("a/").SessionName("job-1")
+	if _, err := m.CreateToken("bucket", policy, time.Minute); err != ErrNotSupported {
+		t.Errorf("sts account should be required, err: %v", err)
+	}
+	m.config.StsAccessKey, m.config.StsSecretKey = "sts", "secret"
+	token, err := m.CreateToken("bucket", policy, time.Minute)
+	if err != nil || token.AccessKeyID != "ak" || token.StsToken != "token" {
+		t.Fatalf("unexpected token: %+v, err: %v", token, err)
+	}
+	expected := `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":["s3:GetObject"],"Resource":"arn:aws:s3:::bucket/a/*"}]}`
+	if form.Get("Policy") != expected || form.Get("RoleSessionName") != "job-1" || form.Get("DurationSeconds") != "900" {
+		t.Errorf("unexpected request: %v", form)
+	}
+	if _, err = m.CreateToken("bucket", NewStsPolicy().Allow(StsActionGet).Resource("a/").SourceIP("10.0.0.0/8"), time.Minute); err != ErrNotSupported {
+		t.Errorf("conditions should not be supported, err: %v", err)
+	}
+}
+
+func TestTokenService(t *testing.T) {
+	now := time.Now()
+	var count int32
+	s := (&Wrapper{}).NewTokenService(time.Hour, 10*time.Minute)
+	s.now = func() time.Time { return now }
+	s.issue = func(policy *StsPolicy, expires time.Duration) (*StsTokenInfo, error) {
+		atomic.AddInt32(&count, 1)
+		time.Sleep(10 * time.Millisecond)
+		return &StsTokenInfo{UploadPath: policy.resources[0], Expire: now.Add(expires).UnixMilli()}, nil
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if token, err := s.GetDirToken("dir/"); err != nil || token.UploadPath != "dir/" {
+				t.Errorf("unexpected token: %v, err: %v", token, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if count != 1 {
+		t.Errorf("concurrent callers should share one request, got: %d", count)
+	}
+
+	_, _ = s.GetDirTokenRead("dir/")
+	if count != 2 {
+		t.Errorf("different actions should use different tokens, got: %d", count)
+	}
+
+	// 进入刷新时间后重新获取
+	now = now.Add(51 * time.Minute)
+	_, _ = s.GetDirToken("dir/")
+	if count != 3 {
+		t.Errorf("token should be refreshed, got: %d", count)
+	}
+
+	// 缓存数量有上限
+	s.issue = func(policy *StsPolicy, expires time.Duration) (*StsTokenInfo, error) {
+		return &StsTokenInfo{Expire: now.Add(expires).UnixMilli()}, nil
+	}
+	for i := 0; i < tokenCacheMaxEntries+10; i++ {
+		_, _ = s.GetDirToken(fmt.Sprintf("dir%d/", i))
+	}
+	if s.tokens.Len() != tokenCacheMaxEntries {
+		t.Errorf("token cache should be bounded, got: %d", s.tokens.Len())
+	}
+}
+
+func TestGetToken(t *testing.T) {
+	policy := NewStsPolicy().Allow(StsActionGet, StsActionPut).Resource(testDir+"/a/", testDir+"/b/").
+		SourceIP("10.0.0.0/8").SessionName("kits-test")
+	token, err := ossHelper.GetToken(policy, time.Hour)
+	fmt.Println("token:", token, "err:", err)
+}
@@ -0,0 +1,150 @@
+package oss
+
+import (
+	"errors"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hqmin9527/kits-go/src/go_limit"
+	"github.com/hqmin9527/kits-go/src/grace_stop"
+	"github.com/hqmin9527/kits-go/src/logger"
+	"github.com/hqmin9527/kits-go/src/safe"
+)
+
+// 临时上传流程：
+// 1. IssueTmpUpload 在TmpRoot下生成临时key，并签发只能访问该key的token，客户端直传
+// 2. Commit 服务端确认后，把临时文件移动到Root下并设置元数据
+// 3. TmpJanitor 定期清理超过ttl仍未Commit的临时文件
+
+// 返回给客户端的临时上传信息
+type TmpUpload struct {
+	Key   string        `json:"key"`   // Tmp作用域内的相对key，Commit时使用
+	Token *StsTokenInfo `json:"token"` // 只作用于该临时key的token
+}
+
+// IssueTmpUpload 生成临时key并签发token，key格式为：日期/uuid/文件名
+func (o *Wrapper) IssueTmpUpload(fileName string, expires time.Duration) (*TmpUpload, error) {
+	key := newTmpKey(fileName)
+	token, err := o.Tmp().GetDirToken(key, expires)
+	if err != nil {
+		return nil, err
+	}
+	return &TmpUpload{Key: key, Token: token}, nil
+}
+
+// Tmp作用域内的临时key：日期/uuid/文件名
+func newTmpKey(fileName string) string {
+	return path.Join(time.Now().Format("20060102"), uuid.NewString(), path.Base(fileName))
+}
+
+// Commit 把Tmp作用域下的tmpKey移动到Root作用域下的finalKey，并设置元数据
+func (o *Wrapper) Commit(tmpKey string, finalKey string, options ...Option) error {
+	src := o.Tmp().fullKey(tmpKey)
+	dest := o.Root().fullKey(finalKey)
+	root := o.bucketRoot()
+	if err := root.CopyObject(src, dest, options...); err != nil {
+		return err
+	}
+	return root.DeleteObject(src)
+}
+
+// TmpJanitor 定期删除Tmp作用域下超过ttl的文件
+type TmpJanitor struct {
+	tmp      *Wrapper
+	ttl      time.Duration
+	interval time.Duration
+	stop     chan struct{}
+	once     sync.Once
+}
+
+// NewTmpJanitor 没有配置TmpRoot，或Tmp作用域与Root作用域相同或包含Root时返回错误，避免删除正式文件
+func (o *Wrapper) NewTmpJanitor(ttl time.Duration, interval time.Duration) (*TmpJanitor, error) {
+	if err := o.checkTmpScope(); err != nil {
+		return nil, err
+	}
+	return &TmpJanitor{
+		tmp:      o.Tmp(),
+		ttl:      ttl,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+// 只有Tmp作用域独立于Root作用域时才能清理
+func (o *Wrapper) checkTmpScope() error {
+	if o.oc.TmpRoot == "" {
+		return errors.New("oss tmp root is not configured")
+	}
+	tmp, root := o.Tmp().GetPrefix(), o.Root().GetPrefix()
+	if tmp == "" || tmp == root || strings.HasPrefix(root, tmp+"/") {
+		return errors.New("oss tmp scope overlaps root scope: " + tmp)
+	}
+	return nil
+}
+
+// Start 在后台协程中定期清理，收到Stop或者grace_stop的关闭信号后退出
+func (j *TmpJanitor) Start() {
+	go safe.Safego(j.run, "oss tmp janitor")
+}
+
+func (j *TmpJanitor) Stop() {
+	j.once.Do(func() {
+		close(j.stop)
+	})
+}
+
+func (j *TmpJanitor) run() {
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-grace_stop.GetStopChan():
+			return
+		case <-ticker.C:
+			n, err := j.Clean()
+			if err != nil {
+				logger.Error("oss tmp janitor clean failed, deleted: %d, err: %s", n, err)
+			} else if n > 0 {
+				logger.Info("oss tmp janitor clean success, deleted: %d", n)
+			}
+		}
+	}
+}
+
+// Clean 执行一次清理，返回删除的文件数
+func (j *TmpJanitor) Clean() (int, error) {
+	if err := j.tmp.checkTmpScope(); err != nil {
+		return 0, err
+	}
+	deadline := time.Now().Add(-j.ttl)
+	var mu sync.Mutex
+	count := 0
+	goLimit := go_limit.New(goLimitCount)
+	// 分页列举，边列举边删除，临时文件很多时也不会全部加载到内存
+	err := j.tmp.WalkObjects("", func(meta *FileMeta) error {
+		if !meta.LastModified.Before(deadline) {
+			return nil
+		}
+		key := meta.Key
+		goLimit.RunError(func() error {
+			if err := j.tmp.DeleteObject(key); err != nil {
+				return err
+			}
+			mu.Lock()
+			count++
+			mu.Unlock()
+			return nil
+		})
+		return nil
+	})
+	goLimit.Wait()
+	if err != nil {
+		return count, err
+	}
+	return count, goLimit.FirstError()
+}
@@ -0,0 +1,66 @@
+package oss
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestTmpUploadCommit(t *testing.T) {
+	upload, err := ossHelper.IssueTmpUpload("hello.txt", time.Hour)
+	if err != nil {
+		fmt.Println("issue tmp upload err:", err)
+		return
+	}
+	fmt.Println("upload:", upload.Key, upload.Token)
+
+	// 模拟客户端上传
+	if err = ossHelper.Tmp().PutObject(upload.Key, []byte("hello world")); err != nil {
+		fmt.Println("put tmp object err:", err)
+		return
+	}
+	err = ossHelper.Commit(upload.Key, "test/commit/hello.txt", AttachFileName("hello.txt"))
+	fmt.Println("err:", err)
+}
+
+func TestTmpJanitorScope(t *testing.T) {
+	configs := []*Config{
+		{Bucket: "bucket", BaseDir: "x"},
+		{Bucket: "bucket", Prefix: "p", Root: "data", TmpRoot: "data"},
+		{Bucket: "bucket", Root: "data/files", TmpRoot: "data"},
+	}
+	for _, c := range configs {
+		w := &Wrapper{st: &memStorager{objects: map[string][]byte{}}, oc: c}
+		if _, err := w.NewTmpJanitor(time.Hour, time.Hour); err == nil {
+			t.Errorf("janitor should be refused, config: %+v", c)
+		}
+		j := &TmpJanitor{tmp: w.Tmp(), ttl: time.Hour}
+		if _, err := j.Clean(); err == nil {
+			t.Errorf("clean should be refused, config: %+v", c)
+		}
+	}
+	st := &memStorager{objects: map[string][]byte{}}
+	w := &Wrapper{st: st, oc: &Config{Bucket: "bucket", BaseDir: "x", TmpRoot: "tmp"}}
+	if _, err := w.NewTmpJanitor(time.Hour, time.Hour); err != nil {
+		t.Errorf("separate tmp scope should be allowed, err: %v", err)
+	}
+
+	// 只清理Tmp作用域中过期的文件
+	st.put("tmp/x/2024-01-01/a.txt", []byte("a"))
+	st.put("x/a.txt", []byte("a"))
+	j := &TmpJanitor{tmp: w.Tmp(), ttl: time.Hour}
+	if n, err := j.Clean(); err != nil || n != 1 || st.objects["x/a.txt"] == nil {
+		t.Errorf("only tmp objects should be removed, deleted: %d, err: %v", n, err)
+	}
+}
+
+func TestTmpJanitorClean(t *testing.T) {
+	janitor, err := ossHelper.NewTmpJanitor(24*time.Hour, time.Hour)
+	if err != nil {
+		fmt.Println("err:", err)
+		return
+	}
+	n, err := janitor.Clean()
+	fmt.Println("err:", err)
+	fmt.Println("deleted:", n)
+}
@@ -0,0 +1,460 @@
+package oss
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/go_limit"
+	"github.com/hqmin9527/kits-go/src/grace_stop"
+	"github.com/hqmin9527/kits-go/src/logger"
+	"github.com/hqmin9527/kits-go/src/safe"
+)
+
+// 回收站和审计日志
+// 1. 删除时把文件移动到回收站前缀下：回收站前缀/原完整key@deleted-删除时间，自定义元数据记录原key、删除时间和操作人
+// 2. Restore恢复最近一次删除的版本，恢复后的文件保留kits-trash-*元数据（各平台复制时只能合并元数据）
+// 3. Purge删除超过保留时间的文件，按回收站中文件的最后修改时间（即删除时间）计算
+// 4. 所有破坏性操作追加到审计日志：日志前缀/日期.jsonl，每行一条AuditRecord，使用条件写入避免并发追加时互相覆盖
+// 回收站和审计日志的前缀都是bucket内的完整前缀，不受Wrapper作用域影响
+
+const (
+	trashMetaKey   = "kits-trash-key"
+	trashMetaTime  = "kits-trash-time"
+	trashMetaActor = "kits-trash-actor"
+
+	trashKeySep     = "@deleted-"
+	trashTimeLayout = "20060102T150405.000000000"
+
+	journalRetry = 5 // 条件写入冲突时的重试次数
+)
+
+// 审计日志的操作类型
+const (
+	AuditDelete        = "delete"
+	AuditDeleteFolder  = "delete_folder"
+	AuditMove          = "move"
+	AuditMoveFolder    = "move_folder"
+	AuditRestore       = "restore"
+	AuditRestoreFolder = "restore_folder"
+	AuditPurge         = "purge"
+)
+
+// AuditRecord 审计日志的一条记录，key都是bucket中的完整key
+type AuditRecord struct {
+	Time  time.Time `json:"time"`
+	Actor string    `json:"actor"`
+	Op    string    `json:"op"`
+	Key   string    `json:"key,omitempty"`
+	Dest  string    `json:"dest,omitempty"`
+	Count int       `json:"count,omitempty"` // 目录操作和Purge影响的文件数
+	Error string    `json:"error,omitempty"`
+}
+
+// TrashEntry 回收站中的文件
+type TrashEntry struct {
+	Key       string // 作用域内的原key
+	TrashKey  string // 回收站中的完整key
+	DeletedAt time.Time
+	Size      int64
+}
+
+// TrashWrapper 删除时移动到回收站，并记录审计日志
+type TrashWrapper struct {
+	w         *Wrapper
+	trash     *Wrapper // 回收站前缀的作用域
+	journal   *Wrapper // 审计日志前缀的作用域
+	retention time.Duration
+	actor     string
+	stop      chan struct{}
+	once      *sync.Once
+}
+
+// NewTrashWrapper trashPrefix和journalPrefix为bucket内的完整前缀，回收站中的文件保留retention后由Purge删除
+// trashPrefix不能为空，也不能等于或包含w的作用域，避免Purge删除正式文件
+func NewTrashWrapper(w *Wrapper, trashPrefix string, journalPrefix string, retention time.Duration) (*TrashWrapper, error) {
+	root := w.bucketRoot()
+	trash := root.Sub(trashPrefix)
+	prefix := trash.GetPrefix()
+	if prefix == "" {
+		return nil, errors.New("oss trash prefix is empty")
+	}
+	if scope := w.GetPrefix(); scope == prefix || strings.HasPrefix(scope, prefix+"/") {
+		return nil, errors.New("oss trash prefix overlaps wrapper scope: " + prefix)
+	}
+	return &TrashWrapper{
+		w:         w,
+		trash:     trash,
+		journal:   root.Sub(journalPrefix),
+		retention: retention,
+		stop:      make(chan struct{}),
+		once:      &sync.Once{},
+	}, nil
+}
+
+func (t *TrashWrapper) Wrapper() *Wrapper {
+	return t.w
+}
+
+// AsActor 返回使用actor作为操作人的副本，和原对象共用Purge协程
+func (t *TrashWrapper) AsActor(actor string) *TrashWrapper {
+	res := *t
+	res.actor = actor
+	return &res
+}
+
+// DeleteObject 把文件移动到回收站
+func (t *TrashWrapper) DeleteObject(key string) error {
+	checkKey(key)
+	fullKey := t.w.fullKey(key)
+	err := t.moveToTrash(fullKey, time.Now())
+	t.audit(AuditRecord{Op: AuditDelete, Key: fullKey}, 1, err)
+	return err
+}
+
+// DeleteFolder 把目录下的文件移动到回收站，不包括回收站和审计日志本身
+func (t *TrashWrapper) DeleteFolder(remoteDir string) error {
+	contents, err := t.w.ListObjects(remoteDir)
+	if err != nil {
+		return err
+	}
+	contents = t.filter(contents)
+	now := time.Now()
+	count, err := t.each(len(contents), func(i int) error {
+		return t.moveToTrash(t.w.fullKey(contents[i].Key), now)
+	})
+	t.audit(AuditRecord{Op: AuditDeleteFolder, Key: t.w.fullKey(remoteDir)}, count, err)
+	return err
+}
+
+// Move 目标文件已存在时先移动到回收站
+func (t *TrashWrapper) Move(srcKey string, destKey string) error {
+	checkKey(destKey)
+	dest := t.w.fullKey(destKey)
+	err := t.trashIfExist(dest, time.Now())
+	if err == nil {
+		err = t.w.Move(srcKey, destKey)
+	}
+	t.audit(AuditRecord{Op: AuditMove, Key: t.w.fullKey(srcKey), Dest: dest}, 1, err)
+	return err
+}
+
+// MoveFolder 会被覆盖的目标文件先移动到回收站
+func (t *TrashWrapper) MoveFolder(remoteDir string, remoteDistDir string) error {
+	contents, err := t.w.ListObjects(remoteDir)
+	if err != nil {
+		return err
+	}
+	existing, err := t.w.ListObjects(remoteDistDir)
+	if err != nil {
+		return err
+	}
+	exist := make(map[string]bool, len(existing))
+	for _, content := range existing {
+		exist[content.Key] = true
+	}
+	contents = t.filter(contents)
+	now := time.Now()
+	// 复制失败时不删除源文件
+	count, err := t.each(len(contents), func(i int) error {
+		destKey := joinPath(remoteDistDir, strings.TrimPrefix(contents[i].Key, remoteDir))
+		if exist[destKey] {
+			if err := t.moveToTrash(t.w.fullKey(destKey), now); err != nil {
+				return err
+			}
+		}
+		return t.w.Move(contents[i].Key, destKey)
+	})
+	t.audit(AuditRecord{Op: AuditMoveFolder, Key: t.w.fullKey(remoteDir), Dest: t.w.fullKey(remoteDistDir)},
+		count, err)
+	return err
+}
+
+// Restore 恢复key最近一次删除的版本，原位置已有文件时返回ErrPreconditionFailed
+func (t *TrashWrapper) Restore(key string) error {
+	entries, err := t.ListTrash(key)
+	if err != nil {
+		return err
+	}
+	var latest *TrashEntry
+	for i := range entries {
+		if entries[i].Key == key && (latest == nil || entries[i].DeletedAt.After(latest.DeletedAt)) {
+			latest = &entries[i]
+		}
+	}
+	if latest == nil {
+		return errors.New("oss trash entry not found: " + key)
+	}
+	err = t.restore(latest)
+	t.audit(AuditRecord{Op: AuditRestore, Key: latest.TrashKey, Dest: t.w.fullKey(key)}, 1, err)
+	return err
+}
+
+// RestoreFolder 恢复目录下每个文件最近一次删除的版本，原位置已有文件的跳过，返回恢复的文件数
+func (t *TrashWrapper) RestoreFolder(remoteDir string) (int, error) {
+	entries, err := t.ListTrash(remoteDir)
+	if err != nil {
+		return 0, err
+	}
+	index := make(map[string]int)
+	var latest []TrashEntry
+	for _, entry := range entries {
+		if i, ok := index[entry.Key]; !ok {
+			index[entry.Key] = len(latest)
+			latest = append(latest, entry)
+		} else if entry.DeletedAt.After(latest[i].DeletedAt) {
+			latest[i] = entry
+		}
+	}
+	var mu sync.Mutex
+	count := 0
+	_, err = t.each(len(latest), func(i int) error {
+		err := t.restore(&latest[i])
+		if errors.Is(err, ErrPreconditionFailed) {
+			return nil
+		}
+		if err == nil {
+			mu.Lock()
+			count++
+			mu.Unlock()
+		}
+		return err
+	})
+	t.audit(AuditRecord{Op: AuditRestoreFolder, Key: t.w.fullKey(remoteDir)}, count, err)
+	return count, err
+}
+
+// ListTrash 列举回收站中原key以prefix开头的文件
+func (t *TrashWrapper) ListTrash(prefix string) ([]TrashEntry, error) {
+	var res []TrashEntry
+	err := t.trash.WalkObjects(t.w.fullKey(prefix), func(meta *FileMeta) error {
+		if entry, ok := t.parseTrashKey(meta); ok {
+			res = append(res, entry)
+		}
+		return nil
+	})
+	return res, err
+}
+
+// Purge 删除回收站中超过保留时间的文件，返回删除的文件数，不是回收站格式的文件不删除
+func (t *TrashWrapper) Purge() (int, error) {
+	deadline := time.Now().Add(-t.retention)
+	var expired []FileMeta
+	err := t.trash.WalkObjects("", func(meta *FileMeta) error {
+		if _, ok := t.parseTrashKey(meta); ok && meta.LastModified.Before(deadline) {
+			expired = append(expired, *meta)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	count, err := t.each(len(expired), func(i int) error {
+		return t.trash.DeleteObject(expired[i].Key)
+	})
+	if count > 0 || err != nil {
+		t.audit(AuditRecord{Op: AuditPurge, Key: t.trash.GetPrefix()}, count, err)
+	}
+	return count, err
+}
+
+// StartPurge 在后台协程中每隔interval执行一次Purge，收到Stop或者grace_stop的关闭信号后退出
+func (t *TrashWrapper) StartPurge(interval time.Duration) {
+	go safe.Safego(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-grace_stop.GetStopChan():
+				return
+			case <-ticker.C:
+				n, err := t.Purge()
+				if err != nil {
+					logger.Error("oss trash purge failed, deleted: %d, err: %s", n, err)
+				} else if n > 0 {
+					logger.Info("oss trash purge success, deleted: %d", n)
+				}
+			}
+		}
+	}, "oss trash purge")
+}
+
+func (t *TrashWrapper) Stop() {
+	t.once.Do(func() {
+		close(t.stop)
+	})
+}
+
+// ReadJournal 读取day当天的审计日志
+func (t *TrashWrapper) ReadJournal(day time.Time) ([]AuditRecord, error) {
+	data, err := t.journal.GetObject(journalKey(day))
+	if err != nil {
+		return nil, err
+	}
+	var res []AuditRecord
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		var record AuditRecord
+		if err = json.Unmarshal(line, &record); err != nil {
+			return res, err
+		}
+		res = append(res, record)
+	}
+	return res, nil
+}
+
+// 复制到回收站后删除原文件，保留原文件的元数据
+func (t *TrashWrapper) moveToTrash(fullKey string, now time.Time) error {
+	if !t.inScope(fullKey) {
+		return nil
+	}
+	root := t.w.bucketRoot()
+	src, err := root.GetObjectMeta(fullKey)
+	if err != nil {
+		return err
+	}
+	md := mergeMetadata(src.Metadata, &Metadata{UserMeta: map[string]string{
+		trashMetaKey:   fullKey,
+		trashMetaTime:  now.UTC().Format(time.RFC3339),
+		trashMetaActor: t.actor,
+	}})
+	md.srcSize = src.Size
+	trashKey := t.trash.fullKey(fullKey + trashKeySep + now.UTC().Format(trashTimeLayout))
+	if err = root.copyObject(fullKey, trashKey, &md); err != nil {
+		return err
+	}
+	return root.DeleteObject(fullKey)
+}
+
+func (t *TrashWrapper) trashIfExist(fullKey string, now time.Time) error {
+	err := t.moveToTrash(fullKey, now)
+	if IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// 复制回原位置，不覆盖已有的文件
+func (t *TrashWrapper) restore(entry *TrashEntry) error {
+	root := t.w.bucketRoot()
+	md := buildMetadata([]Option{NoOverwrite, withSrcSize(entry.Size)})
+	if err := preconditionError(root.copyObject(entry.TrashKey, t.w.fullKey(entry.Key), md)); err != nil {
+		return err
+	}
+	return root.DeleteObject(entry.TrashKey)
+}
+
+// 并发执行f(0)~f(n-1)，返回成功的数量
+func (t *TrashWrapper) each(n int, f func(i int) error) (int, error) {
+	var mu sync.Mutex
+	count := 0
+	goLimit := go_limit.New(goLimitCount)
+	for i := 0; i < n; i++ {
+		index := i
+		goLimit.RunError(func() error {
+			if err := f(index); err != nil {
+				return err
+			}
+			mu.Lock()
+			count++
+			mu.Unlock()
+			return nil
+		})
+	}
+	goLimit.Wait()
+	return count, goLimit.FirstError()
+}
+
+// 去掉目录标记，以及回收站和审计日志中的文件
+func (t *TrashWrapper) filter(contents []FileMeta) []FileMeta {
+	res := make([]FileMeta, 0, len(contents))
+	for _, content := range contents {
+		if !strings.HasSuffix(content.Key, "/") && t.inScope(t.w.fullKey(content.Key)) {
+			res = append(res, content)
+		}
+	}
+	return res
+}
+
+// 回收站和审计日志中的文件不能再移动到回收站
+func (t *TrashWrapper) inScope(fullKey string) bool {
+	for _, prefix := range []string{t.trash.GetPrefix(), t.journal.GetPrefix()} {
+		if prefix != "" && (fullKey == prefix || strings.HasPrefix(fullKey, prefix+"/")) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *TrashWrapper) parseTrashKey(meta *FileMeta) (TrashEntry, bool) {
+	i := strings.LastIndex(meta.Key, trashKeySep)
+	if i < 0 {
+		return TrashEntry{}, false
+	}
+	deletedAt, err := time.Parse(trashTimeLayout, meta.Key[i+len(trashKeySep):])
+	if err != nil {
+		return TrashEntry{}, false
+	}
+	return TrashEntry{
+		Key:       t.w.relKey(meta.Key[:i]),
+		TrashKey:  t.trash.fullKey(meta.Key),
+		DeletedAt: deletedAt,
+		Size:      meta.Size,
+	}, true
+}
+
+// 追加审计日志，失败时只记录错误日志，不影响操作的结果
+func (t *TrashWrapper) audit(record AuditRecord, count int, opErr error) {
+	record.Time = time.Now()
+	record.Actor = t.actor
+	if count > 1 || record.Op == AuditPurge {
+		record.Count = count
+	}
+	if opErr != nil {
+		record.Error = opErr.Error()
+	}
+	if err := t.appendJournal(&record); err != nil {
+		logger.Error("oss audit journal failed, record: %+v, err: %s", record, err)
+	}
+}
+
+// 读取当天的日志后追加一行，使用ETag条件写入，冲突时重试
+func (t *TrashWrapper) appendJournal(record *AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+	key := journalKey(record.Time)
+	for i := 0; i < journalRetry; i++ {
+		r, meta, err := t.journal.getReader(key, 0, -1, nil)
+		if IsNotFound(err) {
+			err = t.journal.PutIfAbsent(key, line, SetContentType("application/x-ndjson"))
+		} else if err == nil {
+			var data []byte
+			data, err = io.ReadAll(r)
+			_ = r.Close()
+			if err != nil {
+				return err
+			}
+			err = t.journal.PutIfMatch(key, append(data, line...), meta.ETag,
+				SetContentType("application/x-ndjson"))
+		}
+		if !errors.Is(err, ErrPreconditionFailed) {
+			return err
+		}
+	}
+	return ErrPreconditionFailed
+}
+
+func journalKey(day time.Time) string {
+	return day.UTC().Format("20060102") + ".jsonl"
+}
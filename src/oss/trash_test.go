@@ -0,0 +1,107 @@
+package oss
+
+import (
+	"fmt"
+	"path"
+	"testing"
+	"time"
+)
+
+func (m *memStorager) WalkObjects(bucket string, prefix string, fn func(meta *FileMeta) error) error {
+	contents, err := m.ListObjects(bucket, prefix)
+	if err != nil {
+		return err
+	}
+	for i := range contents {
+		if err = fn(&contents[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memStorager) CopyObject(bucket string, srcKey string, destKey string, metadata *Metadata) error {
+	_, data, err := m.meta(srcKey)
+	if err != nil {
+		return err
+	}
+	return m.PutObjectWithMeta(bucket, destKey, data, metadata)
+}
+
+func TestTrashWrapper(t *testing.T) {
+	o, st := newMemWrapper()
+	st.put("data/a.txt", []byte("a"))
+	st.put("data/dir/b.txt", []byte("b"))
+	st.put("data/dir/c.txt", []byte("c"))
+	for _, prefix := range []string{"", "/", "data", "."} {
+		if _, err := NewTrashWrapper(o.Sub("data/x"), prefix, ".audit", time.Hour); err == nil {
+			t.Errorf("trash prefix overlapping the scope should be refused, prefix: %q", prefix)
+		}
+	}
+	tw, err := NewTrashWrapper(o.Sub("data"), ".trash", ".audit", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw = tw.AsActor("alice")
+	st.put(".trash/readme.txt", []byte("not a trash entry"))
+
+	if err = tw.DeleteObject("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err = tw.DeleteFolder("dir"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := tw.ListTrash("")
+	if err != nil || len(entries) != 3 || st.objects["data/a.txt"] != nil {
+		t.Fatalf("objects should be moved to trash, entries: %v, err: %v", entries, err)
+	}
+
+	// 原位置已有文件时不覆盖
+	st.put("data/a.txt", []byte("new"))
+	if err = tw.Restore("a.txt"); err != ErrPreconditionFailed {
+		t.Errorf("restore should not overwrite, err: %v", err)
+	}
+	_ = tw.DeleteObject("a.txt")
+	if err = tw.Restore("a.txt"); err != nil || string(st.objects["data/a.txt"]) != "new" {
+		t.Errorf("latest version should be restored, data: %s, err: %v", st.objects["data/a.txt"], err)
+	}
+	if n, err := tw.RestoreFolder("dir"); n != 2 || err != nil || string(st.objects["data/dir/b.txt"]) != "b" {
+		t.Errorf("folder should be restored, count: %d, err: %v", n, err)
+	}
+
+	// 内存中的文件没有修改时间，全部超过保留时间
+	if n, err := tw.Purge(); n != 1 || err != nil || st.objects[".trash/readme.txt"] == nil {
+		t.Errorf("only the old version of a.txt should be purged, count: %d, err: %v", n, err)
+	}
+
+	records, err := tw.ReadJournal(time.Now())
+	ops := make([]string, 0, len(records))
+	for _, record := range records {
+		ops = append(ops, record.Op)
+		if record.Actor != "alice" {
+			t.Errorf("unexpected actor: %+v", record)
+		}
+	}
+	expected := fmt.Sprint([]string{AuditDelete, AuditDeleteFolder, AuditRestore, AuditDelete, AuditRestore,
+		AuditRestoreFolder, AuditPurge})
+	if err != nil || fmt.Sprint(ops) != expected {
+		t.Errorf("unexpected journal: %v, err: %v", ops, err)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	tw, err := NewTrashWrapper(ossHelper, path.Join(testDir, ".trash"), path.Join(testDir, ".audit"), time.Hour)
+	if err != nil {
+		fmt.Println("err:", err)
+		return
+	}
+	tw = tw.AsActor("test")
+	ossPath := path.Join(testDir, "trash.txt")
+	_ = ossHelper.PutObject(ossPath, []byte("trash"))
+	fmt.Println("delete err:", tw.DeleteObject(ossPath))
+	entries, err := tw.ListTrash(ossPath)
+	fmt.Println("entries:", entries, "err:", err)
+	fmt.Println("restore err:", tw.Restore(ossPath))
+	records, err := tw.ReadJournal(time.Now())
+	fmt.Println("journal:", records, "err:", err)
+}
@@ -0,0 +1,218 @@
+package oss
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 存储用量统计：分页列举prefix下的文件，按子目录汇总大小和文件数
+// 每个节点同时按存储类型、文件年龄（按最后修改时间）、扩展名分类统计，用于按租户计费和定位需要清理的文件
+
+// 文件年龄的分段，按天数递增
+var usageAgeBuckets = []struct {
+	name string
+	days int
+}{
+	{"0-7d", 7},
+	{"7-30d", 30},
+	{"30-90d", 90},
+	{"90-365d", 365},
+}
+
+const (
+	usageAgeOverYear = "365d+"
+	usageNoExt       = "(none)"
+)
+
+// UsageStat 大小（字节）和文件数
+type UsageStat struct {
+	Size  int64 `json:"size"`
+	Count int64 `json:"count"`
+}
+
+func (s *UsageStat) add(size int64) {
+	s.Size += size
+	s.Count++
+}
+
+// UsageNode 一个目录的用量，Size和Count包括所有子目录
+type UsageNode struct {
+	Prefix         string                      `json:"prefix"` // 作用域内的相对前缀，根节点为Usage的参数
+	Size           int64                       `json:"size"`
+	Count          int64                       `json:"count"`
+	StorageClasses map[StorageClass]*UsageStat `json:"storageClasses"`
+	Ages           map[string]*UsageStat       `json:"ages"`
+	Extensions     map[string]*UsageStat       `json:"extensions"` // 小写，不带“.”，没有扩展名为(none)
+	Children       []*UsageNode                `json:"children,omitempty"`
+
+	children map[string]*UsageNode
+}
+
+// Usage 统计prefix下的用量，depth为子目录的层数，0表示只统计prefix本身
+func (o *Wrapper) Usage(prefix string, depth int) (*UsageNode, error) {
+	root := newUsageNode(prefix)
+	now := time.Now()
+	err := o.WalkObjects(prefix, func(meta *FileMeta) error {
+		root.add(meta, depth, now)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	root.finish()
+	return root, nil
+}
+
+func newUsageNode(prefix string) *UsageNode {
+	return &UsageNode{
+		Prefix:         prefix,
+		StorageClasses: make(map[StorageClass]*UsageStat),
+		Ages:           make(map[string]*UsageStat),
+		Extensions:     make(map[string]*UsageStat),
+		children:       make(map[string]*UsageNode),
+	}
+}
+
+// 累加到当前节点，并按key中的下一级目录递归累加到子节点
+func (n *UsageNode) add(meta *FileMeta, depth int, now time.Time) {
+	n.Size += meta.Size
+	n.Count++
+	class := meta.StorageClass
+	if class == "" {
+		class = StorageStandard
+	}
+	usageStatOf(n.StorageClasses, class).add(meta.Size)
+	usageStatOf(n.Ages, usageAge(now.Sub(meta.LastModified))).add(meta.Size)
+	usageStatOf(n.Extensions, usageExt(meta.Key)).add(meta.Size)
+
+	if depth <= 0 {
+		return
+	}
+	// prefix可以不以“/”结尾，如prefix为ten时，tenants/a/x.txt的子目录为tenants/
+	rest := strings.TrimPrefix(meta.Key, n.Prefix)
+	sep := ""
+	if n.Prefix != "" && strings.HasPrefix(rest, "/") {
+		rest, sep = rest[1:], "/"
+	}
+	i := strings.Index(rest, "/")
+	if i <= 0 {
+		// 直接在当前目录下的文件
+		return
+	}
+	childPrefix := n.Prefix + sep + rest[:i+1]
+	child, ok := n.children[childPrefix]
+	if !ok {
+		child = newUsageNode(childPrefix)
+		n.children[childPrefix] = child
+	}
+	child.add(meta, depth-1, now)
+}
+
+// 子目录按大小倒序
+func (n *UsageNode) finish() {
+	n.Children = make([]*UsageNode, 0, len(n.children))
+	for _, child := range n.children {
+		child.finish()
+		n.Children = append(n.Children, child)
+	}
+	sort.Slice(n.Children, func(i, j int) bool {
+		if n.Children[i].Size != n.Children[j].Size {
+			return n.Children[i].Size > n.Children[j].Size
+		}
+		return n.Children[i].Prefix < n.Children[j].Prefix
+	})
+}
+
+func (n *UsageNode) JSON() ([]byte, error) {
+	return json.Marshal(n)
+}
+
+// WriteCSV 每个目录的每项统计一行：prefix,dimension,name,size,count
+// dimension为total（name为空）、storage_class、age、extension，子目录在父目录之后
+func (n *UsageNode) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"prefix", "dimension", "name", "size", "count"}); err != nil {
+		return err
+	}
+	if err := n.writeCSV(cw); err != nil {
+		return err
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func (n *UsageNode) writeCSV(cw *csv.Writer) error {
+	rows := [][]string{usageRow(n.Prefix, "total", "", &UsageStat{Size: n.Size, Count: n.Count})}
+	for _, name := range sortedUsageKeys(n.StorageClasses) {
+		rows = append(rows, usageRow(n.Prefix, "storage_class", string(name), n.StorageClasses[name]))
+	}
+	// 年龄按分段顺序输出
+	for _, bucket := range usageAgeBuckets {
+		if s, ok := n.Ages[bucket.name]; ok {
+			rows = append(rows, usageRow(n.Prefix, "age", bucket.name, s))
+		}
+	}
+	if s, ok := n.Ages[usageAgeOverYear]; ok {
+		rows = append(rows, usageRow(n.Prefix, "age", usageAgeOverYear, s))
+	}
+	for _, name := range sortedUsageKeys(n.Extensions) {
+		rows = append(rows, usageRow(n.Prefix, "extension", name, n.Extensions[name]))
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	for _, child := range n.Children {
+		if err := child.writeCSV(cw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func usageRow(prefix string, dimension string, name string, s *UsageStat) []string {
+	return []string{prefix, dimension, name, strconv.FormatInt(s.Size, 10), strconv.FormatInt(s.Count, 10)}
+}
+
+func usageAge(age time.Duration) string {
+	days := int(age.Hours() / 24)
+	for _, bucket := range usageAgeBuckets {
+		if days < bucket.days {
+			return bucket.name
+		}
+	}
+	return usageAgeOverYear
+}
+
+func usageExt(key string) string {
+	ext := strings.ToLower(strings.TrimPrefix(path.Ext(key), "."))
+	if ext == "" {
+		return usageNoExt
+	}
+	return ext
+}
+
+func usageStatOf[K comparable](m map[K]*UsageStat, key K) *UsageStat {
+	s, ok := m[key]
+	if !ok {
+		s = &UsageStat{}
+		m[key] = s
+	}
+	return s
+}
+
+func sortedUsageKeys[K ~string, V any](m map[K]V) []K {
+	keys := make([]K, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,60 @@
+package oss
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUsageTree(t *testing.T) {
+	now := time.Now()
+	root := newUsageNode("tenants")
+	files := []FileMeta{
+		{Key: "tenants/a/x.PNG", Size: 10, LastModified: now.Add(-time.Hour)},
+		{Key: "tenants/a/y/z.txt", Size: 20, LastModified: now.Add(-40 * 24 * time.Hour), StorageClass: StorageIA},
+		{Key: "tenants/b/readme", Size: 5, LastModified: now.Add(-400 * 24 * time.Hour)},
+		{Key: "tenants/top.txt", Size: 1, LastModified: now},
+	}
+	for i := range files {
+		root.add(&files[i], 1, now)
+	}
+	root.finish()
+
+	if root.Size != 36 || root.Count != 4 || len(root.Children) != 2 {
+		t.Fatalf("unexpected root: %+v", root)
+	}
+	a := root.Children[0]
+	if a.Prefix != "tenants/a/" || a.Size != 30 || a.Count != 2 || len(a.Children) != 0 {
+		t.Errorf("unexpected child: %+v", a)
+	}
+	if a.StorageClasses[StorageIA].Size != 20 || a.StorageClasses[StorageStandard].Size != 10 {
+		t.Errorf("unexpected storage classes: %v", a.StorageClasses)
+	}
+	if root.Ages["0-7d"].Count != 2 || root.Ages["30-90d"].Count != 1 || root.Ages[usageAgeOverYear].Count != 1 {
+		t.Errorf("unexpected ages: %v", root.Ages)
+	}
+	if root.Extensions["png"].Size != 10 || root.Extensions["txt"].Count != 2 || root.Extensions[usageNoExt].Size != 5 {
+		t.Errorf("unexpected extensions: %v", root.Extensions)
+	}
+
+	var buf bytes.Buffer
+	if err := root.WriteCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if lines[0] != "prefix,dimension,name,size,count" || lines[1] != "tenants,total,,36,4" {
+		t.Errorf("unexpected csv: %s", buf.String())
+	}
+}
+
+func TestUsage(t *testing.T) {
+	usage, err := ossHelper.Usage(testDir, 2)
+	if err != nil {
+		fmt.Println("usage err:", err)
+		return
+	}
+	data, _ := usage.JSON()
+	fmt.Println("usage:", string(data))
+}
@@ -0,0 +1,56 @@
+package oss
+
+import (
+	"errors"
+	"sort"
+)
+
+// 多版本：开启后覆盖和删除都会保留历史版本，删除时生成删除标记
+// 读取历史版本时使用WithVersionID选项，误覆盖、误删除后使用RestoreVersion恢复
+
+// SetBucketVersioning 开启或暂停bucket的多版本，开启后无法关闭，只能暂停
+func (o *Wrapper) SetBucketVersioning(enabled bool) error {
+	return o.st.SetBucketVersioning(o.oc.Bucket, enabled)
+}
+
+// GetBucketVersioning 返回VersioningEnabled、VersioningSuspended，从未开启过时为空
+func (o *Wrapper) GetBucketVersioning() (string, error) {
+	return o.st.GetBucketVersioning(o.oc.Bucket)
+}
+
+// ListObjectVersions 列举prefix下所有文件的所有版本和删除标记，同一个key按时间倒序
+func (o *Wrapper) ListObjectVersions(prefix string) ([]FileMeta, error) {
+	versions, err := o.st.ListObjectVersions(o.oc.Bucket, o.fullKey(prefix))
+	for i := range versions {
+		versions[i].Key = o.relKey(versions[i].Key)
+	}
+	return versions, err
+}
+
+// DeleteObjectVersion 永久删除指定版本（也可以删除删除标记，使上一个版本重新成为当前版本）
+func (o *Wrapper) DeleteObjectVersion(key string, versionID string) error {
+	if versionID == "" {
+		return errors.New("oss version id is empty")
+	}
+	checkKey(key)
+	return o.st.DeleteObjectVersion(o.oc.Bucket, o.fullKey(key), versionID)
+}
+
+// RestoreVersion 把历史版本复制为当前版本，历史版本仍然保留
+func (o *Wrapper) RestoreVersion(key string, versionID string, options ...Option) error {
+	if versionID == "" {
+		return errors.New("oss version id is empty")
+	}
+	return o.CopyObject(key, key, append(options, WithVersionID(versionID))...)
+}
+
+// 各平台的版本和删除标记是分开返回的，合并后按key排序，同一个key按时间倒序
+func sortVersions(versions []FileMeta) []FileMeta {
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].Key != versions[j].Key {
+			return versions[i].Key < versions[j].Key
+		}
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+	return versions
+}
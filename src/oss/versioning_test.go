@@ -0,0 +1,85 @@
+package oss
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSortVersions(t *testing.T) {
+	now := time.Now()
+	versions := sortVersions([]FileMeta{
+		{Key: "b.txt", VersionID: "b1", LastModified: now.Add(-time.Hour)},
+		{Key: "a.txt", VersionID: "a1", LastModified: now.Add(-time.Hour)},
+		{Key: "a.txt", VersionID: "a3", LastModified: now, IsDeleteMarker: true},
+		{Key: "a.txt", VersionID: "a2", LastModified: now.Add(-time.Minute)},
+	})
+	var got []string
+	for _, v := range versions {
+		got = append(got, v.VersionID)
+	}
+	if expected := "a3,a2,a1,b1"; strings.Join(got, ",") != expected {
+		t.Errorf("expected: %s, got: %s", expected, strings.Join(got, ","))
+	}
+}
+
+func TestParseMinioListVersions(t *testing.T) {
+	body := `<?xml version="1.0" encoding="UTF-8"?>
+<ListVersionsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>bucket</Name><Prefix>dir/</Prefix><IsTruncated>true</IsTruncated>
+  <NextKeyMarker>dir/a.txt</NextKeyMarker><NextVersionIdMarker>v1</NextVersionIdMarker>
+  <DeleteMarker><Key>dir/a.txt</Key><VersionId>v3</VersionId><IsLatest>true</IsLatest>
+    <LastModified>2024-05-01T10:00:02.000Z</LastModified></DeleteMarker>
+  <Version><Key>dir/a.txt</Key><VersionId>v2</VersionId><IsLatest>false</IsLatest>
+    <LastModified>2024-05-01T10:00:01.000Z</LastModified><ETag>"etag2"</ETag><Size>5</Size></Version>
+</ListVersionsResult>`
+	res, err := parseMinioListVersions(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("parse failed, err: %s", err)
+	}
+	if !res.IsTruncated || res.NextKeyMarker != "dir/a.txt" || res.NextVersionIdMarker != "v1" {
+		t.Errorf("unexpected markers: %+v", res)
+	}
+	versions := sortVersions(res.fileMetas())
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got: %d", len(versions))
+	}
+	if v := versions[0]; v.VersionID != "v3" || !v.IsDeleteMarker || !v.IsLatest {
+		t.Errorf("unexpected delete marker: %+v", v)
+	}
+	if v := versions[1]; v.VersionID != "v2" || v.IsDeleteMarker || v.ETag != "etag2" || v.Size != 5 {
+		t.Errorf("unexpected version: %+v", v)
+	}
+}
+
+func TestObjectVersions(t *testing.T) {
+	status, err := ossHelper.GetBucketVersioning()
+	fmt.Println("versioning status:", status, "err:", err)
+
+	ossPath := path.Join(testDir, "versioned.txt")
+	_ = ossHelper.PutObject(ossPath, []byte("version 1"))
+	_ = ossHelper.PutObject(ossPath, []byte("version 2"))
+	_ = ossHelper.DeleteObject(ossPath)
+
+	versions, err := ossHelper.ListObjectVersions(ossPath)
+	fmt.Println("list versions err:", err)
+	var first string
+	for _, v := range versions {
+		fmt.Printf("%s %s latest: %v deleteMarker: %v size: %d\n", v.Key, v.VersionID, v.IsLatest, v.IsDeleteMarker, v.Size)
+		if !v.IsDeleteMarker {
+			first = v.VersionID
+		}
+	}
+	if first == "" {
+		return
+	}
+
+	data, err := ossHelper.GetObject(ossPath, WithVersionID(first))
+	fmt.Println("get first version:", string(data), "err:", err)
+	err = ossHelper.RestoreVersion(ossPath, first)
+	fmt.Println("restore err:", err)
+	meta, err := ossHelper.GetObjectMeta(ossPath)
+	fmt.Println("current version:", meta, "err:", err)
+}
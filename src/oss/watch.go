@@ -0,0 +1,259 @@
+package oss
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hqmin9527/kits-go/src/grace_stop"
+	"github.com/hqmin9527/kits-go/src/logger"
+	"github.com/hqmin9527/kits-go/src/safe"
+)
+
+// 监听目录变化
+// 1. 定期列举prefix下的文件，和上一次的快照对比ETag和LastModified，产生创建、修改、删除事件
+// 2. 快照保存在本地文件中，重启后只产生停止期间的变化；没有快照时以第一次列举的结果为基准，不产生事件
+// 3. 平台支持事件通知时（目前只有MinIO）可以同时监听，事件更及时，定期列举用于补充遗漏的事件
+// 快照在事件发送完成后才保存，异常退出时可能重复产生事件，处理事件需要幂等
+
+type ObjectEventType string
+
+const (
+	ObjectCreated  ObjectEventType = "created"
+	ObjectModified ObjectEventType = "modified"
+	ObjectDeleted  ObjectEventType = "deleted"
+)
+
+const watchEventBuffer = 100
+
+// ObjectEvent 文件变化事件，删除事件只有Key
+type ObjectEvent struct {
+	Type         ObjectEventType
+	Key          string // 作用域内的相对key
+	Size         int64
+	ETag         string
+	LastModified time.Time
+}
+
+// Watcher 监听prefix下的文件变化
+type Watcher struct {
+	o            *Wrapper
+	prefix       string
+	interval     time.Duration
+	snapshotFile string
+	native       bool
+	snapshot     map[string]watchEntry
+}
+
+type watchEntry struct {
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"mtime"` // 由事件通知产生时为空，下次列举时补充
+}
+
+// 事件通知中没有文件的修改时间，只比较ETag
+func (e watchEntry) changed(n watchEntry) bool {
+	if e.ETag != n.ETag {
+		return true
+	}
+	if e.LastModified.IsZero() || n.LastModified.IsZero() {
+		return false
+	}
+	return !e.LastModified.Equal(n.LastModified)
+}
+
+// Watch 每隔interval列举一次prefix，返回的channel在ctx取消或收到grace_stop的关闭信号后关闭
+// 快照保存在系统临时目录中，需要指定快照文件或使用事件通知时使用NewWatcher
+func (o *Wrapper) Watch(ctx context.Context, prefix string, interval time.Duration) (<-chan ObjectEvent, error) {
+	return o.NewWatcher(prefix, interval).Start(ctx)
+}
+
+func (o *Wrapper) NewWatcher(prefix string, interval time.Duration) *Watcher {
+	sum := sha1.Sum([]byte(o.oc.Bucket + "/" + o.fullKey(prefix)))
+	return &Watcher{
+		o:            o,
+		prefix:       prefix,
+		interval:     interval,
+		snapshotFile: filepath.Join(os.TempDir(), "kits-oss-watch", hex.EncodeToString(sum[:])+".json"),
+	}
+}
+
+// SnapshotFile 快照文件的路径，同一个文件只能被一个Watcher使用
+func (w *Watcher) SnapshotFile(path string) *Watcher {
+	w.snapshotFile = path
+	return w
+}
+
+// Native 同时使用平台的事件通知，不支持时只使用定期列举
+func (w *Watcher) Native() *Watcher {
+	w.native = true
+	return w
+}
+
+// Start 加载快照并开始监听，没有快照时先列举一次作为基准
+func (w *Watcher) Start(ctx context.Context) (<-chan ObjectEvent, error) {
+	if err := w.load(); err != nil {
+		return nil, err
+	}
+	if w.snapshot == nil {
+		contents, err := w.o.ListObjects(w.prefix)
+		if err != nil {
+			return nil, err
+		}
+		w.snapshot = make(map[string]watchEntry, len(contents))
+		for _, content := range contents {
+			w.snapshot[content.Key] = newWatchEntry(&content)
+		}
+		if err = w.save(); err != nil {
+			return nil, err
+		}
+	}
+
+	var native <-chan ObjectEvent
+	done := make(chan struct{})
+	if w.native {
+		var err error
+		if native, err = w.o.st.ListenObjectEvents(w.o.oc.Bucket, w.o.fullKey(w.prefix), done); err != nil {
+			logger.Warn("oss watch native events not available, prefix: %s, err: %s", w.prefix, err)
+		}
+	}
+	ch := make(chan ObjectEvent, watchEventBuffer)
+	go safe.SafegoFinally(func() {
+		w.run(ctx, ch, native)
+	}, "oss watcher", func() {
+		close(done)
+		close(ch)
+	})
+	return ch, nil
+}
+
+func (w *Watcher) run(ctx context.Context, ch chan<- ObjectEvent, native <-chan ObjectEvent) {
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-grace_stop.GetStopChan():
+			return
+		case event, ok := <-native:
+			if !ok {
+				logger.Warn("oss watch native events stopped, prefix: %s", w.prefix)
+				native = nil
+				continue
+			}
+			event.Key = w.o.relKey(event.Key)
+			if w.apply(&event) && !sendEvent(ctx, ch, event) {
+				return
+			}
+		case <-ticker.C:
+			if err := w.poll(ctx, ch); err != nil {
+				logger.Error("oss watch poll failed, prefix: %s, err: %s", w.prefix, err)
+			}
+		}
+	}
+}
+
+// 列举并对比快照，事件全部发送后才保存快照
+func (w *Watcher) poll(ctx context.Context, ch chan<- ObjectEvent) error {
+	contents, err := w.o.ListObjects(w.prefix)
+	if err != nil {
+		return err
+	}
+	snapshot := make(map[string]watchEntry, len(contents))
+	var events []ObjectEvent
+	for _, content := range contents {
+		entry := newWatchEntry(&content)
+		snapshot[content.Key] = entry
+		old, ok := w.snapshot[content.Key]
+		if !ok {
+			events = append(events, newObjectEvent(ObjectCreated, &content))
+		} else if old.changed(entry) {
+			events = append(events, newObjectEvent(ObjectModified, &content))
+		}
+	}
+	for key := range w.snapshot {
+		if _, ok := snapshot[key]; !ok {
+			events = append(events, ObjectEvent{Type: ObjectDeleted, Key: key})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Key < events[j].Key
+	})
+
+	for _, event := range events {
+		if !sendEvent(ctx, ch, event) {
+			return nil
+		}
+	}
+	w.snapshot = snapshot
+	return w.save()
+}
+
+// 用事件通知更新快照，返回是否需要发送事件（列举时已经发现的变化不重复发送）
+func (w *Watcher) apply(event *ObjectEvent) bool {
+	old, ok := w.snapshot[event.Key]
+	if event.Type == ObjectDeleted {
+		delete(w.snapshot, event.Key)
+		return ok
+	}
+	entry := watchEntry{Size: event.Size, ETag: strings.Trim(event.ETag, "\"")}
+	w.snapshot[event.Key] = entry
+	if ok {
+		event.Type = ObjectModified
+	}
+	return !ok || old.changed(entry)
+}
+
+// 快照文件不存在时snapshot为nil
+func (w *Watcher) load() error {
+	data, err := os.ReadFile(w.snapshotFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &w.snapshot)
+}
+
+// 先写临时文件再重命名，避免异常退出时快照不完整
+func (w *Watcher) save() error {
+	data, err := json.Marshal(w.snapshot)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(w.snapshotFile), 0755); err != nil {
+		return err
+	}
+	tmp := w.snapshotFile + ".tmp"
+	if err = os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, w.snapshotFile)
+}
+
+func newWatchEntry(meta *FileMeta) watchEntry {
+	return watchEntry{Size: meta.Size, ETag: strings.Trim(meta.ETag, "\""), LastModified: meta.LastModified}
+}
+
+func newObjectEvent(eventType ObjectEventType, meta *FileMeta) ObjectEvent {
+	return ObjectEvent{Type: eventType, Key: meta.Key, Size: meta.Size, ETag: meta.ETag, LastModified: meta.LastModified}
+}
+
+func sendEvent(ctx context.Context, ch chan<- ObjectEvent, event ObjectEvent) bool {
+	select {
+	case ch <- event:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-grace_stop.GetStopChan():
+		return false
+	}
+}
@@ -0,0 +1,80 @@
+package oss
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	o, st := newMemWrapper()
+	st.put("dir/a", []byte("a"))
+	st.put("dir/b", []byte("b"))
+	snapshotFile := filepath.Join(t.TempDir(), "snapshot.json")
+
+	collect := func(ch <-chan ObjectEvent, n int) map[string]ObjectEventType {
+		res := make(map[string]ObjectEventType)
+		timeout := time.After(time.Second)
+		for len(res) < n {
+			select {
+			case event := <-ch:
+				res[event.Key] = event.Type
+			case <-timeout:
+				return res
+			}
+		}
+		return res
+	}
+
+	// 第一次启动以当前文件为基准，不产生事件
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := o.Sub("dir").NewWatcher("", 10*time.Millisecond).SnapshotFile(snapshotFile).Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.put("dir/a", []byte("a2"))
+	st.put("dir/c", []byte("c"))
+	_ = st.DeleteObject("bucket", "dir/b")
+	events := collect(ch, 3)
+	if events["a"] != ObjectModified || events["b"] != ObjectDeleted || events["c"] != ObjectCreated || len(events) != 3 {
+		t.Errorf("unexpected events: %v", events)
+	}
+	cancel()
+	for range ch {
+	}
+
+	// 重启后只产生停止期间的变化
+	st.put("dir/d", []byte("d"))
+	ctx, cancel = context.WithCancel(context.Background())
+	ch, err = o.Sub("dir").NewWatcher("", 10*time.Millisecond).SnapshotFile(snapshotFile).Start(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events = collect(ch, 1)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	// 等待监听协程退出，同时收集剩余的事件
+	for event := range ch {
+		events[event.Key] = event.Type
+	}
+	if events["d"] != ObjectCreated || len(events) != 1 {
+		t.Errorf("only changes after restart should be emitted, events: %v", events)
+	}
+}
+
+func TestWatcherApply(t *testing.T) {
+	w := &Watcher{snapshot: map[string]watchEntry{"a": {ETag: "1", LastModified: time.Now()}}}
+	event := ObjectEvent{Type: ObjectCreated, Key: "a", ETag: "\"1\""}
+	if w.apply(&event) {
+		t.Error("unchanged object should not emit event")
+	}
+	event = ObjectEvent{Type: ObjectCreated, Key: "a", ETag: "2"}
+	if !w.apply(&event) || event.Type != ObjectModified {
+		t.Errorf("changed object should emit modified event, got: %v", event)
+	}
+	event = ObjectEvent{Type: ObjectDeleted, Key: "a"}
+	if !w.apply(&event) || w.apply(&event) {
+		t.Error("deleted event should be emitted once")
+	}
+}
@@ -25,8 +25,10 @@ const (
 
 // oss/obs的操作工具类，已经处理过了oss和obs的平台差异
 type Wrapper struct {
-	st storager
-	oc *Config
+	st     storager
+	oc     *Config
+	cdn    CdnSigner // 没有配置CDN鉴权时为nil
+	prefix string    // Sub作用域的前缀，为空时不做限制
 }
 
 func newOssWrapper(c *Config) (*Wrapper, error) {
@@ -45,15 +47,75 @@ func newOssWrapper(c *Config) (*Wrapper, error) {
 
 	if err != nil {
 		return nil, err
-	} else {
-		return &Wrapper{oc: c, st: st}, nil
 	}
+	cdn, err := newConfigCdnSigner(c)
+	if err != nil {
+		return nil, err
+	}
+	return &Wrapper{oc: c, st: st, cdn: cdn}, nil
 }
 
 func (o *Wrapper) GetBucketName() string {
 	return o.oc.Bucket
 }
 
+// Sub 返回限定在prefix下的Wrapper，其所有key均为相对路径，且无法通过".."跳出prefix
+// 列举结果会去掉prefix，预签名url和临时token也只作用于prefix内
+func (o *Wrapper) Sub(prefix string) *Wrapper {
+	p := strings.TrimSuffix(cleanKey(prefix), "/")
+	if p == "" {
+		return &Wrapper{st: o.st, oc: o.oc, cdn: o.cdn, prefix: o.prefix}
+	}
+	if o.prefix != "" {
+		p = o.prefix + "/" + p
+	}
+	return &Wrapper{st: o.st, oc: o.oc, cdn: o.cdn, prefix: p}
+}
+
+// Root 正式文件的作用域：Prefix/Root/BaseDir，总是从bucket根目录开始计算
+func (o *Wrapper) Root() *Wrapper {
+	return o.bucketRoot().Sub(path.Join(o.oc.Prefix, o.oc.Root, o.oc.BaseDir))
+}
+
+// Tmp 临时文件的作用域：Prefix/TmpRoot/BaseDir，总是从bucket根目录开始计算
+func (o *Wrapper) Tmp() *Wrapper {
+	return o.bucketRoot().Sub(path.Join(o.oc.Prefix, o.oc.TmpRoot, o.oc.BaseDir))
+}
+
+func (o *Wrapper) bucketRoot() *Wrapper {
+	return &Wrapper{st: o.st, oc: o.oc, cdn: o.cdn}
+}
+
+// GetPrefix 返回当前作用域在bucket中的前缀
+func (o *Wrapper) GetPrefix() string {
+	return o.prefix
+}
+
+// 规范化key：去掉"."和".."，去掉开头的"/"，保留结尾的"/"
+func cleanKey(key string) string {
+	k := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if k != "" && strings.HasSuffix(key, "/") {
+		k += "/"
+	}
+	return k
+}
+
+// 作用域内的相对key转为bucket中的完整key
+func (o *Wrapper) fullKey(key string) string {
+	if o.prefix == "" {
+		return key
+	}
+	return o.prefix + "/" + cleanKey(key)
+}
+
+// bucket中的完整key转为作用域内的相对key
+func (o *Wrapper) relKey(key string) string {
+	if o.prefix == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, o.prefix+"/")
+}
+
 // 如果key包含双斜杠，可能会导致文件无法下载和上传且不报错，所以这里预先检查打印日志
 func checkKey(key string) {
 	if strings.Contains(key, "//") {
@@ -61,28 +123,121 @@ func checkKey(key string) {
 	}
 }
 
-func (o *Wrapper) GetObject(key string) ([]byte, error) {
-	return o.st.GetObject(o.oc.Bucket, key)
+// 读取类接口的options用于传入SSE-C密钥等请求参数
+// GetObject、GetFile、GetReader会解压Compress压缩的文件，不需要解压时使用RawContent
+func (o *Wrapper) GetObject(key string, options ...Option) ([]byte, error) {
+	md := buildMetadata(options)
+	if md.raw {
+		return o.st.GetObject(o.oc.Bucket, o.fullKey(key), md)
+	}
+	r, err := o.getDecodedReader(key, md)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	return io.ReadAll(r)
 }
 
-func (o *Wrapper) GetFile(key string, localFile string) error {
-	return o.st.GetFile(o.oc.Bucket, key, localFile)
+func (o *Wrapper) GetFile(key string, localFile string, options ...Option) error {
+	md := buildMetadata(options)
+	if md.raw {
+		return o.st.GetFile(o.oc.Bucket, o.fullKey(key), localFile, md)
+	}
+	r, err := o.getDecodedReader(key, md)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = r.Close()
+	}()
+	fd, err := os.Create(localFile)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fd, r)
+	if closeErr := fd.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// GetReader 流式读取文件，使用完需要Close
+func (o *Wrapper) GetReader(key string, options ...Option) (io.ReadCloser, error) {
+	md := buildMetadata(options)
+	if md.raw {
+		r, _, err := o.getReader(key, 0, -1, md)
+		return r, err
+	}
+	return o.getDecodedReader(key, md)
 }
 
+// GetRange 读取[offset, offset+length)范围的数据，length<0表示读到结尾，使用完需要Close
+// 返回保存的数据，压缩的文件不解压
+func (o *Wrapper) GetRange(key string, offset int64, length int64, options ...Option) (io.ReadCloser, error) {
+	r, _, err := o.getReader(key, offset, length, buildMetadata(options))
+	return r, err
+}
+
+func (o *Wrapper) getDecodedReader(key string, md *Metadata) (io.ReadCloser, error) {
+	r, meta, err := o.getReader(key, 0, -1, md)
+	if err != nil {
+		return nil, err
+	}
+	return decodeReader(r, meta)
+}
+
+// 同时返回文件信息（Size为文件总大小）
+func (o *Wrapper) getReader(key string, offset int64, length int64, md *Metadata) (io.ReadCloser, *FileMeta, error) {
+	r, meta, err := o.st.GetReader(o.oc.Bucket, o.fullKey(key), offset, length, md)
+	if meta != nil {
+		meta.Key = o.relKey(meta.Key)
+	}
+	return r, meta, err
+}
+
+// 上传类接口使用Compress时gzip压缩
 func (o *Wrapper) PutObject(key string, data []byte, options ...Option) error {
 	checkKey(key)
-	return o.st.PutObjectWithMeta(o.oc.Bucket, key, data, buildMetadata(options))
+	md := buildMetadata(options)
+	data, err := compressData(key, data, md)
+	if err != nil {
+		return err
+	}
+	return preconditionError(o.st.PutObjectWithMeta(o.oc.Bucket, o.fullKey(key), data, md))
 }
 
 func (o *Wrapper) PutFile(key string, filePath string, options ...Option) error {
 	checkKey(key)
-	return o.st.PutFileWithMeta(o.oc.Bucket, key, filePath, buildMetadata(options))
+	md := buildMetadata(options)
+	if md.compress {
+		fd, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			_ = fd.Close()
+		}()
+		// 不压缩时仍按文件上传，大文件使用分片上传
+		if br, head := peekHead(fd); md.prepareCompress(key, head) {
+			return o.putCompressed(key, br, md)
+		}
+	}
+	return preconditionError(o.st.PutFileWithMeta(o.oc.Bucket, o.fullKey(key), filePath, md))
 }
 
 // 使用时要注意保护reader不要被其他协程关闭
 func (o *Wrapper) PutReader(key string, r io.Reader, options ...Option) error {
 	checkKey(key)
-	return o.st.PutReaderWithMeta(o.oc.Bucket, key, r, buildMetadata(options))
+	md := buildMetadata(options)
+	if md.compress {
+		var head []byte
+		if r, head = peekHead(r); md.prepareCompress(key, head) {
+			return o.putCompressed(key, r, md)
+		}
+	}
+	return preconditionError(o.st.PutReaderWithMeta(o.oc.Bucket, o.fullKey(key), r, md))
 }
 
 // 上传文件夹, 返回上传失败的文件列表
@@ -121,12 +276,41 @@ func (o *Wrapper) PutFolder(remoteDir string, localFolder string, options ...Opt
 
 // 获取文件概要信息：文件大小，最近修改时间
 func (o *Wrapper) ListObjects(prefix string) ([]FileMeta, error) {
-	return o.st.ListObjects(o.oc.Bucket, prefix)
+	contents, err := o.st.ListObjects(o.oc.Bucket, o.fullKey(prefix))
+	for i := range contents {
+		contents[i].Key = o.relKey(contents[i].Key)
+	}
+	return contents, err
+}
+
+// WalkObjects 分页列举prefix下的文件，不会把所有文件保存在内存中，fn返回错误时停止
+func (o *Wrapper) WalkObjects(prefix string, fn func(meta *FileMeta) error) error {
+	return o.st.WalkObjects(o.oc.Bucket, o.fullKey(prefix), func(meta *FileMeta) error {
+		meta.Key = o.relKey(meta.Key)
+		return fn(meta)
+	})
+}
+
+// ListDir 只列举一层，返回子目录（以"/"结尾）和文件，key均为作用域内的相对路径
+// dir为空表示作用域的根目录，否则按目录处理（自动补充结尾的"/"）
+func (o *Wrapper) ListDir(dir string) ([]string, []FileMeta, error) {
+	prefix := o.fullKey(dir)
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	dirs, files, err := o.st.ListDir(o.oc.Bucket, prefix)
+	for i := range dirs {
+		dirs[i] = o.relKey(dirs[i])
+	}
+	for i := range files {
+		files[i].Key = o.relKey(files[i].Key)
+	}
+	return dirs, files, err
 }
 
 func (o *Wrapper) DeleteObject(key string) error {
 	checkKey(key)
-	return o.st.DeleteObject(o.oc.Bucket, key)
+	return o.st.DeleteObject(o.oc.Bucket, o.fullKey(key))
 }
 
 func (o *Wrapper) DeleteFolder(remoteDir string) error {
@@ -145,9 +329,10 @@ func (o *Wrapper) DeleteFolder(remoteDir string) error {
 	return goLimit.FirstError()
 }
 
+// CopyObject 可以使用NoOverwrite避免覆盖已存在的目标文件，大文件使用分片复制
 func (o *Wrapper) CopyObject(srcKey string, destKey string, options ...Option) error {
 	checkKey(destKey)
-	return o.st.CopyObject(o.oc.Bucket, srcKey, destKey, buildMetadata(options))
+	return preconditionError(o.copyObject(o.fullKey(srcKey), o.fullKey(destKey), buildMetadata(options)))
 }
 
 func (o *Wrapper) CopyFolder(remoteDir string, remoteDistDir string) error {
@@ -162,7 +347,7 @@ func (o *Wrapper) CopyFolder(remoteDir string, remoteDistDir string) error {
 		if !strings.HasSuffix(contentTmp.Key, "/") {
 			var f = func() {
 				subfix := strings.Replace(contentTmp.Key, remoteDir, "", 1)
-				_ = o.CopyObject(contentTmp.Key, joinPath(remoteDistDir, subfix))
+				_ = o.CopyObject(contentTmp.Key, joinPath(remoteDistDir, subfix), withSrcSize(contentTmp.Size))
 			}
 			goLimit.Run(f)
 		}
@@ -176,7 +361,7 @@ func (o *Wrapper) SetObjectMeta(ossPath string, options ...Option) error {
 		return nil
 	}
 
-	return o.st.SetObjectMeta(o.oc.Bucket, ossPath, buildMetadata(options))
+	return o.st.SetObjectMeta(o.oc.Bucket, o.fullKey(ossPath), buildMetadata(options))
 
 }
 
@@ -222,7 +407,7 @@ func (o *Wrapper) MoveFolder(remoteDir string, remoteDistDir string) error {
 
 			goLimit.Run(func() {
 				subfix := strings.Replace(contentTmp.Key, remoteDir, "", 1)
-				_ = o.CopyObject(contentTmp.Key, joinPath(remoteDistDir, subfix))
+				_ = o.CopyObject(contentTmp.Key, joinPath(remoteDistDir, subfix), withSrcSize(contentTmp.Size))
 				_ = o.DeleteObject(contentTmp.Key)
 			})
 		}
@@ -295,39 +480,48 @@ func (o *Wrapper) GetFolderFilter(remoteDir string, localFolder string, match fu
 }
 
 func (o *Wrapper) GetFolderSize(remoteDir string) (int64, error) {
-	contents, err := o.ListObjects(remoteDir)
+	var sum int64 = 0
+	err := o.WalkObjects(remoteDir, func(meta *FileMeta) error {
+		sum += meta.Size
+		return nil
+	})
 	if err != nil {
 		return 0, err
 	}
-	var sum int64 = 0
-	for _, content := range contents {
-		sum += content.Size
-	}
 	return sum, nil
 }
 
 func (o *Wrapper) IsObjectExist(key string) (bool, error) {
-	return o.st.IsObjectExist(o.oc.Bucket, key)
+	return o.st.IsObjectExist(o.oc.Bucket, o.fullKey(key))
 }
 
 func (o *Wrapper) GetDirToken(remoteDir string, expires time.Duration) (*StsTokenInfo, error) {
-	return o.st.GetDirToken(o.oc.Bucket, remoteDir, expires)
+	return o.st.GetDirToken(o.oc.Bucket, o.fullKey(remoteDir), expires)
 }
 
 func (o *Wrapper) GetDirTokenRead(remoteDir string, expires time.Duration) (*StsTokenInfo, error) {
-	return o.st.GetDirTokenRead(o.oc.Bucket, remoteDir, expires)
+	return o.st.GetDirTokenRead(o.oc.Bucket, o.fullKey(remoteDir), expires)
 }
 
 func (o *Wrapper) PresignObject(key string, expires time.Duration) (string, error) {
-	return o.st.PresignObject(o.oc.Bucket, key, expires)
+	return o.st.PresignObject(o.oc.Bucket, o.fullKey(key), expires)
 }
 
-func (o *Wrapper) SignFile(key string, expires time.Duration) (string, error) {
-	return o.st.SignFile(o.oc.Bucket, key, expires)
+// SignFile 下载的签名地址，options支持WithImageProcess、ViaCdn，以及ResponseAttachment等覆盖响应头的参数
+func (o *Wrapper) SignFile(key string, expires time.Duration, options ...Option) (string, error) {
+	md := buildMetadata(options)
+	if md.viaCdn {
+		return o.signFileViaCdn(key, expires, md)
+	}
+	return o.st.SignFile(o.oc.Bucket, o.fullKey(key), expires, md)
 }
 
-func (o *Wrapper) GetObjectMeta(key string) (*FileMeta, error) {
-	return o.st.GetObjectMeta(o.oc.Bucket, key)
+func (o *Wrapper) GetObjectMeta(key string, options ...Option) (*FileMeta, error) {
+	meta, err := o.st.GetObjectMeta(o.oc.Bucket, o.fullKey(key), buildMetadata(options))
+	if meta != nil {
+		meta.Key = o.relKey(meta.Key)
+	}
+	return meta, err
 }
 
 func (o *Wrapper) EscapeDownloadUrl(key string) string {
@@ -339,7 +533,7 @@ func (o *Wrapper) EscapePreviewUrl(key string) string {
 }
 func (o *Wrapper) EscapeRawUrl(key string) string {
 	if o.oc.Internal {
-		return fmt.Sprintf("http://%s.%s/%s", o.oc.Bucket, o.oc.EndpointInner, key)
+		return fmt.Sprintf("http://%s.%s/%s", o.oc.Bucket, o.oc.EndpointInner, o.fullKey(key))
 	}
 	return o.getUrlByType(key, previewType)
 }
@@ -358,14 +552,7 @@ func (o *Wrapper) getUrlByType(key, ty string) string {
 	default:
 		domain = o.oc.Host
 	}
-	ss := strings.Split(key, "/")
-	for i, s := range ss {
-		ss[i] = url.QueryEscape(s)
-		if o.oc.Provider == MinIo {
-			ss[i] = strings.ReplaceAll(ss[i], "+", "%20")
-		}
-	}
-	encodedOssPath := strings.Join(ss, "/")
+	encodedOssPath := o.escapeKey(key)
 	switch o.oc.Provider {
 	case MinIo:
 		res := ""
@@ -380,9 +567,21 @@ func (o *Wrapper) getUrlByType(key, ty string) string {
 	}
 }
 
+// 完整key按路径分段转义
+func (o *Wrapper) escapeKey(key string) string {
+	ss := strings.Split(o.fullKey(key), "/")
+	for i, s := range ss {
+		ss[i] = url.QueryEscape(s)
+		if o.oc.Provider == MinIo {
+			ss[i] = strings.ReplaceAll(ss[i], "+", "%20")
+		}
+	}
+	return strings.Join(ss, "/")
+}
+
 func (o *Wrapper) PutObjectWithMeta(key string, data []byte, md *Metadata) error {
 	checkKey(key)
-	return o.st.PutObjectWithMeta(o.oc.Bucket, key, data, md)
+	return preconditionError(o.st.PutObjectWithMeta(o.oc.Bucket, o.fullKey(key), data, md))
 }
 
 func joinPath(path1 string, path2 string) string {
@@ -201,6 +201,34 @@ func TestSignFile(t *testing.T) {
 	fmt.Println("sign:", sign)
 }
 
+func TestResponseHeaderOptions(t *testing.T) {
+	md := buildMetadata([]Option{ResponseAttachment("报告.pdf"), ResponseContentType("application/pdf"),
+		ResponseCacheControl("no-cache")})
+	expected := map[string]string{
+		responseContentDisposition: "attachment;filename=\"%E6%8A%A5%E5%91%8A.pdf\";filename*=utf-8''%E6%8A%A5%E5%91%8A.pdf",
+		responseContentType:        "application/pdf",
+		responseCacheControl:       "no-cache",
+	}
+	for name, value := range expected {
+		if md.responseHeader[name] != value {
+			t.Errorf("%s expected: %s, got: %s", name, value, md.responseHeader[name])
+		}
+	}
+	if got := buildMetadata([]Option{ResponseInline("")}).responseHeader[responseContentDisposition]; got != "inline" {
+		t.Errorf("unexpected inline disposition: %s", got)
+	}
+}
+
+func TestSignFileResponseHeader(t *testing.T) {
+	ossPath := path.Join(testDir, "hello.txt")
+	sign, err := ossHelper.SignFile(ossPath, time.Hour, ResponseAttachment("下载.txt"), ResponseCacheControl("no-cache"))
+	fmt.Println("err:", err)
+	fmt.Println("sign:", sign)
+	sign, err = ossHelper.SignFile(ossPath, time.Hour, ResponseInline(""), ResponseContentType("text/plain"))
+	fmt.Println("err:", err)
+	fmt.Println("sign:", sign)
+}
+
 func TestGetObjectMeta(t *testing.T) {
 	ossPath := path.Join(testDir, "hello111.txt")
 	meta, err := ossHelper.GetObjectMeta(ossPath)
@@ -227,3 +255,69 @@ func TestEscapeRawUrl(t *testing.T) {
 	url := ossHelper.EscapeRawUrl(ossPath)
 	fmt.Println("url:", url)
 }
+
+func TestSub(t *testing.T) {
+	sub := ossHelper.Sub("tenant/a/").Sub("../b")
+	if sub.GetPrefix() != "tenant/a/b" {
+		t.Fatalf("unexpected prefix: %s", sub.GetPrefix())
+	}
+	cases := map[string]string{
+		"x.txt":          "tenant/a/b/x.txt",
+		"/x.txt":         "tenant/a/b/x.txt",
+		"../../../x.txt": "tenant/a/b/x.txt",
+		"dir/":           "tenant/a/b/dir/",
+		"":               "tenant/a/b/",
+	}
+	for key, expected := range cases {
+		if got := sub.fullKey(key); got != expected {
+			t.Errorf("fullKey(%q) expected: %s, got: %s", key, expected, got)
+		}
+	}
+	if got := sub.relKey("tenant/a/b/dir/x.txt"); got != "dir/x.txt" {
+		t.Errorf("relKey expected: dir/x.txt, got: %s", got)
+	}
+}
+
+func TestSubListObjects(t *testing.T) {
+	root := ossHelper.Root()
+	objects, err := root.ListObjects("test")
+	fmt.Println("prefix:", root.GetPrefix())
+	fmt.Println("err:", err)
+	fmt.Println("objects:", objects)
+}
+
+func TestNormalizeSSE(t *testing.T) {
+	cases := [][3]string{
+		{"", "", ""},
+		{"AES256", "", SSEAes256},
+		{"KMS", "", SSEKms},
+		{"aws:kms", "", SSEKms},
+		{"", "AES256", SSECustomer},
+	}
+	for _, c := range cases {
+		if got := normalizeSSE(c[0], c[1]); got != c[2] {
+			t.Errorf("normalizeSSE(%q, %q) expected: %s, got: %s", c[0], c[1], c[2], got)
+		}
+	}
+}
+
+func TestPutObjectSSE(t *testing.T) {
+	ossPath := path.Join(testDir, "sse.txt")
+	err := ossHelper.PutObject(ossPath, []byte("hello world"), SSEWithKms(""))
+	fmt.Println("err:", err)
+	meta, err := ossHelper.GetObjectMeta(ossPath)
+	fmt.Println("err:", err)
+	if meta != nil {
+		fmt.Println("sse:", meta.SSE, "keyId:", meta.SSEKeyID)
+	}
+}
+
+func TestPutObjectSSECustomer(t *testing.T) {
+	ossPath := path.Join(testDir, "ssec.txt")
+	key := []byte("0123456789abcdef0123456789abcdef")
+	err := ossHelper.PutObject(ossPath, []byte("hello world"), SSEWithCustomerKey(key))
+	fmt.Println("err:", err)
+	data, err := ossHelper.GetObject(ossPath, SSEWithCustomerKey(key))
+	fmt.Println("err:", err)
+	fmt.Println("data:", string(data))
+}